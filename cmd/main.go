@@ -10,13 +10,34 @@ import (
 	_ "github.com/tuhuayuan/go-logagent/filter/grok"
 	_ "github.com/tuhuayuan/go-logagent/filter/patch"
 	_ "github.com/tuhuayuan/go-logagent/filter/timezone"
+	_ "github.com/tuhuayuan/go-logagent/input/beats"
+	_ "github.com/tuhuayuan/go-logagent/input/exec"
 	_ "github.com/tuhuayuan/go-logagent/input/file"
+	_ "github.com/tuhuayuan/go-logagent/input/forward"
+	_ "github.com/tuhuayuan/go-logagent/input/gelf"
+	_ "github.com/tuhuayuan/go-logagent/input/generator"
 	_ "github.com/tuhuayuan/go-logagent/input/http"
+	_ "github.com/tuhuayuan/go-logagent/input/kafka"
+	_ "github.com/tuhuayuan/go-logagent/input/logagent"
+	_ "github.com/tuhuayuan/go-logagent/input/pipe"
+	_ "github.com/tuhuayuan/go-logagent/input/redis"
 	_ "github.com/tuhuayuan/go-logagent/input/stdin"
+	_ "github.com/tuhuayuan/go-logagent/input/syslog"
+	_ "github.com/tuhuayuan/go-logagent/input/tcp"
 	_ "github.com/tuhuayuan/go-logagent/input/udp"
+	_ "github.com/tuhuayuan/go-logagent/input/unix"
 	_ "github.com/tuhuayuan/go-logagent/output/elastic"
+	_ "github.com/tuhuayuan/go-logagent/output/file"
+	_ "github.com/tuhuayuan/go-logagent/output/forward"
+	_ "github.com/tuhuayuan/go-logagent/output/gelf"
+	_ "github.com/tuhuayuan/go-logagent/output/http"
+	_ "github.com/tuhuayuan/go-logagent/output/kafka"
+	_ "github.com/tuhuayuan/go-logagent/output/logagent"
 	_ "github.com/tuhuayuan/go-logagent/output/redis"
 	_ "github.com/tuhuayuan/go-logagent/output/stdout"
+	_ "github.com/tuhuayuan/go-logagent/output/syslog"
+	_ "github.com/tuhuayuan/go-logagent/output/tcp"
+	_ "github.com/tuhuayuan/go-logagent/output/udp"
 
 	"github.com/tuhuayuan/go-logagent/utils"
 )
@@ -90,7 +111,10 @@ func main() {
 		err = ag.Run()
 	}
 
-	if err != nil {
+	if err == utils.ErrUndelivered {
+		// batch mode finished but events left in disk queue.
+		os.Exit(2)
+	} else if err != nil {
 		os.Exit(-1)
 	} else {
 		os.Exit(0)
@@ -0,0 +1,264 @@
+package inputbeats
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "beats"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.TLSConfig
+	Host           string `json:"host"`             // listen address, default 0.0.0.0:5044
+	MaxPayloadSize int    `json:"max_payload_size"` // bytes of one frame at most, default 10MiB
+	MaxConnections int    `json:"max_connections"`  // 0 no limit
+	AckInterval    int    `json:"ack_interval"`     // seconds between keepalive acks, default 5
+
+	hostname     string
+	tlsConfig    *tls.Config
+	listener     net.Listener
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgConns      *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgConns:      &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:5044"
+	}
+	if config.MaxPayloadSize <= 0 {
+		config.MaxPayloadSize = 10 * 1024 * 1024
+	}
+	if config.AckInterval <= 0 {
+		config.AckInterval = 5
+	}
+	if config.tlsConfig, err = config.ServerTLS(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop accept and close connections, events not acked will be resent by beats.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	plugin.connsLock.Lock()
+	if plugin.listener != nil {
+		plugin.listener.Close()
+	}
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgConns.Wait()
+	<-plugin.exitSyncChan
+}
+
+// listen accept connections until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	var (
+		conn     net.Conn
+		listener net.Listener
+	)
+	defer close(plugin.exitSyncChan)
+
+	if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+		utils.Logger.Errorf("Beats listen addr error %s", err)
+		return
+	}
+	if plugin.tlsConfig != nil {
+		listener = tls.NewListener(listener, plugin.tlsConfig)
+	}
+	plugin.connsLock.Lock()
+	select {
+	case <-plugin.exitChan:
+		plugin.connsLock.Unlock()
+		listener.Close()
+		return
+	default:
+		plugin.listener = listener
+	}
+	plugin.connsLock.Unlock()
+	utils.Logger.Infof("Beats start listen at %s", plugin.Host)
+
+	for {
+		if conn, err = listener.Accept(); err != nil {
+			select {
+			case <-plugin.exitChan:
+				err = nil
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				utils.Logger.Warnf("Beats accept error %s", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			utils.Logger.Errorf("Beats accept error %s", err)
+			return
+		}
+		if !plugin.addConn(conn) {
+			utils.Logger.Warnf("Beats max connections reached, reject %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if limit reached or stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	if plugin.MaxConnections > 0 && len(plugin.conns) >= plugin.MaxConnections {
+		return false
+	}
+	plugin.conns[conn] = 1
+	plugin.wgConns.Add(1)
+	return true
+}
+
+// removeConn close and forget the connection.
+func (plugin *PluginConfig) removeConn(conn net.Conn) {
+	plugin.connsLock.Lock()
+	delete(plugin.conns, conn)
+	plugin.connsLock.Unlock()
+	conn.Close()
+	plugin.wgConns.Done()
+}
+
+// handleConn read batches and ack them after input.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	var (
+		version byte
+		events  []beatEvent
+		err     error
+		fields  = map[string]interface{}{}
+	)
+	defer plugin.removeConn(conn)
+
+	if host, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		fields["clientIP"] = host
+		fields["clientPort"], _ = strconv.Atoi(port)
+	}
+	reader := newFrameReader(conn, uint32(plugin.MaxPayloadSize))
+	for {
+		if version, events, err = reader.readBatch(); err != nil {
+			if ne, ok := err.(net.Error); err != io.EOF && !(ok && ne.Timeout()) {
+				utils.Logger.Warnf("Beats read from %s error %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if err = plugin.processBatch(conn, version, events, fields, inChan); err != nil {
+			utils.Logger.Warnf("Beats batch from %s not acked %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// processBatch input events one by one, ack the last sequence when all done.
+// Keepalive acks are sent while the pipeline is slow so beats will not timeout.
+func (plugin *PluginConfig) processBatch(conn net.Conn, version byte, events []beatEvent,
+	fields map[string]interface{}, inChan utils.InputChannel) (err error) {
+	var (
+		acked     uint32
+		writeLock = &sync.Mutex{}
+		done      = make(chan int)
+		wgAck     = &sync.WaitGroup{}
+	)
+	writeAck := func(seq uint32) error {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		_, err := conn.Write(ackFrame(version, seq))
+		return err
+	}
+
+	wgAck.Add(1)
+	go func() {
+		defer wgAck.Done()
+		ticker := time.NewTicker(time.Duration(plugin.AckInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				writeAck(atomic.LoadUint32(&acked))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for _, be := range events {
+		ev := utils.LogEventFromMap(be.fields)
+		// beats has its own host field.
+		if _, ok := ev.Extra["host"]; !ok {
+			ev.Extra["host"] = plugin.hostname
+		}
+		for k, v := range fields {
+			ev.Extra[k] = v
+		}
+		if err = inChan.Input(ev); err != nil {
+			break
+		}
+		atomic.StoreUint32(&acked, be.seq)
+	}
+	close(done)
+	wgAck.Wait()
+	if err != nil {
+		return
+	}
+	if len(events) > 0 {
+		err = writeAck(events[len(events)-1].seq)
+	}
+	return
+}
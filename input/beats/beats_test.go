@@ -0,0 +1,69 @@
+package inputbeats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Ack(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10050",
+	}, 16)
+	conn, err := net.Dial("tcp", "127.0.0.1:10050")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	data := &bytes.Buffer{}
+	data.Write(windowFrame(2))
+	data.Write(compressedFrame(
+		jsonFrame(1, `{"@timestamp":"2017-06-01T10:00:00.000Z","message":"a","host":{"name":"web1"}}`),
+		jsonFrame(2, `{"message":"b"}`),
+	))
+	conn.Write(data.Bytes())
+
+	ack := make([]byte, 6)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(conn, ack)
+	assert.NoError(t, err)
+	assert.Equal(t, ackFrame('2', 2), ack)
+
+	ev := <-inChan.Events
+	assert.Equal(t, "a", ev.Message)
+	assert.Equal(t, 2017, ev.Timestamp.Year())
+	assert.Equal(t, map[string]interface{}{"name": "web1"}, ev.Extra["host"])
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+	ev = <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.NotEmpty(t, ev.Extra["host"])
+	plugin.Stop()
+}
+
+func Test_NoAckOnInputError(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10051",
+	}, 0)
+	inChan.Fail(errors.New("queue full"))
+	conn, err := net.Dial("tcp", "127.0.0.1:10051")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.Write(append(windowFrame(1), jsonFrame(1, `{"message":"a"}`)...))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(make([]byte, 6))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	plugin.Stop()
+}
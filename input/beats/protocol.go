@@ -0,0 +1,196 @@
+package inputbeats
+
+// Lumberjack v2 协议，Beats 使用的传输协议
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	frameWindow     = 'W'
+	frameCompressed = 'C'
+	frameJSON       = 'J'
+	frameData       = 'D'
+	frameAck        = 'A'
+)
+
+var (
+	errPayloadTooLarge = errors.New("lumberjack payload too large")
+)
+
+// beatEvent a data frame with its sequence.
+type beatEvent struct {
+	seq    uint32
+	fields map[string]interface{}
+}
+
+// frameReader read lumberjack frames.
+type frameReader struct {
+	reader  *bufio.Reader
+	maxSize uint32
+}
+
+func newFrameReader(r io.Reader, maxSize uint32) *frameReader {
+	return &frameReader{
+		reader:  bufio.NewReader(r),
+		maxSize: maxSize,
+	}
+}
+
+// readBatch read a window of events, block until all events of the window received.
+func (fr *frameReader) readBatch() (version byte, events []beatEvent, err error) {
+	var (
+		window uint32
+		header [2]byte
+	)
+	for window == 0 || uint32(len(events)) < window {
+		if _, err = io.ReadFull(fr.reader, header[:]); err != nil {
+			return
+		}
+		if version, err = checkVersion(header[0]); err != nil {
+			return
+		}
+		switch header[1] {
+		case frameWindow:
+			if window, err = readUint32(fr.reader); err == nil && window == 0 {
+				err = errors.New("lumberjack window size is zero")
+			}
+		case frameCompressed:
+			events, err = fr.readCompressed(events)
+		case frameJSON, frameData:
+			var ev beatEvent
+			if ev, err = fr.readData(fr.reader, header[1]); err == nil {
+				events = append(events, ev)
+			}
+		default:
+			err = fmt.Errorf("lumberjack unknow frame type %q", header[1])
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readCompressed inflate the payload, it contains data frames.
+func (fr *frameReader) readCompressed(events []beatEvent) ([]beatEvent, error) {
+	var (
+		header  [2]byte
+		payload []byte
+		zr      io.ReadCloser
+		err     error
+	)
+	if payload, err = fr.readPayload(fr.reader); err != nil {
+		return events, err
+	}
+	if zr, err = zlib.NewReader(bytes.NewReader(payload)); err != nil {
+		return events, err
+	}
+	defer zr.Close()
+
+	// limit the inflated size too.
+	inner := bufio.NewReader(io.LimitReader(zr, int64(fr.maxSize)))
+	for {
+		if _, err = io.ReadFull(inner, header[:]); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return events, err
+		}
+		if _, err = checkVersion(header[0]); err != nil {
+			return events, err
+		}
+		if header[1] != frameJSON && header[1] != frameData {
+			return events, fmt.Errorf("lumberjack unexpected frame type %q in compressed frame", header[1])
+		}
+		var ev beatEvent
+		if ev, err = fr.readData(inner, header[1]); err != nil {
+			return events, err
+		}
+		events = append(events, ev)
+	}
+}
+
+// readData read json frame or key value frame.
+func (fr *frameReader) readData(r io.Reader, frameType byte) (ev beatEvent, err error) {
+	var (
+		payload []byte
+		count   uint32
+	)
+	if ev.seq, err = readUint32(r); err != nil {
+		return
+	}
+	if frameType == frameJSON {
+		if payload, err = fr.readPayload(r); err != nil {
+			return
+		}
+		err = json.Unmarshal(payload, &ev.fields)
+		return
+	}
+
+	// key value pairs.
+	if count, err = readUint32(r); err != nil {
+		return
+	}
+	ev.fields = map[string]interface{}{}
+	for i := uint32(0); i < count; i++ {
+		var key, value []byte
+		if key, err = fr.readPayload(r); err != nil {
+			return
+		}
+		if value, err = fr.readPayload(r); err != nil {
+			return
+		}
+		ev.fields[string(key)] = string(value)
+	}
+	return
+}
+
+// readPayload read length prefixed bytes.
+func (fr *frameReader) readPayload(r io.Reader) (payload []byte, err error) {
+	var (
+		length uint32
+	)
+	if length, err = readUint32(r); err != nil {
+		return
+	}
+	if length > fr.maxSize {
+		err = errPayloadTooLarge
+		return
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+// checkVersion v1 and v2 are accepted.
+func checkVersion(version byte) (byte, error) {
+	if version != '1' && version != '2' {
+		return version, fmt.Errorf("lumberjack unknow version %q", version)
+	}
+	return version, nil
+}
+
+// readUint32 big endian.
+func readUint32(r io.Reader) (n uint32, err error) {
+	var buff [4]byte
+	if _, err = io.ReadFull(r, buff[:]); err != nil {
+		return
+	}
+	n = binary.BigEndian.Uint32(buff[:])
+	return
+}
+
+// ackFrame build ack of sequence.
+func ackFrame(version byte, seq uint32) []byte {
+	frame := []byte{version, frameAck, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[2:], seq)
+	return frame
+}
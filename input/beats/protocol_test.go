@@ -0,0 +1,86 @@
+package inputbeats
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeUint32(buff *bytes.Buffer, n uint32) {
+	binary.Write(buff, binary.BigEndian, n)
+}
+
+func windowFrame(n uint32) []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteString("2W")
+	writeUint32(buff, n)
+	return buff.Bytes()
+}
+
+func jsonFrame(seq uint32, payload string) []byte {
+	buff := &bytes.Buffer{}
+	buff.WriteString("2J")
+	writeUint32(buff, seq)
+	writeUint32(buff, uint32(len(payload)))
+	buff.WriteString(payload)
+	return buff.Bytes()
+}
+
+func compressedFrame(frames ...[]byte) []byte {
+	inner := &bytes.Buffer{}
+	zw := zlib.NewWriter(inner)
+	for _, frame := range frames {
+		zw.Write(frame)
+	}
+	zw.Close()
+
+	buff := &bytes.Buffer{}
+	buff.WriteString("2C")
+	writeUint32(buff, uint32(inner.Len()))
+	buff.Write(inner.Bytes())
+	return buff.Bytes()
+}
+
+func Test_ReadBatch(t *testing.T) {
+	data := &bytes.Buffer{}
+	data.Write(windowFrame(3))
+	data.Write(compressedFrame(
+		jsonFrame(1, `{"message":"a"}`),
+		jsonFrame(2, `{"message":"b"}`),
+	))
+	// key value frame of v1.
+	data.WriteString("1D")
+	writeUint32(data, 3)
+	writeUint32(data, 1)
+	writeUint32(data, 4)
+	data.WriteString("line")
+	writeUint32(data, 1)
+	data.WriteString("c")
+
+	reader := newFrameReader(data, 1024)
+	version, events, err := reader.readBatch()
+	assert.NoError(t, err)
+	assert.Equal(t, byte('1'), version)
+	assert.Len(t, events, 3)
+	assert.Equal(t, uint32(2), events[1].seq)
+	assert.Equal(t, "b", events[1].fields["message"])
+	assert.Equal(t, "c", events[2].fields["line"])
+
+	_, _, err = reader.readBatch()
+	assert.Error(t, err)
+}
+
+func Test_ReadBatchInvalid(t *testing.T) {
+	reader := newFrameReader(bytes.NewReader(append(windowFrame(1), jsonFrame(1, `{"message":"too long"}`)...)), 8)
+	_, _, err := reader.readBatch()
+	assert.Equal(t, errPayloadTooLarge, err)
+
+	reader = newFrameReader(bytes.NewReader([]byte("3W\x00\x00\x00\x01")), 8)
+	_, _, err = reader.readBatch()
+	assert.Error(t, err)
+
+	assert.Equal(t, []byte{'2', 'A', 0, 0, 1, 0}, ackFrame('2', 256))
+}
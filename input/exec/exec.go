@@ -0,0 +1,296 @@
+package inputexec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "exec"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.EncodingConfig
+	// codec plain: whole output of a run is one event, line: one event per line
+	utils.CodecConfig
+	Command    string   `json:"command"`     // run by sh -c (cmd /C on windows) if args not set
+	Args       []string `json:"args"`        // arguments, command is executed directly
+	Mode       string   `json:"mode"`        // interval or stream, default interval
+	Interval   int      `json:"interval"`    // seconds between runs, default 60
+	Timeout    int      `json:"timeout"`     // seconds a run can take, default interval
+	MaxBackoff int      `json:"max_backoff"` // stream restart delay at most, default 60
+
+	hostname     string
+	decoder      *utils.Decoder
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Command == "" {
+		err = errors.New("exec command required")
+		return
+	}
+	if config.Mode == "" {
+		config.Mode = "interval"
+	}
+	if config.Mode != "interval" && config.Mode != "stream" {
+		err = errors.New("exec mode must be interval or stream")
+		return
+	}
+	if config.Interval <= 0 {
+		config.Interval = 60
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 60
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop kill running command.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// listen run command until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-plugin.exitChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if plugin.Mode == "stream" {
+		plugin.loopStream(ctx, inChan)
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(plugin.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		plugin.runOnce(ctx, inChan)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// command build the command.
+func (plugin *PluginConfig) command() (cmd *exec.Cmd) {
+	if len(plugin.Args) > 0 {
+		cmd = exec.Command(plugin.Command, plugin.Args...)
+	} else {
+		cmd = shellCommand(plugin.Command)
+	}
+	setProcessGroup(cmd)
+	return
+}
+
+// watch kill the started command and its children when ctx done,
+// call the returned func after command exited.
+func watch(ctx context.Context, cmd *exec.Cmd) func() {
+	done := make(chan int)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcess(cmd)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// emit decode output, add fields and send to pipeline.
+func (plugin *PluginConfig) emit(events []utils.LogEvent, fields map[string]interface{}, inChan utils.InputChannel) {
+	for _, ev := range events {
+		ev.Extra["host"] = plugin.hostname
+		ev.Extra["command"] = plugin.Command
+		for k, v := range fields {
+			ev.Extra[k] = v
+		}
+		inChan.Input(ev)
+	}
+}
+
+// runOnce run command and emit its stdout.
+func (plugin *PluginConfig) runOnce(ctx context.Context, inChan utils.InputChannel) {
+	var (
+		stdout = &bytes.Buffer{}
+		stderr = &bytes.Buffer{}
+		fields = map[string]interface{}{}
+	)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(plugin.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := plugin.command()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Start()
+	if err == nil {
+		done := watch(ctx, cmd)
+		err = cmd.Wait()
+		done()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		utils.Logger.Warnf("Exec %q timeout after %d sec", plugin.Command, plugin.Timeout)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		utils.Logger.Warnf("Exec %q error %s", plugin.Command, err)
+		return
+	}
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+		fields["exit_code"] = status.ExitStatus()
+	}
+	if stderr.Len() > 0 {
+		fields["stderr"] = strings.TrimSpace(plugin.decoder.Decode(stderr.Bytes(), nil))
+	}
+
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	events, err := utils.DecodeEvents(plugin.decoder, codec, stdout.Bytes())
+	if err != nil {
+		utils.Logger.Warnf("Exec %q decode error %s", plugin.Command, err)
+	}
+	plugin.emit(append(events, codec.Flush()...), fields, inChan)
+}
+
+// loopStream keep the command running, restart with backoff if it exits.
+func (plugin *PluginConfig) loopStream(ctx context.Context, inChan utils.InputChannel) {
+	var (
+		maxBackoff = time.Duration(plugin.MaxBackoff) * time.Second
+		backoff    = time.Second
+	)
+	for {
+		start := time.Now()
+		err := plugin.runStream(ctx, inChan)
+		if ctx.Err() != nil {
+			return
+		}
+		// it ran well for a while.
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		utils.Logger.Warnf("Exec %q exited %v, restart in %s", plugin.Command, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// runStream a line of stdout or stderr is an event.
+func (plugin *PluginConfig) runStream(ctx context.Context, inChan utils.InputChannel) (err error) {
+	var (
+		stdout, stderr io.ReadCloser
+		wg             = &sync.WaitGroup{}
+	)
+	cmd := plugin.command()
+	if stdout, err = cmd.StdoutPipe(); err != nil {
+		return
+	}
+	if stderr, err = cmd.StderrPipe(); err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	done := watch(ctx, cmd)
+	defer done()
+	wg.Add(2)
+	go plugin.readLines(stdout, "stdout", wg, inChan)
+	go plugin.readLines(stderr, "stderr", wg, inChan)
+	// pipes must be drained before wait.
+	wg.Wait()
+	return cmd.Wait()
+}
+
+// readLines read until EOF, every stream has its own codec state.
+func (plugin *PluginConfig) readLines(pipe io.Reader, stream string, wg *sync.WaitGroup, inChan utils.InputChannel) {
+	var (
+		line   []byte
+		events []utils.LogEvent
+		err    error
+		derr   error
+		reader = utils.NewLineReader(pipe, plugin.decoder)
+		fields = map[string]interface{}{"stream": stream}
+	)
+	defer wg.Done()
+
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	for err == nil {
+		if line, err = reader.ReadLine(); len(line) == 0 {
+			continue
+		}
+		if events, derr = utils.DecodeEvents(plugin.decoder, codec, line); derr != nil {
+			utils.Logger.Warnf("Exec %q decode error %s", plugin.Command, derr)
+		}
+		plugin.emit(events, fields, inChan)
+	}
+	plugin.emit(codec.Flush(), fields, inChan)
+}
@@ -0,0 +1,82 @@
+package inputexec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Interval(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"command": "echo line1; echo line2; echo oops >&2; exit 3",
+	}, 16)
+	ev := <-inChan.Events
+	assert.Equal(t, "line1\nline2\n", ev.Message)
+	assert.Equal(t, 3, ev.Extra["exit_code"])
+	assert.Equal(t, "oops", ev.Extra["stderr"])
+	plugin.Stop()
+
+	plugin, inChan = testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"command": "echo",
+		"args":    []string{"-e", "a\\nb"},
+		"codec":   "line",
+	}, 16)
+	assert.Equal(t, "a", (<-inChan.Events).Message)
+	ev = <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.Equal(t, 0, ev.Extra["exit_code"])
+	plugin.Stop()
+}
+
+func Test_Timeout(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"command": "echo partial; sleep 5",
+		"timeout": 1,
+	}, 16)
+	time.Sleep(1500 * time.Millisecond)
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 0)
+}
+
+func Test_Stream(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"command": "echo out; echo err >&2; exit 1",
+		"mode":    "stream",
+	}, 16)
+	events := map[string]string{}
+	for i := 0; i < 2; i++ {
+		ev := <-inChan.Events
+		events[ev.Extra["stream"].(string)] = ev.Message
+	}
+	assert.Equal(t, map[string]string{"stdout": "out", "stderr": "err"}, events)
+
+	// restarted after exit.
+	select {
+	case ev := <-inChan.Events:
+		assert.Contains(t, []string{"out", "err"}, ev.Message)
+	case <-time.After(2 * time.Second):
+		t.Error("command not restarted")
+	}
+	plugin.Stop()
+}
+
+func Test_StreamStop(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"command": "while true; do echo tick; sleep 0.1; done",
+		"mode":    "stream",
+	}, 16)
+	assert.Equal(t, "tick", (<-inChan.Events).Message)
+	go func() {
+		for range inChan.Events {
+		}
+	}()
+	plugin.Stop()
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package inputexec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand run command line by sh.
+func shellCommand(line string) *exec.Cmd {
+	return exec.Command("/bin/sh", "-c", line)
+}
+
+// setProcessGroup run command in its own process group.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcess kill the command and its children.
+func killProcess(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
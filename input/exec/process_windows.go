@@ -0,0 +1,21 @@
+package inputexec
+
+import (
+	"os/exec"
+)
+
+// shellCommand run command line by cmd.
+func shellCommand(line string) *exec.Cmd {
+	return exec.Command("cmd", "/C", line)
+}
+
+// setProcessGroup nothing on windows.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcess kill the command.
+func killProcess(cmd *exec.Cmd) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
@@ -5,12 +5,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -23,11 +23,6 @@ const (
 	PluginName = "file"
 )
 
-var (
-	// manage fsnotify watcher
-	mapWatcher = map[string]*fsnotify.Watcher{}
-)
-
 // SinceDBInfo struct of log file offset
 type SinceDBInfo struct {
 	Offset int64 `json:"offset"`
@@ -36,19 +31,45 @@ type SinceDBInfo struct {
 // PluginConfig config of this plugin.
 type PluginConfig struct {
 	utils.InputPluginConfig
-	DirsPath  []string `json:"dirspath"`  // directory of log files
-	FileType  string   `json:"filetype"`  // file suffix looking for
-	Follow    bool     `json:"follow"`    // is follow new log or read from begining
-	SincePath string   `json:"sincepath"` // since store path
-	Intervals int      `json:"intervals"` // interval seconds of write sincdb
+	utils.EncodingConfig
+	utils.CodecConfig
+	DirsPath      []string `json:"dirspath"`       // directory of log files
+	FileType      string   `json:"filetype"`       // file suffix looking for
+	Follow        bool     `json:"follow"`         // is follow new log or read from begining
+	SincePath     string   `json:"sincepath"`      // since store path
+	Intervals     int      `json:"intervals"`      // interval seconds of write sincdb
+	MaxOpenFiles  int      `json:"max_open_files"` // max files open at the same time, 0 no limit
+	CloseInactive int      `json:"close_inactive"` // seconds idle before closing a file, 0 never
+	HarvestLines  int      `json:"harvest_lines"`  // lines read before yielding to waiting files
+	FlushTimeout  int      `json:"flush_timeout"`  // milliseconds idle before lines held by codec end an event, default 1000
 
 	hostname          string
+	decoder           *utils.Decoder
 	SinceDBInfos      map[string]*SinceDBInfo
 	sinceLastInfos    []byte
 	SinceLastSaveTime time.Time
-	running           bool
 	wgExit            *sync.WaitGroup
 	dbInfosLock       *sync.RWMutex
+	watchers          map[string]*fsnotify.Watcher
+	harvesters        map[string]*harvester
+	slots             chan int
+	waiting           int32
+	exitChan          chan int
+}
+
+// harvester state of one watched file.
+type harvester struct {
+	path   string
+	since  *SinceDBInfo // saved offset, start of lines held by codec
+	notify chan int
+	codec  utils.Codec
+
+	offset     int64 // read offset
+	bufferedAt int64 // offset of the first line held by codec, -1 if none
+	fp         *os.File
+	reader     *bufio.Reader
+	buffer     *bytes.Buffer
+	info       os.FileInfo // identity of the last opened file
 }
 
 func init() {
@@ -64,9 +85,11 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 			},
 		},
 		SinceDBInfos: map[string]*SinceDBInfo{},
-		running:      true,
 		wgExit:       &sync.WaitGroup{},
 		dbInfosLock:  &sync.RWMutex{},
+		watchers:     map[string]*fsnotify.Watcher{},
+		harvesters:   map[string]*harvester{},
+		exitChan:     make(chan int),
 	}
 	if err = utils.ReflectConfigPart(part, &me); err != nil {
 		return
@@ -77,6 +100,18 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 	if me.FileType == "" {
 		me.FileType = "log"
 	}
+	if me.HarvestLines <= 0 {
+		me.HarvestLines = 1024
+	}
+	if me.FlushTimeout <= 0 {
+		me.FlushTimeout = 1000
+	}
+	if me.decoder, err = me.NewDecoder(); err != nil {
+		return
+	}
+	if me.MaxOpenFiles > 0 {
+		me.slots = make(chan int, me.MaxOpenFiles)
+	}
 	if me.hostname, err = os.Hostname(); err != nil {
 		return
 	}
@@ -91,11 +126,24 @@ func (plugin *PluginConfig) Start() {
 
 // Stop stop plugin.
 func (plugin *PluginConfig) Stop() {
-	plugin.running = false
-	for _, m := range mapWatcher {
+	close(plugin.exitChan)
+	plugin.dbInfosLock.Lock()
+	for _, m := range plugin.watchers {
 		m.Close()
 	}
+	plugin.dbInfosLock.Unlock()
 	plugin.wgExit.Wait()
+	plugin.saveSinceDB()
+}
+
+// stopped check the plugin is stopping.
+func (plugin *PluginConfig) stopped() bool {
+	select {
+	case <-plugin.exitChan:
+		return true
+	default:
+		return false
+	}
 }
 
 // load current sincedb data.
@@ -143,6 +191,13 @@ func (plugin *PluginConfig) loadSinceDB() (err error) {
 
 // save since data info.
 func (plugin *PluginConfig) saveSinceDB() (err error) {
+	plugin.dbInfosLock.Lock()
+	defer plugin.dbInfosLock.Unlock()
+	return plugin.writeSinceDB()
+}
+
+// write since data info, caller must hold dbInfosLock.
+func (plugin *PluginConfig) writeSinceDB() (err error) {
 	var (
 		data []byte
 	)
@@ -172,13 +227,16 @@ func (plugin *PluginConfig) checkAndSaveSinceDB() (err error) {
 	var (
 		data []byte
 	)
+	plugin.dbInfosLock.Lock()
+	defer plugin.dbInfosLock.Unlock()
+
 	if time.Since(plugin.SinceLastSaveTime) > time.Duration(plugin.Intervals)*time.Second {
-		if data, err = json.Marshal(plugin.SinceDBInfos); err != nil {
+		if data, err = json.MarshalIndent(plugin.SinceDBInfos, "", "\t"); err != nil {
 			utils.Logger.Errorf("Marshal sincedb failed: %s", err)
 			return
 		}
 		if bytes.Compare(data, plugin.sinceLastInfos) != 0 {
-			err = plugin.saveSinceDB()
+			err = plugin.writeSinceDB()
 		}
 	}
 	return
@@ -217,13 +275,13 @@ func (plugin *PluginConfig) watch(inChan utils.InputChannel) (err error) {
 	}
 
 	// loop save sincdb
+	plugin.wgExit.Add(1)
 	go func() {
-		plugin.wgExit.Add(1)
 		defer plugin.wgExit.Done()
 
-		for plugin.running {
+		for !plugin.stopped() {
 			time.Sleep(time.Duration(plugin.Intervals) * time.Second)
-			if err = plugin.checkAndSaveSinceDB(); err != nil {
+			if err := plugin.checkAndSaveSinceDB(); err != nil {
 				return
 			}
 		}
@@ -247,148 +305,404 @@ func (plugin *PluginConfig) watch(inChan utils.InputChannel) (err error) {
 		}
 		// monitor file.
 		utils.Logger.Info("Watching ", fp)
-		readEventChan := make(chan fsnotify.Event, 10)
-		go plugin.loopRead(readEventChan, fp, inChan)
-		go plugin.loopWatch(readEventChan, fp, fsnotify.Create|fsnotify.Write)
+		var h *harvester
+		if h, err = plugin.addHarvester(fp); err != nil {
+			utils.Logger.Warnf("Watch file %s error %s", fp, err)
+			continue
+		}
+		plugin.wgExit.Add(1)
+		go plugin.loopRead(h, inChan)
 	}
 
 	return
 }
 
-// loopRead
-func (plugin *PluginConfig) loopRead(
-	readEventChan chan fsnotify.Event,
-	realPath string,
-	inChan utils.InputChannel,
-) (err error) {
+// addHarvester register a file and make sure its directory is watched.
+func (plugin *PluginConfig) addHarvester(realPath string) (h *harvester, err error) {
 	var (
-		since     *SinceDBInfo
-		fp        *os.File
-		truncated bool
-		ok        bool
-		whence    int // see File.Seek
-		reader    *bufio.Reader
-		line      string
-		size      int
+		watcher *fsnotify.Watcher
+		ok      bool
+	)
+	plugin.dbInfosLock.Lock()
+	defer plugin.dbInfosLock.Unlock()
+
+	// one watcher per directory, shared by all files in it.
+	dir := filepath.Dir(realPath)
+	if _, ok = plugin.watchers[dir]; !ok {
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			err = errors.New("fsnotify create new watcher failed: " + dir)
+			return
+		}
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			err = errors.New("add new watch path failed: " + dir)
+			return
+		}
+		plugin.watchers[dir] = watcher
+		plugin.wgExit.Add(1)
+		go plugin.loopWatch(watcher)
+	}
+
+	// every file decode with its own codec state.
+	codec, err := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	if err != nil {
+		return
+	}
+	// check and set the sincdb
+	since, ok := plugin.SinceDBInfos[realPath]
+	if !ok {
+		since = &SinceDBInfo{}
+		plugin.SinceDBInfos[realPath] = since
+	}
+	h = &harvester{
+		path:       realPath,
+		since:      since,
+		notify:     make(chan int, 1),
+		codec:      codec,
+		bufferedAt: -1,
+		buffer:     &bytes.Buffer{},
+	}
+	plugin.harvesters[filepath.Clean(realPath)] = h
+	return
+}
 
-		buffer = &bytes.Buffer{}
+// loopRead harvest one file, holding an open descriptor only while it has
+// a slot.
+func (plugin *PluginConfig) loopRead(h *harvester, inChan utils.InputChannel) (err error) {
+	var (
+		line    string
+		raw     []byte
+		size    int
+		lines   int
+		offset  int64
+		events  []utils.LogEvent
+		derr    error
+		pending = true // the file may have unread data
 	)
 
 	// for stopping
-	plugin.wgExit.Add(1)
 	defer plugin.wgExit.Done()
+	defer plugin.release(h)
 
-	// check and set the sincdb
-	if since, ok = plugin.SinceDBInfos[realPath]; !ok {
-		plugin.SinceDBInfos[realPath] = &SinceDBInfo{}
-		since = plugin.SinceDBInfos[realPath]
-	}
-	// set or get offset index.
-	if since.Offset == 0 {
-		if plugin.Follow {
-			whence = os.SEEK_END // seek relative to the end
-		} else {
-			whence = os.SEEK_SET // seek relative to the origin of the file
+	for !plugin.stopped() {
+		if !pending {
+			// wait incomming log message
+			if !plugin.waitNotify(h, inChan) {
+				return
+			}
+			pending = true
+		}
+
+		if h.fp == nil {
+			if !plugin.acquire() {
+				return
+			}
+			if err = plugin.open(h); err != nil {
+				utils.Logger.Warnf("Open file %s error %s", h.path, err)
+				plugin.releaseSlot()
+				pending = false
+				continue
+			}
+		}
+
+		for lines = 0; lines < plugin.HarvestLines && !plugin.stopped(); lines++ {
+			// multi-byte newline charset split by its own newline.
+			if plugin.decoder.Width() > 1 {
+				raw, size, err = plugin.decoder.ReadLine(h.reader, h.buffer)
+			} else {
+				line, size, err = readLine(h.reader, h.buffer)
+				raw = []byte(line)
+			}
+			if err != nil {
+				break
+			}
+			offset = h.offset
+			h.offset += int64(size)
+			wasEmpty := buffered(h.codec) == 0
+			if events, derr = utils.DecodeEvents(plugin.decoder, h.codec, raw); derr != nil {
+				utils.Logger.Warnf("Decode file %s at %d error %s", h.path, offset, derr)
+			}
+			// an event held by codec starts at this line if nothing was
+			// held or an event just ended.
+			if buffered(h.codec) == 0 {
+				h.bufferedAt = -1
+			} else if wasEmpty || len(events) > 0 {
+				h.bufferedAt = offset
+			}
+			// push log event to the pipeline.
+			plugin.emit(h, inChan, events, offset, size)
+			plugin.commit(h)
+		}
+		plugin.checkAndSaveSinceDB()
+
+		if err == nil {
+			// batch used up, give the slot to a waiting file.
+			if atomic.LoadInt32(&plugin.waiting) > 0 && h.bufferedAt < 0 {
+				plugin.release(h)
+			}
+			continue
+		}
+		if err != io.EOF {
+			utils.Logger.Warnf("Read file %s error %s", h.path, err)
+			return
+		}
+		err = nil
+		pending = false
+
+		// rotated or truncated while reading, lines held by codec end.
+		if plugin.checkRotate(h) {
+			plugin.flush(h, inChan)
+			plugin.release(h)
+			pending = true
+			continue
+		}
+		if atomic.LoadInt32(&plugin.waiting) > 0 && h.bufferedAt < 0 {
+			plugin.release(h)
 		}
-	} else {
-		whence = os.SEEK_SET // seek relative to the origin of the file
 	}
-	if fp, reader, err = openFileAt(realPath, since.Offset, whence); err != nil {
-		return
+
+	return
+}
+
+// emit push decoded events of a file to the pipeline.
+func (plugin *PluginConfig) emit(h *harvester, inChan utils.InputChannel, events []utils.LogEvent, offset int64, size int) {
+	for _, event := range events {
+		event.Extra["host"] = plugin.hostname
+		event.Extra["path"] = h.path
+		event.Extra["offset"] = offset
+		event.Extra["size"] = size
+		inChan.Input(event)
 	}
-	defer fp.Close()
-	// seek beginning.
-	if truncated, err = isTruncated(fp, since); err != nil {
+}
+
+// flush emit the event held by codec.
+func (plugin *PluginConfig) flush(h *harvester, inChan utils.InputChannel) {
+	if h.bufferedAt < 0 {
 		return
 	}
-	if truncated {
-		utils.Logger.Warnf("File truncated, seeking to beginning: %q", realPath)
-		since.Offset = 0
-		// change cursor
-		if _, err = fp.Seek(0, os.SEEK_SET); err != nil {
-			utils.Logger.Errorf("seek file failed: %q", realPath)
-			return
-		}
+	plugin.emit(h, inChan, h.codec.Flush(), h.bufferedAt, 0)
+	h.bufferedAt = -1
+	plugin.commit(h)
+}
+
+// commit move the saved offset to the read offset, or the start of lines
+// held by codec, they are read again after restart.
+func (plugin *PluginConfig) commit(h *harvester) {
+	plugin.dbInfosLock.Lock()
+	if h.bufferedAt < 0 {
+		h.since.Offset = h.offset
+	} else {
+		h.since.Offset = h.bufferedAt
 	}
-	// looping read and check file change.
-	for plugin.running {
-		if line, size, err = readLine(reader, buffer); err != nil {
-			if err == io.EOF {
-				// wait incomming log message
-				watchev := <-readEventChan
-				if watchev.Name == "@@@exit" {
-					return
-				}
-
-				if watchev.Op&fsnotify.Create == fsnotify.Create {
-					// log file rollover.
-					fp.Close()
-					since.Offset = 0
-					if fp, reader, err = openFileAt(realPath, 0, os.SEEK_SET); err != nil {
-						return
-					}
-				}
-				if truncated, err = isTruncated(fp, since); err != nil {
-					return
-				}
-				if truncated {
-					since.Offset = 0
-					if _, err = fp.Seek(0, os.SEEK_SET); err != nil {
-						return
-					}
-					continue
-				}
+	plugin.dbInfosLock.Unlock()
+}
+
+// buffered lines held by codec.
+func buffered(codec utils.Codec) int {
+	if c, ok := codec.(utils.BufferedCodec); ok {
+		return c.Buffered()
+	}
+	return 0
+}
+
+// loopWatch dispatch directory events to the harvesters.
+func (plugin *PluginConfig) loopWatch(watcher *fsnotify.Watcher) {
+	defer plugin.wgExit.Done()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
 				continue
-			} else {
+			}
+			plugin.dbInfosLock.RLock()
+			h, ok := plugin.harvesters[filepath.Clean(event.Name)]
+			plugin.dbInfosLock.RUnlock()
+			if !ok {
+				continue
+			}
+			select {
+			case h.notify <- 1:
+			default:
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
 				return
 			}
+			utils.Logger.Warnf("File watcher error %s", err)
 		}
+	}
+}
 
-		event := utils.LogEvent{
-			Timestamp: time.Now(),
-			Message:   line,
-			Extra: map[string]interface{}{
-				"host":   plugin.hostname,
-				"path":   realPath,
-				"offset": since.Offset,
-				"size":   size,
-			},
+// waitNotify block until the file changed, end the event held by codec
+// after flush timeout, close the file after idle too long or when other
+// files are waiting for a slot.
+func (plugin *PluginConfig) waitNotify(h *harvester, inChan utils.InputChannel) bool {
+	var (
+		timeout <-chan time.Time
+		yield   <-chan time.Time
+		flush   <-chan time.Time
+	)
+	if h.bufferedAt >= 0 {
+		timer := time.NewTimer(time.Duration(plugin.FlushTimeout) * time.Millisecond)
+		defer timer.Stop()
+		flush = timer.C
+	}
+	if h.fp != nil && plugin.CloseInactive > 0 {
+		timer := time.NewTimer(time.Duration(plugin.CloseInactive) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	if h.fp != nil && plugin.slots != nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		yield = ticker.C
+	}
+
+	for {
+		select {
+		case <-h.notify:
+			return true
+		case <-flush:
+			plugin.flush(h, inChan)
+			flush = nil
+		case <-timeout:
+			utils.Logger.Debugf("Close inactive file %s", h.path)
+			plugin.flush(h, inChan)
+			plugin.release(h)
+			timeout, yield, flush = nil, nil, nil
+		case <-yield:
+			// an event held by codec is not split for other files.
+			if atomic.LoadInt32(&plugin.waiting) > 0 && h.bufferedAt < 0 {
+				plugin.release(h)
+				timeout, yield = nil, nil
+			}
+		case <-plugin.exitChan:
+			return false
 		}
-		since.Offset += int64(size)
-		// push log event to the pipeline.
-		inChan.Input(event)
-		plugin.checkAndSaveSinceDB()
 	}
+}
 
-	return
+// acquire get a open file slot, waiting in order with other harvesters.
+func (plugin *PluginConfig) acquire() bool {
+	if plugin.slots == nil {
+		return true
+	}
+	atomic.AddInt32(&plugin.waiting, 1)
+	defer atomic.AddInt32(&plugin.waiting, -1)
+
+	select {
+	case plugin.slots <- 1:
+		return true
+	case <-plugin.exitChan:
+		return false
+	}
 }
 
-// loopWatch
-func (plugin *PluginConfig) loopWatch(readEventChan chan fsnotify.Event, realPath string, op fsnotify.Op) (err error) {
+// releaseSlot give back a open file slot.
+func (plugin *PluginConfig) releaseSlot() {
+	if plugin.slots != nil {
+		<-plugin.slots
+	}
+}
+
+// release close the file and save its position.
+func (plugin *PluginConfig) release(h *harvester) {
+	if h.fp == nil {
+		return
+	}
+	h.fp.Close()
+	h.fp = nil
+	h.reader = nil
+	// partial line and lines held by codec will be read again from the
+	// saved offset.
+	h.buffer.Reset()
+	h.codec.Flush()
+	h.bufferedAt = -1
+	plugin.releaseSlot()
+	plugin.saveSinceDB()
+}
+
+// open open the file at saved offset, start over if it was replaced.
+func (plugin *PluginConfig) open(h *harvester) (err error) {
 	var (
-		event fsnotify.Event
+		fi        os.FileInfo
+		truncated bool
+		whence    = os.SEEK_SET // seek relative to the origin of the file
 	)
 
-	// for stopping
-	plugin.wgExit.Add(1)
-	defer plugin.wgExit.Done()
+	plugin.dbInfosLock.Lock()
+	defer plugin.dbInfosLock.Unlock()
 
-	for plugin.running {
-		// wait event and notify channel.
-		if event, err = waitWatchEvent(realPath, op, plugin.dbInfosLock); err != nil {
-			readEventChan <- fsnotify.Event{
-				Name: "@@@exit",
-				Op:   0,
-			}
+	if fi, err = os.Stat(h.path); err != nil {
+		return
+	}
+	if h.info == nil {
+		// first open, set or get offset index.
+		if h.since.Offset == 0 && plugin.Follow {
+			whence = os.SEEK_END // seek relative to the end
+		}
+	} else if !os.SameFile(h.info, fi) {
+		// log file rollover while closed.
+		h.since.Offset = 0
+	}
+	h.offset = h.since.Offset
+	if h.fp, h.reader, err = openFileAt(h.path, h.offset, whence); err != nil {
+		return
+	}
+	if whence == os.SEEK_END {
+		if h.offset, err = h.fp.Seek(0, os.SEEK_CUR); err != nil {
+			h.fp.Close()
+			h.fp = nil
+			return
+		}
+		h.since.Offset = h.offset
+	}
+	h.info = fi
+	// seek beginning.
+	if truncated, err = isTruncated(h.fp, h.offset); err != nil {
+		h.fp.Close()
+		h.fp = nil
+		return
+	}
+	if truncated {
+		utils.Logger.Warnf("File truncated, seeking to beginning: %q", h.path)
+		h.since.Offset, h.offset = 0, 0
+		// change cursor
+		if _, err = h.fp.Seek(0, os.SEEK_SET); err != nil {
+			utils.Logger.Errorf("seek file failed: %q", h.path)
+			h.fp.Close()
+			h.fp = nil
 			return
 		}
-		readEventChan <- event
+		h.reader.Reset(h.fp)
 	}
 	return
 }
 
+// checkRotate check the file was replaced or truncated.
+func (plugin *PluginConfig) checkRotate(h *harvester) bool {
+	var (
+		fi        os.FileInfo
+		truncated bool
+		err       error
+	)
+	if h.fp == nil {
+		return false
+	}
+	if fi, err = os.Stat(h.path); err == nil && !os.SameFile(h.info, fi) {
+		utils.Logger.Infof("File rotated, reopen: %q", h.path)
+		return true
+	}
+	truncated, err = isTruncated(h.fp, h.offset)
+	return err == nil && truncated
+}
+
 // isTruncated check file is truncated or not
-func isTruncated(fp *os.File, since *SinceDBInfo) (truncated bool, err error) {
+func isTruncated(fp *os.File, offset int64) (truncated bool, err error) {
 	var (
 		fi os.FileInfo
 	)
@@ -396,7 +710,7 @@ func isTruncated(fp *os.File, since *SinceDBInfo) (truncated bool, err error) {
 		return
 	}
 	// Old offset larger than file size.
-	if fi.Size() < since.Offset {
+	if fi.Size() < offset {
 		truncated = true
 	} else {
 		truncated = false
@@ -460,51 +774,3 @@ func readLine(reader *bufio.Reader, buffer *bytes.Buffer) (line string, size int
 		}
 	}
 }
-
-// waitWatchEvent using fsnotify directory watcher.
-func waitWatchEvent(realPath string, op fsnotify.Op, lock *sync.RWMutex) (event fsnotify.Event, err error) {
-	var (
-		dir     string
-		watcher *fsnotify.Watcher
-		ok      bool
-	)
-
-	dir = filepath.Dir(realPath)
-	// one dir on watcher, use the existied watcher.
-	func() {
-		lock.Lock()
-		defer lock.Unlock()
-		if watcher, ok = mapWatcher[dir]; !ok {
-			if watcher, err = fsnotify.NewWatcher(); err != nil {
-				err = errors.New("fsnotify create new watcher failed: " + dir)
-				return
-			}
-			if err = watcher.Add(dir); err != nil {
-				err = errors.New("add new watch path failed: " + dir)
-				return
-			}
-			mapWatcher[dir] = watcher
-		}
-	}()
-
-	for {
-		select {
-		case event = <-watcher.Events:
-			fmt.Println(event)
-			if event.Name == realPath {
-				if op > 0 {
-					// if this is create or write event
-					if event.Op&op > 0 {
-						return
-					}
-				} else {
-					// any type of event
-					return
-				}
-			}
-		case err = <-watcher.Errors:
-			err = errors.New("watcher error " + realPath)
-			return
-		}
-	}
-}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"sync"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 
 	"github.com/tuhuayuan/go-logagent/queue"
 	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
 )
 
 var (
@@ -34,21 +37,143 @@ func init() {
 	utils.RegistInputHandler(PluginName, InitHandler)
 }
 
-func Test_waitWatchEvent(t *testing.T) {
-	okChan := make(chan bool)
+func Test_loopWatch(t *testing.T) {
+	os.MkdirAll(tempDir, 0755)
+	f, err := os.Create(tempFile)
+	assert.NoError(t, err)
+	defer os.Remove(tempFile)
 
-	go func() {
-		_, err := waitWatchEvent(tempFile, 0, &sync.RWMutex{})
-		assert.NoError(t, err)
-		err = os.Remove(tempFile)
-		okChan <- true
-	}()
+	plugin, err := InitHandler(&utils.ConfigPart{})
+	assert.NoError(t, err)
+	h, err := plugin.addHarvester(tempFile)
+	assert.NoError(t, err)
 
 	time.Sleep(time.Millisecond * 100)
-	f, err := os.Create(tempFile)
+	f.WriteString("line\n")
+	f.Close()
+	select {
+	case <-h.notify:
+	case <-time.After(time.Second):
+		t.Fail()
+	}
+	plugin.Stop()
+}
+
+func Test_MaxOpenFiles(t *testing.T) {
+	dir := "../../tmp/log_limit"
+	since := "../../tmp/since/sincedb_limit"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	os.MkdirAll("../../tmp/since", 0755)
+	os.Remove(since)
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		err := ioutil.WriteFile(dir+"/"+name, []byte("line1\nline2\nline3\n"), 0644)
+		assert.NoError(t, err)
+	}
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"dirspath":       []string{dir},
+		"sincepath":      since,
+		"max_open_files": 1,
+		"close_inactive": 1,
+		"harvest_lines":  1,
+	})
+	assert.NoError(t, err)
+	// harvesters block on input, holding their files.
+	inChan := testutil.NewInputChannel(0)
+	err = plugin.watch(inChan)
 	assert.NoError(t, err)
+
+	paths := map[string]int{}
+	for i := 0; i < 9; i++ {
+		select {
+		case ev := <-inChan.Events:
+			paths[ev.GetString("path")]++
+			assert.True(t, openFiles(t, dir) <= 1)
+		case <-time.After(5 * time.Second):
+			t.FailNow()
+		}
+	}
+	assert.Len(t, paths, 3)
+
+	// the last file is closed after inactive and its slot is given back.
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, openFiles(t, dir))
+	assert.Len(t, plugin.slots, 1)
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, 0, openFiles(t, dir))
+	assert.Len(t, plugin.slots, 0)
+	plugin.Stop()
+
+	for path, since := range plugin.SinceDBInfos {
+		assert.Equal(t, int64(18), since.Offset, path)
+	}
+}
+
+func Test_Multiline(t *testing.T) {
+	dir := "../../tmp/log_multiline"
+	since := "../../tmp/since/sincedb_multiline"
+	path := dir + "/app.log"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir, 0755)
+	os.MkdirAll("../../tmp/since", 0755)
+	os.Remove(since)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("a\n  a1\n"), 0644))
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"dirspath":      []string{dir},
+		"sincepath":     since,
+		"flush_timeout": 500,
+		"codec":         utils.ConfigPart{"type": "multiline", "pattern": "^\\s"},
+	})
+	assert.NoError(t, err)
+	inChan := testutil.NewInputChannel(4)
+	assert.NoError(t, plugin.watch(inChan))
+
+	// continuation appended after EOF is merged.
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, inChan.Events, 0)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	f.WriteString("  a2\nb\n")
+	select {
+	case ev := <-inChan.Events:
+		assert.Equal(t, "a\n  a1\n  a2", ev.Message)
+	case <-time.After(2 * time.Second):
+		t.FailNow()
+	}
+	// the last event ends after flush timeout.
+	select {
+	case ev := <-inChan.Events:
+		assert.Equal(t, "b", ev.Message)
+		assert.Equal(t, int64(12), ev.Extra["offset"])
+	case <-time.After(2 * time.Second):
+		t.FailNow()
+	}
+
+	// held lines are read again after restart.
+	f.WriteString("c\n")
 	f.Close()
-	assert.True(t, <-okChan)
+	time.Sleep(200 * time.Millisecond)
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 0)
+	assert.Equal(t, int64(14), plugin.SinceDBInfos[path].Offset)
+}
+
+// openFiles count files of dir opened by this process.
+func openFiles(t *testing.T, dir string) (count int) {
+	abs, _ := filepath.Abs(dir)
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files unknown without /proc")
+	}
+	for _, fd := range fds {
+		target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if strings.HasPrefix(target, abs+string(filepath.Separator)) {
+			count++
+		}
+	}
+	return
 }
 
 func Test_readLine(t *testing.T) {
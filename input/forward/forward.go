@@ -0,0 +1,284 @@
+package inputforward
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "forward"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.TLSConfig
+	Host           string `json:"host"`            // listen address, default 0.0.0.0:24224
+	SharedKey      string `json:"shared_key"`      // require shared key handshake if set
+	SelfHostname   string `json:"self_hostname"`   // hostname in handshake, default os hostname
+	MaxConnections int    `json:"max_connections"` // 0 no limit
+	MaxChunkSize   int    `json:"max_chunk_size"`  // bytes of compressed entries at most after decompression, default 32MiB
+
+	hostname     string
+	handle       *codec.MsgpackHandle
+	tlsConfig    *tls.Config
+	listener     net.Listener
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgConns      *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		handle:       utils.NewForwardHandle(),
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgConns:      &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:24224"
+	}
+	if config.SelfHostname == "" {
+		config.SelfHostname = config.hostname
+	}
+	if config.MaxChunkSize <= 0 {
+		config.MaxChunkSize = 32 * 1024 * 1024
+	}
+	if config.tlsConfig, err = config.ServerTLS(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop accept and close connections, chunks not acked will be resent.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	plugin.connsLock.Lock()
+	if plugin.listener != nil {
+		plugin.listener.Close()
+	}
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgConns.Wait()
+	<-plugin.exitSyncChan
+}
+
+// listen accept connections until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	var (
+		conn     net.Conn
+		listener net.Listener
+	)
+	defer close(plugin.exitSyncChan)
+
+	if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+		utils.Logger.Errorf("Forward listen addr error %s", err)
+		return
+	}
+	if plugin.tlsConfig != nil {
+		listener = tls.NewListener(listener, plugin.tlsConfig)
+	}
+	plugin.connsLock.Lock()
+	select {
+	case <-plugin.exitChan:
+		plugin.connsLock.Unlock()
+		listener.Close()
+		return
+	default:
+		plugin.listener = listener
+	}
+	plugin.connsLock.Unlock()
+	utils.Logger.Infof("Forward start listen at %s", plugin.Host)
+
+	for {
+		if conn, err = listener.Accept(); err != nil {
+			select {
+			case <-plugin.exitChan:
+				err = nil
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				utils.Logger.Warnf("Forward accept error %s", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			utils.Logger.Errorf("Forward accept error %s", err)
+			return
+		}
+		if !plugin.addConn(conn) {
+			utils.Logger.Warnf("Forward max connections reached, reject %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if limit reached or stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	if plugin.MaxConnections > 0 && len(plugin.conns) >= plugin.MaxConnections {
+		return false
+	}
+	plugin.conns[conn] = 1
+	plugin.wgConns.Add(1)
+	return true
+}
+
+// removeConn close and forget the connection.
+func (plugin *PluginConfig) removeConn(conn net.Conn) {
+	plugin.connsLock.Lock()
+	delete(plugin.conns, conn)
+	plugin.connsLock.Unlock()
+	conn.Close()
+	plugin.wgConns.Done()
+}
+
+// handleConn handshake then read messages, ack chunks after input.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	var (
+		msg    []interface{}
+		events []utils.LogEvent
+		option map[string]interface{}
+		err    error
+		fields = map[string]interface{}{
+			"host": plugin.hostname,
+		}
+	)
+	defer plugin.removeConn(conn)
+
+	if host, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		fields["clientIP"] = host
+		fields["clientPort"], _ = strconv.Atoi(port)
+	}
+	dec := codec.NewDecoder(bufio.NewReader(conn), plugin.handle)
+	enc := codec.NewEncoder(conn, plugin.handle)
+	if plugin.SharedKey != "" {
+		if err = plugin.handshake(dec, enc); err != nil {
+			utils.Logger.Warnf("Forward handshake with %s error %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	for {
+		msg = nil
+		if err = dec.Decode(&msg); err != nil {
+			if ne, ok := err.(net.Error); err != io.EOF && !(ok && ne.Timeout()) {
+				utils.Logger.Warnf("Forward read from %s error %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if events, option, err = utils.ParseForward(plugin.handle, msg, plugin.MaxChunkSize); err != nil {
+			utils.Logger.Warnf("Forward message from %s error %s", conn.RemoteAddr(), err)
+			return
+		}
+		for _, ev := range events {
+			for k, v := range fields {
+				ev.Extra[k] = v
+			}
+			if err = inChan.Input(ev); err != nil {
+				// no ack, client will resend the chunk.
+				utils.Logger.Warnf("Forward input error %s", err)
+				return
+			}
+		}
+		if chunk, ok := option["chunk"]; ok {
+			if err = enc.Encode(map[string]interface{}{"ack": chunk}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handshake HELO, PING and PONG of shared key authentication.
+func (plugin *PluginConfig) handshake(dec *codec.Decoder, enc *codec.Encoder) (err error) {
+	var (
+		nonce = make([]byte, 16)
+		ping  []interface{}
+	)
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+	if err = enc.Encode([]interface{}{"HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      "",
+		"keepalive": true,
+	}}); err != nil {
+		return
+	}
+	// ["PING", hostname, salt, digest, username, password]
+	if err = dec.Decode(&ping); err != nil {
+		return
+	}
+	if len(ping) < 4 || ping[0] != "PING" {
+		return errors.New("ping expected")
+	}
+	hostname := utils.ForwardBytes(ping[1])
+	salt := utils.ForwardBytes(ping[2])
+	key := []byte(plugin.SharedKey)
+	reason := ""
+	digest := utils.ForwardDigest(salt, hostname, nonce, key)
+	if subtle.ConstantTimeCompare(utils.ForwardBytes(ping[3]), []byte(digest)) != 1 {
+		reason = "shared key mismatch"
+	}
+	if err = enc.Encode([]interface{}{
+		"PONG", reason == "", reason, plugin.SelfHostname,
+		utils.ForwardDigest(salt, []byte(plugin.SelfHostname), nonce, key),
+	}); err != nil {
+		return
+	}
+	if reason != "" {
+		err = errors.New(reason)
+	}
+	return
+}
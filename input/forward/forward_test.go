@@ -0,0 +1,81 @@
+package inputforward
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *codec.Decoder, *codec.Encoder) {
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(time.Second))
+	handle := utils.NewForwardHandle()
+	return conn, codec.NewDecoder(bufio.NewReader(conn), handle), codec.NewEncoder(conn, handle)
+}
+
+func Test_Ack(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10070",
+	}, 16)
+	conn, dec, enc := dial(t, "127.0.0.1:10070")
+	defer conn.Close()
+
+	now := time.Now()
+	assert.NoError(t, enc.Encode([]interface{}{
+		"app", []interface{}{
+			[]interface{}{utils.ForwardTime(now.UnixNano()), map[string]interface{}{"log": "a"}},
+			[]interface{}{now.Unix(), map[string]interface{}{"log": "b"}},
+		},
+		map[string]interface{}{"chunk": "c1"},
+	}))
+	var ack map[string]interface{}
+	assert.NoError(t, dec.Decode(&ack))
+	assert.Equal(t, "c1", ack["ack"])
+
+	ev := <-inChan.Events
+	assert.Equal(t, "a", ev.Message)
+	assert.Equal(t, "app", ev.Extra["tag"])
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+	assert.True(t, now.Equal(ev.Timestamp))
+	assert.Equal(t, "b", (<-inChan.Events).Message)
+	plugin.Stop()
+}
+
+func Test_SharedKey(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":          "127.0.0.1:10071",
+		"shared_key":    "secret",
+		"self_hostname": "server",
+	}, 16)
+	for _, key := range []string{"wrong", "secret"} {
+		conn, dec, enc := dial(t, "127.0.0.1:10071")
+		var helo, pong []interface{}
+		assert.NoError(t, dec.Decode(&helo))
+		assert.Equal(t, "HELO", helo[0])
+		nonce := utils.ForwardBytes(helo[1].(map[string]interface{})["nonce"])
+		salt := []byte("salt")
+		enc.Encode([]interface{}{"PING", "client", salt,
+			utils.ForwardDigest(salt, []byte("client"), nonce, []byte(key)), "", ""})
+		assert.NoError(t, dec.Decode(&pong))
+		assert.Equal(t, key == "secret", pong[1])
+		if key == "secret" {
+			assert.Equal(t, utils.ForwardDigest(salt, []byte("server"), nonce, []byte(key)), pong[4])
+			enc.Encode([]interface{}{"app", time.Now().Unix(), map[string]interface{}{"message": "ok"}})
+			assert.Equal(t, "ok", (<-inChan.Events).Message)
+		}
+		conn.Close()
+	}
+	plugin.Stop()
+}
@@ -0,0 +1,326 @@
+package inputgelf
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "gelf"
+
+	maxChunks = 128
+)
+
+var (
+	chunkMagic = []byte{0x1e, 0x0f}
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	Host           string   `json:"host"`             // listen address of udp and tcp
+	Protocols      []string `json:"protocols"`        // udp, tcp, default both
+	MaxMessageSize int      `json:"max_message_size"` // bytes of one message after decompress, default 1MiB
+	ChunkTimeout   int      `json:"chunk_timeout"`    // seconds to wait all chunks of a message, default 5
+
+	hostname     string
+	closers      []func() error
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgExit       *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+// chunkSet chunks of a message.
+type chunkSet struct {
+	chunks   [][]byte
+	received int
+	deadline time.Time
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgExit:       &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:12201"
+	}
+	if len(config.Protocols) == 0 {
+		config.Protocols = []string{"udp", "tcp"}
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 1024 * 1024
+	}
+	if config.ChunkTimeout <= 0 {
+		config.ChunkTimeout = 5
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop it.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// newCodec gelf codec limited by max_message_size.
+func (plugin *PluginConfig) newCodec() utils.Codec {
+	codec, _ := utils.NewCodec(utils.ConfigPart{
+		"type":     "gelf",
+		"max_size": plugin.MaxMessageSize,
+	})
+	return codec
+}
+
+// listen start udp and tcp listeners, block until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	for _, proto := range plugin.Protocols {
+		switch proto {
+		case "udp":
+			var conn net.PacketConn
+			if conn, err = net.ListenPacket("udp", plugin.Host); err != nil {
+				break
+			}
+			plugin.closers = append(plugin.closers, conn.Close)
+			plugin.wgExit.Add(1)
+			go plugin.loopUDP(conn, inChan)
+		case "tcp":
+			var listener net.Listener
+			if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+				break
+			}
+			plugin.closers = append(plugin.closers, listener.Close)
+			plugin.wgExit.Add(1)
+			go plugin.loopTCP(listener, inChan)
+		default:
+			utils.Logger.Warnf("Gelf unknow protocol %s", proto)
+		}
+		if err != nil {
+			utils.Logger.Errorf("Gelf listen %s %s error %s", proto, plugin.Host, err)
+			break
+		}
+	}
+	if err == nil {
+		utils.Logger.Infof("Gelf start listen at %s", plugin.Host)
+		<-plugin.exitChan
+	}
+
+	for _, closer := range plugin.closers {
+		closer()
+	}
+	plugin.connsLock.Lock()
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgExit.Wait()
+	return
+}
+
+// loopUDP a message per datagram or per complete chunk set.
+func (plugin *PluginConfig) loopUDP(conn net.PacketConn, inChan utils.InputChannel) {
+	var (
+		codec   = plugin.newCodec()
+		pending = map[string]*chunkSet{}
+		data    = make([]byte, 64*1024)
+	)
+	defer plugin.wgExit.Done()
+
+	for {
+		// wake up now and then to drop incomplete messages.
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, addr, err := conn.ReadFrom(data)
+		now := time.Now()
+		for id, set := range pending {
+			if now.After(set.deadline) {
+				utils.Logger.Warnf("Gelf drop incomplete message %d of %d chunks", set.received, len(set.chunks))
+				delete(pending, id)
+			}
+		}
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				utils.Logger.Warnf("Gelf read udp error %s", err)
+				time.Sleep(100 * time.Millisecond)
+			}
+			continue
+		}
+
+		message := data[:n]
+		if bytes.HasPrefix(message, chunkMagic) {
+			if message = plugin.addChunk(pending, message); message == nil {
+				continue
+			}
+		} else {
+			message = append([]byte(nil), message...)
+		}
+		plugin.emit(codec, message, addr, inChan)
+	}
+}
+
+// addChunk keep the chunk, return the whole message if all chunks received.
+func (plugin *PluginConfig) addChunk(pending map[string]*chunkSet, chunk []byte) (message []byte) {
+	// magic(2) id(8) sequence(1) count(1)
+	if len(chunk) < 12 {
+		return
+	}
+	id := string(chunk[2:10])
+	seq, count := int(chunk[10]), int(chunk[11])
+	if count == 0 || count > maxChunks || seq >= count {
+		utils.Logger.Warnf("Gelf invalid chunk %d of %d", seq, count)
+		return
+	}
+	set, ok := pending[id]
+	if !ok {
+		set = &chunkSet{
+			chunks:   make([][]byte, count),
+			deadline: time.Now().Add(time.Duration(plugin.ChunkTimeout) * time.Second),
+		}
+		pending[id] = set
+	}
+	if len(set.chunks) != count || set.chunks[seq] != nil {
+		return
+	}
+	set.chunks[seq] = append([]byte(nil), chunk[12:]...)
+	set.received++
+	if set.received < count {
+		return
+	}
+	delete(pending, id)
+	message = bytes.Join(set.chunks, nil)
+	return
+}
+
+// loopTCP accept connections until listener closed.
+func (plugin *PluginConfig) loopTCP(listener net.Listener, inChan utils.InputChannel) {
+	defer plugin.wgExit.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			utils.Logger.Warnf("Gelf accept error %s", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !plugin.addConn(conn) {
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	plugin.conns[conn] = 1
+	plugin.wgExit.Add(1)
+	return true
+}
+
+// handleConn messages are terminated by null byte.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	defer func() {
+		plugin.connsLock.Lock()
+		delete(plugin.conns, conn)
+		plugin.connsLock.Unlock()
+		conn.Close()
+		plugin.wgExit.Done()
+	}()
+
+	codec := plugin.newCodec()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), plugin.MaxMessageSize+1)
+	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		// some clients send newline after the null byte.
+		if message := bytes.TrimSpace(scanner.Bytes()); len(message) > 0 {
+			plugin.emit(codec, message, conn.RemoteAddr(), inChan)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			utils.Logger.Warnf("Gelf read from %s error %s", conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// emit decode message and send to pipeline.
+func (plugin *PluginConfig) emit(codec utils.Codec, message []byte, addr net.Addr, inChan utils.InputChannel) {
+	events, err := codec.Decode(message)
+	if err != nil {
+		utils.Logger.Warnf("Gelf decode message from %s error %s", addr, err)
+		return
+	}
+	host, port, _ := net.SplitHostPort(addr.String())
+	for _, ev := range events {
+		// gelf has its own host field.
+		if _, ok := ev.Extra["host"]; !ok {
+			ev.Extra["host"] = plugin.hostname
+		}
+		ev.Extra["clientIP"] = host
+		ev.Extra["clientPort"], _ = strconv.Atoi(port)
+		inChan.Input(ev)
+	}
+}
@@ -0,0 +1,74 @@
+package inputgelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func chunk(id string, seq, count byte, data []byte) []byte {
+	return append(append([]byte{0x1e, 0x0f}, append([]byte(id), seq, count)...), data...)
+}
+
+func Test_UDP(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":      "127.0.0.1:10060",
+		"protocols": []string{"udp"},
+	}, 16)
+	conn, err := net.Dial("udp", "127.0.0.1:10060")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.Write([]byte(`{"version":"1.1","host":"app1","short_message":"plain","timestamp":1496311200.5,"level":3,"_user":"admin"}`))
+	ev := <-inChan.Events
+	assert.Equal(t, "plain", ev.Message)
+	assert.Equal(t, "app1", ev.Extra["host"])
+	assert.Equal(t, 3, ev.Extra["level"])
+	assert.Equal(t, "admin", ev.Extra["user"])
+	assert.Equal(t, int64(1496311200500), ev.Timestamp.UnixNano()/int64(time.Millisecond))
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+
+	// gzip compressed and chunked, out of order.
+	buff := &bytes.Buffer{}
+	w := gzip.NewWriter(buff)
+	w.Write([]byte(`{"version":"1.1","host":"app1","short_message":"chunked"}`))
+	w.Close()
+	data := buff.Bytes()
+	half := len(data) / 2
+	conn.Write(chunk("12345678", 1, 2, data[half:]))
+	conn.Write(chunk("87654321", 0, 2, []byte("never complete")))
+	conn.Write(chunk("12345678", 0, 2, data[:half]))
+	assert.Equal(t, "chunked", (<-inChan.Events).Message)
+
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 0)
+}
+
+func Test_TCP(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":      "127.0.0.1:10061",
+		"protocols": []string{"tcp"},
+	}, 16)
+	conn, err := net.Dial("tcp", "127.0.0.1:10061")
+	assert.NoError(t, err)
+	conn.Write([]byte("{\"short_message\":\"a\"}\x00{\"short_message\":\"b\"}\x00\n{\"short_message\""))
+	assert.Equal(t, "a", (<-inChan.Events).Message)
+	ev := <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.NotEmpty(t, ev.Extra["host"])
+	conn.Write([]byte(":\"c\"}\x00"))
+	assert.Equal(t, "c", (<-inChan.Events).Message)
+	conn.Close()
+	plugin.Stop()
+}
@@ -0,0 +1,186 @@
+package inputgenerator
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "generator"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	// codec decode generated text, ex: json samples
+	utils.CodecConfig
+	Message string                 `json:"message"` // template formatted with event, ex: "request ${sequence}"
+	Lines   []string               `json:"lines"`   // templates used in turn
+	File    string                 `json:"file"`    // templates file, a template per line
+	Fields  map[string]interface{} `json:"fields"`  // static fields of every event
+	Rate    float64                `json:"rate"`    // events per second, 0 is as fast as possible
+	Count   int64                  `json:"count"`   // stop generating after count events, 0 is unlimited
+
+	hostname     string
+	samples      []string
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Rate < 0 || config.Count < 0 {
+		err = errors.New("generator rate and count must not be negative")
+		return
+	}
+	if config.Message != "" {
+		config.samples = append(config.samples, config.Message)
+	}
+	config.samples = append(config.samples, config.Lines...)
+	if config.File != "" {
+		var lines []string
+		if lines, err = readSamples(config.File); err != nil {
+			return
+		}
+		config.samples = append(config.samples, lines...)
+	}
+	if len(config.samples) == 0 {
+		config.samples = []string{"Hello world ${sequence}"}
+	}
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// readSamples non-empty lines of file.
+func readSamples(path string) (lines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err == nil && len(lines) == 0 {
+		err = errors.New("generator file " + path + " has no sample")
+	}
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.loopGenerate)
+}
+
+// Stop stop it.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// loopGenerate generate events at rate until count reached or stopped.
+func (plugin *PluginConfig) loopGenerate(inChan utils.InputChannel) (err error) {
+	var (
+		sequence int64
+		start    = time.Now()
+	)
+	defer close(plugin.exitSyncChan)
+
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	for plugin.Count == 0 || sequence < plugin.Count {
+		if plugin.Rate > 0 {
+			next := start.Add(time.Duration(float64(sequence) / plugin.Rate * float64(time.Second)))
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-plugin.exitChan:
+					return
+				case <-time.After(wait):
+				}
+			}
+		}
+		select {
+		case <-plugin.exitChan:
+			return
+		default:
+		}
+		plugin.generate(codec, sequence, inChan)
+		sequence++
+	}
+	for _, event := range codec.Flush() {
+		plugin.input(event, sequence-1, inChan)
+	}
+
+	elapsed := time.Since(start)
+	utils.Logger.Infof("Generator finished %d events in %s, %.1f events/sec",
+		sequence, elapsed, float64(sequence)/elapsed.Seconds())
+	<-plugin.exitChan
+	return
+}
+
+// generate format sample of sequence, decode and send to pipeline.
+func (plugin *PluginConfig) generate(codec utils.Codec, sequence int64, inChan utils.InputChannel) {
+	template := utils.LogEvent{
+		Timestamp: time.Now(),
+		Extra: map[string]interface{}{
+			"host":     plugin.hostname,
+			"sequence": sequence,
+		},
+	}
+	for k, v := range plugin.Fields {
+		template.Extra[k] = v
+	}
+	text := template.Format(plugin.samples[sequence%int64(len(plugin.samples))])
+	events, err := utils.DecodeEvents(nil, codec, []byte(text))
+	if err != nil {
+		utils.Logger.Warnf("Generator decode error %s", err)
+	}
+	for _, event := range events {
+		plugin.input(event, sequence, inChan)
+	}
+}
+
+// input add fields and send to pipeline.
+func (plugin *PluginConfig) input(event utils.LogEvent, sequence int64, inChan utils.InputChannel) {
+	for k, v := range plugin.Fields {
+		if _, ok := event.Extra[k]; !ok {
+			event.Extra[k] = v
+		}
+	}
+	if _, ok := event.Extra["host"]; !ok {
+		event.Extra["host"] = plugin.hostname
+	}
+	event.Extra["sequence"] = sequence
+	inChan.Input(event)
+}
@@ -0,0 +1,70 @@
+package inputgenerator
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Count(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"lines":  []string{"GET /${sequence} from ${app}", "POST /${sequence}"},
+		"fields": map[string]interface{}{"app": "demo"},
+		"count":  3,
+	}, 100)
+	ev := <-inChan.Events
+	assert.Equal(t, "GET /0 from demo", ev.Message)
+	assert.Equal(t, int64(0), ev.Extra["sequence"])
+	assert.Equal(t, "demo", ev.Extra["app"])
+	assert.NotEmpty(t, ev.Extra["host"])
+	assert.Equal(t, "POST /1", (<-inChan.Events).Message)
+	assert.Equal(t, "GET /2 from demo", (<-inChan.Events).Message)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, inChan.Events, 0)
+	plugin.Stop()
+}
+
+func Test_Rate(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"rate": 20,
+	}, 100)
+	// generating since 100ms before started.
+	time.Sleep(400 * time.Millisecond)
+	plugin.Stop()
+	n := len(inChan.Events)
+	assert.True(t, n >= 8 && n <= 12, "%d events", n)
+	assert.Equal(t, "Hello world 0", (<-inChan.Events).Message)
+}
+
+func Test_FileCodec(t *testing.T) {
+	file, err := ioutil.TempFile("", "generator")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(`{"message": "sample ${sequence}", "level": "info", "host": "web1"}` + "\n\n")
+	file.Close()
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"file":  file.Name(),
+		"codec": "json",
+		"count": 2,
+	}, 100)
+	ev := <-inChan.Events
+	assert.Equal(t, "sample 0", ev.Message)
+	assert.Equal(t, "info", ev.Extra["level"])
+	assert.Equal(t, "web1", ev.Extra["host"])
+	assert.Equal(t, "sample 1", (<-inChan.Events).Message)
+	plugin.Stop()
+
+	_, err = InitHandler(&utils.ConfigPart{"file": file.Name() + ".missing"})
+	assert.Error(t, err)
+}
@@ -1,10 +1,20 @@
 package inputhttp
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,15 +26,32 @@ const (
 	PluginName = "http"
 )
 
+var (
+	errUnsupportedType     = errors.New("content type not accept")
+	errUnsupportedEncoding = errors.New("content encoding not accept")
+)
+
 // PluginConfig Plugin Config struct of this plugin
 type PluginConfig struct {
 	utils.InputPluginConfig
-	Host    string   `json:"host"`
-	URLPath string   `json:"url_path"`
-	Methods []string `json:"methods"`
+	utils.EncodingConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Host         string   `json:"host"`
+	URLPath      string   `json:"url_path"`
+	Methods      []string `json:"methods"`
+	Raw          bool     `json:"raw"`           // whole body is the message
+	AuthToken    string   `json:"auth_token"`    // bearer token
+	AuthUser     string   `json:"auth_user"`     // basic auth user
+	AuthPassword string   `json:"auth_password"` // basic auth password
+	MaxBodySize  int64    `json:"max_body_size"` // bytes after decompress, default 10MiB
+	QueueSize    int      `json:"queue_size"`    // requests waiting for pipeline, default 16
+	QueueTimeout int      `json:"queue_timeout"` // milliseconds to wait before 429, default 1000
 
 	hostname     string
-	httpChan     chan utils.LogEvent
+	decoder      *utils.Decoder
+	server       *http.Server
+	httpChan     chan []utils.LogEvent
 	exitChan     chan int
 	exitSyncChan chan int
 }
@@ -41,7 +68,6 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 				Type: PluginName,
 			},
 		},
-		httpChan:     make(chan utils.LogEvent),
 		exitChan:     make(chan int),
 		exitSyncChan: make(chan int),
 	}
@@ -63,6 +89,36 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 	for i, v := range config.Methods {
 		config.Methods[i] = strings.ToUpper(v)
 	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 10 * 1024 * 1024
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 16
+	}
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = 1000
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	// without codec the body is decoded by Content-Type, check it here,
+	// every request has its own codec.
+	if config.Codec != nil {
+		if _, err = config.NewCodec(nil); err != nil {
+			return
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.URLPath, config.Handler)
+	config.server = &http.Server{
+		Addr:    config.Host,
+		Handler: mux,
+	}
+	if config.server.TLSConfig, err = config.ServerTLS(); err != nil {
+		return
+	}
+	config.httpChan = make(chan []utils.LogEvent, config.QueueSize)
 
 	plugin = &config
 	return
@@ -70,43 +126,82 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 
 // Start start it.
 func (plugin *PluginConfig) Start() {
-	_, err := plugin.Invoke(func(inChan utils.InputChannel) {
-		var mux = http.NewServeMux()
-		mux.HandleFunc(plugin.URLPath, plugin.Handler)
-		go func(serverAddr string, m *http.ServeMux) {
-			utils.Logger.Infof("Http start listen at %s", serverAddr)
-			if err := http.ListenAndServe(serverAddr, m); err != nil {
-				utils.Logger.Warnf("Http start error %s", err)
-			}
-		}(plugin.Host, mux)
-
-		for {
-			select {
-			case ev := <-plugin.httpChan:
-				inChan.Input(ev)
-			case <-plugin.exitChan:
-				close(plugin.exitSyncChan)
-				return
-			}
-		}
-	})
+	_, err := plugin.Invoke(plugin.listen)
 	if err != nil {
 		utils.Logger.Warnf("Http start error %s", err)
 	}
 }
 
-// Stop stop it.
+// Stop shutdown server, events of accepted requests are still emitted.
 func (plugin *PluginConfig) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := plugin.server.Shutdown(ctx); err != nil {
+		utils.Logger.Warnf("Http shutdown error %s", err)
+		plugin.server.Close()
+	}
 	close(plugin.exitChan)
 	<-plugin.exitSyncChan
 }
 
+// listen serve http and emit events until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	var (
+		listener net.Listener
+	)
+	defer close(plugin.exitSyncChan)
+
+	if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+		utils.Logger.Errorf("Http listen addr error %s", err)
+		<-plugin.exitChan
+		return
+	}
+	if plugin.server.TLSConfig != nil {
+		listener = tls.NewListener(listener, plugin.server.TLSConfig)
+	}
+	go func() {
+		utils.Logger.Infof("Http start listen at %s", plugin.Host)
+		if err := plugin.server.Serve(listener); err != http.ErrServerClosed {
+			utils.Logger.Warnf("Http serve error %s", err)
+		}
+	}()
+
+	for {
+		select {
+		case events := <-plugin.httpChan:
+			plugin.emit(inChan, events)
+		case <-plugin.exitChan:
+			// server is shutdown, no more sender.
+			for {
+				select {
+				case events := <-plugin.httpChan:
+					plugin.emit(inChan, events)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// emit send events to pipeline.
+func (plugin *PluginConfig) emit(inChan utils.InputChannel, events []utils.LogEvent) {
+	for _, ev := range events {
+		if err := inChan.Input(ev); err != nil {
+			utils.Logger.Warnf("Http input error %s", err)
+		}
+	}
+}
+
 // Handler http request handler
 func (plugin *PluginConfig) Handler(w http.ResponseWriter, r *http.Request) {
 	var (
 		methodMatched bool
 		err           error
 		method        string
+		raw           []byte
+		resp          []byte
+		events        []utils.LogEvent
 	)
 	method = strings.ToUpper(r.Method)
 
@@ -121,49 +216,227 @@ func (plugin *PluginConfig) Handler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-
-	contentType := r.Header.Get("Content-Type")
-	typeAndCodec := strings.Split(contentType, ";")
-	ev := utils.LogEvent{
-		Timestamp: time.Now(),
-		Extra: map[string]interface{}{
-			"host":     plugin.hostname,
-			"clientIP": r.RemoteAddr,
-		},
+	if !plugin.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="logagent"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
-	switch typeAndCodec[0] {
-	case "application/json":
-		var raw []byte
-		if raw, err = ioutil.ReadAll(r.Body); err == nil {
-			objs := map[string]interface{}{}
-			if err = json.Unmarshal(raw, &objs); err == nil {
-				for k, v := range objs {
-					ev.Extra[k] = v
-				}
-			}
+
+	if raw, err = plugin.readBody(w, r); err != nil {
+		if err == errUnsupportedEncoding {
+			writeError(w, http.StatusUnsupportedMediaType, err)
+		} else {
+			writeError(w, http.StatusBadRequest, err)
 		}
-	case "application/x-www-form-urlencoded":
-		r.ParseForm()
-		for k, v := range r.Form {
-			ev.Extra[k] = v
+		return
+	}
+
+	contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+	switch {
+	case plugin.Codec != nil:
+		events, err = plugin.decodeCodec(raw)
+	case plugin.Raw || contentType == "text/plain":
+		ev := utils.LogEvent{
+			Timestamp: time.Now(),
+			Extra:     map[string]interface{}{},
 		}
+		ev.Message = plugin.decoder.Decode(raw, &ev)
+		events = append(events, ev)
+	case contentType == "application/json":
+		events, err = plugin.decodeJSON(raw)
+	case contentType == "application/x-ndjson" || contentType == "application/x-ldjson":
+		events, err = plugin.decodeNDJSON(raw)
+	case contentType == "application/x-www-form-urlencoded":
+		events, err = plugin.decodeForm(raw)
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("[Content-Type:" + contentType + "] not accept."))
+		err = errUnsupportedType
 	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		if err == errUnsupportedType {
+			writeError(w, http.StatusBadRequest, errors.New("[Content-Type:"+contentType+"] not accept."))
+		} else {
+			writeError(w, http.StatusBadRequest, err)
+		}
 		return
 	}
-	plugin.httpChan <- ev
-	resp, err := json.MarshalIndent(ev.Extra, "", "  ")
+
+	// respond fields of the event, an array of them for a bulk body.
+	extras := []map[string]interface{}{}
+	clientIP, clientPort, _ := net.SplitHostPort(r.RemoteAddr)
+	for _, ev := range events {
+		ev.Extra["host"] = plugin.hostname
+		ev.Extra["clientIP"] = clientIP
+		ev.Extra["clientPort"], _ = strconv.Atoi(clientPort)
+		extras = append(extras, ev.Extra)
+	}
+	var body interface{} = extras
+	if len(extras) == 1 {
+		body = extras[0]
+	}
+	// encode before the events are sent and changed by filters.
+	resp, err = json.MarshalIndent(body, "", "  ")
+	if len(events) > 0 {
+		timer := time.NewTimer(time.Duration(plugin.QueueTimeout) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case plugin.httpChan <- events:
+		case <-timer.C:
+			// pipeline is backed up, let client retry later.
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, errors.New("pipeline busy"))
+			return
+		}
+	}
+
 	if err != nil {
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
 	w.Write(resp)
+}
+
+// decodeCodec decode the body by a codec of this request, lines buffered
+// by the codec end with the body.
+func (plugin *PluginConfig) decodeCodec(raw []byte) (events []utils.LogEvent, err error) {
+	var (
+		codec utils.Codec
+	)
+	if codec, err = plugin.NewCodec(nil); err != nil {
+		return
+	}
+	if events, err = utils.DecodeEvents(plugin.decoder, codec, raw); err != nil {
+		return
+	}
+	events = append(events, codec.Flush()...)
+	return
+}
+
+// authorized check bearer token or basic auth if configed.
+func (plugin *PluginConfig) authorized(r *http.Request) bool {
+	if plugin.AuthToken == "" && plugin.AuthUser == "" {
+		return true
+	}
+	if plugin.AuthToken != "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(plugin.AuthToken)) == 1 {
+			return true
+		}
+	}
+	if plugin.AuthUser != "" {
+		user, password, ok := r.BasicAuth()
+		if ok &&
+			subtle.ConstantTimeCompare([]byte(user), []byte(plugin.AuthUser)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(plugin.AuthPassword)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody read body, gunzip if needed, limited by max_body_size.
+func (plugin *PluginConfig) readBody(w http.ResponseWriter, r *http.Request) (raw []byte, err error) {
+	var (
+		body io.Reader = http.MaxBytesReader(w, r.Body, plugin.MaxBodySize)
+	)
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(body); err != nil {
+			return
+		}
+		defer gz.Close()
+		// limit the decompressed size too.
+		body = io.LimitReader(gz, plugin.MaxBodySize+1)
+	default:
+		err = errUnsupportedEncoding
+		return
+	}
+	if raw, err = ioutil.ReadAll(body); err != nil {
+		return
+	}
+	if int64(len(raw)) > plugin.MaxBodySize {
+		err = errors.New("request body too large")
+	}
+	return
+}
+
+// decodeJSON an object or an array of objects.
+func (plugin *PluginConfig) decodeJSON(raw []byte) (events []utils.LogEvent, err error) {
+	var (
+		ev   = utils.LogEvent{Extra: map[string]interface{}{}}
+		text = bytes.TrimSpace([]byte(plugin.decoder.Decode(raw, &ev)))
+		objs []map[string]interface{}
+	)
+	if len(text) > 0 && text[0] == '[' {
+		err = json.Unmarshal(text, &objs)
+	} else {
+		obj := map[string]interface{}{}
+		err = json.Unmarshal(text, &obj)
+		objs = append(objs, obj)
+	}
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		event := utils.LogEventFromMap(obj)
+		event.AddTag(ev.Tags...)
+		events = append(events, event)
+	}
 	return
 }
+
+// decodeNDJSON an object per line.
+func (plugin *PluginConfig) decodeNDJSON(raw []byte) (events []utils.LogEvent, err error) {
+	ev := utils.LogEvent{Extra: map[string]interface{}{}}
+	text := plugin.decoder.Decode(raw, &ev)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		obj := map[string]interface{}{}
+		if err = json.Unmarshal([]byte(line), &obj); err != nil {
+			err = errors.New("line " + strconv.Itoa(i+1) + ": " + err.Error())
+			return
+		}
+		event := utils.LogEventFromMap(obj)
+		event.AddTag(ev.Tags...)
+		events = append(events, event)
+	}
+	return
+}
+
+// decodeForm values of a form in one event.
+func (plugin *PluginConfig) decodeForm(raw []byte) (events []utils.LogEvent, err error) {
+	var (
+		ev = utils.LogEvent{
+			Timestamp: time.Now(),
+			Extra:     map[string]interface{}{},
+		}
+		form url.Values
+	)
+	if form, err = url.ParseQuery(string(raw)); err != nil {
+		return
+	}
+	for k, v := range form {
+		// percent-decoded values are still in the configed charset.
+		values := make([]string, len(v))
+		for i, value := range v {
+			values[i] = plugin.decoder.Decode([]byte(value), &ev)
+		}
+		ev.Extra[plugin.decoder.Decode([]byte(k), &ev)] = values
+	}
+	events = append(events, ev)
+	return
+}
+
+// writeError response with status and error text.
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
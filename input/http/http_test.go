@@ -2,13 +2,17 @@ package inputhttp
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
 )
 
 func init() {
@@ -43,3 +47,166 @@ func Test_Run(t *testing.T) {
 	assert.NoError(t, err)
 	config.StopInputs()
 }
+
+var testClient = &http.Client{
+	Transport: &http.Transport{DisableKeepAlives: true},
+}
+
+func post(t *testing.T, url, contentType string, body []byte, headers map[string]string) *http.Response {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := testClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp
+}
+
+func Test_Bulk(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":    "127.0.0.1:10040",
+		"methods": []string{"POST"},
+	}, 16)
+	url := "http://127.0.0.1:10040/"
+
+	resp := post(t, url, "application/json", []byte(`[{"message":"a"},{"message":"b","id":1}]`), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "a", (<-inChan.Events).Message)
+	ev := <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.Equal(t, float64(1), ev.Extra["id"])
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("{\"message\":\"c\"}\n\n{\"message\":\"d\"}\n"))
+	w.Close()
+	resp = post(t, url, "application/x-ndjson", gz.Bytes(), map[string]string{
+		"Content-Encoding": "gzip",
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "c", (<-inChan.Events).Message)
+	assert.Equal(t, "d", (<-inChan.Events).Message)
+
+	resp = post(t, url, "text/plain", []byte("raw line"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "raw line", (<-inChan.Events).Message)
+
+	// unknown type is rejected without event.
+	resp = post(t, url, "application/xml", []byte("<a/>"), nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = post(t, url, "application/json", []byte(`{"message":`), nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 0)
+}
+
+func Test_Response(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":    "127.0.0.1:10044",
+		"methods": []string{"POST"},
+	}, 16)
+	respond := func(body string) (fields interface{}) {
+		resp, err := testClient.Post("http://127.0.0.1:10044/", "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&fields))
+		return
+	}
+
+	// a single event responds its fields as before.
+	fields := respond(`{"message":"a","id":1}`).(map[string]interface{})
+	assert.Equal(t, float64(1), fields["id"])
+	assert.Equal(t, "127.0.0.1", fields["clientIP"])
+	assert.NotEmpty(t, fields["host"])
+	<-inChan.Events
+
+	list := respond(`[{"id":2},{"id":3}]`).([]interface{})
+	assert.Len(t, list, 2)
+	assert.Equal(t, float64(3), list[1].(map[string]interface{})["id"])
+	<-inChan.Events
+	<-inChan.Events
+	plugin.Stop()
+}
+
+func Test_Codec(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":    "127.0.0.1:10043",
+		"methods": []string{"POST"},
+		"codec":   utils.ConfigPart{"type": "multiline", "pattern": "^\\s"},
+	}, 16)
+	url := "http://127.0.0.1:10043/"
+
+	// the last message ends with the body, not merged into the next request.
+	resp := post(t, url, "text/plain", []byte("a\n  a1\nb\n  b1"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "a\n  a1", (<-inChan.Events).Message)
+	assert.Equal(t, "b\n  b1", (<-inChan.Events).Message)
+	resp = post(t, url, "text/plain", []byte("  c1\nd"), nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "  c1", (<-inChan.Events).Message)
+	assert.Equal(t, "d", (<-inChan.Events).Message)
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 0)
+}
+
+func Test_Auth(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":          "127.0.0.1:10041",
+		"methods":       []string{"POST"},
+		"raw":           true,
+		"auth_token":    "secret",
+		"auth_user":     "user",
+		"auth_password": "pass",
+	}, 16)
+	url := "http://127.0.0.1:10041/"
+
+	resp := post(t, url, "application/json", []byte("x"), nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = post(t, url, "application/json", []byte("x"), map[string]string{
+		"Authorization": "Bearer wrong",
+	})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = post(t, url, "application/json", []byte("x"), map[string]string{
+		"Authorization": "Bearer secret",
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "x", (<-inChan.Events).Message)
+
+	req, _ := http.NewRequest("POST", url, bytes.NewReader([]byte("y")))
+	req.SetBasicAuth("user", "pass")
+	resp, err := testClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "y", (<-inChan.Events).Message)
+	plugin.Stop()
+}
+
+func Test_Backpressure(t *testing.T) {
+	// nobody reads the input channel.
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":          "127.0.0.1:10042",
+		"methods":       []string{"POST"},
+		"queue_size":    1,
+		"queue_timeout": 100,
+	}, 0)
+	url := "http://127.0.0.1:10042/"
+
+	// one in emitting, one in queue.
+	assert.Equal(t, http.StatusOK, post(t, url, "text/plain", []byte("1"), nil).StatusCode)
+	assert.Equal(t, http.StatusOK, post(t, url, "text/plain", []byte("2"), nil).StatusCode)
+	resp := post(t, url, "text/plain", []byte("3"), nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	go func() {
+		for range inChan.Events {
+		}
+	}()
+	plugin.Stop()
+}
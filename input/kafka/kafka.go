@@ -0,0 +1,265 @@
+package inputkafka
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "kafka"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Brokers        []string `json:"brokers"`         // bootstrap brokers, default 127.0.0.1:9092
+	Topics         []string `json:"topics"`          // topics to consume
+	GroupID        string   `json:"group_id"`        // consumer group, default logagent
+	Version        string   `json:"version"`         // kafka version, default 1.0.0
+	ClientID       string   `json:"client_id"`       // default logagent
+	InitialOffset  string   `json:"initial_offset"`  // newest or oldest if group has no offset, default newest
+	CommitInterval int      `json:"commit_interval"` // seconds between offset commits, default 1
+	Timeout        int      `json:"timeout"`         // seconds of dial, default 10
+
+	hostname     string
+	config       *sarama.Config
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+// groupHandler consume claims of a session.
+type groupHandler struct {
+	plugin *PluginConfig
+	inChan utils.InputChannel
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if len(config.Brokers) == 0 {
+		config.Brokers = []string{"127.0.0.1:9092"}
+	}
+	if len(config.Topics) == 0 {
+		err = errors.New("kafka input topics required")
+		return
+	}
+	if config.GroupID == "" {
+		config.GroupID = "logagent"
+	}
+	// check codec here, every claim has its own.
+	if _, err = config.newCodec(); err != nil {
+		return
+	}
+	if config.config, err = config.newConfig(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// newCodec codec of options, same as kafka output.
+func (plugin *PluginConfig) newCodec() (utils.Codec, error) {
+	return plugin.NewCodec(utils.ConfigPart{"type": "json"})
+}
+
+// newConfig consumer config of options.
+func (plugin *PluginConfig) newConfig() (config *sarama.Config, err error) {
+	config = sarama.NewConfig()
+	if plugin.Version == "" {
+		plugin.Version = "1.0.0"
+	}
+	if config.Version, err = sarama.ParseKafkaVersion(plugin.Version); err != nil {
+		return
+	}
+	if plugin.ClientID == "" {
+		plugin.ClientID = "logagent"
+	}
+	config.ClientID = plugin.ClientID
+	switch plugin.InitialOffset {
+	case "", "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	case "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		err = errors.New("kafka initial_offset must be newest or oldest")
+		return
+	}
+	if plugin.CommitInterval <= 0 {
+		plugin.CommitInterval = 1
+	}
+	config.Consumer.Offsets.AutoCommit.Interval = time.Duration(plugin.CommitInterval) * time.Second
+	if plugin.Timeout <= 0 {
+		plugin.Timeout = 10
+	}
+	config.Net.DialTimeout = time.Duration(plugin.Timeout) * time.Second
+	if config.Net.TLS.Config, err = plugin.ClientTLS(); err != nil {
+		return
+	}
+	config.Net.TLS.Enable = config.Net.TLS.Config != nil
+	config.Consumer.Return.Errors = true
+	err = config.Validate()
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop it, offsets of events sent to pipeline are committed.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// listen join the group until stopped, reconnect on error.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-plugin.exitChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		err = plugin.consume(ctx, inChan)
+		if ctx.Err() != nil {
+			return nil
+		}
+		utils.Logger.Warnf("Kafka input group %s error %s, retry in 1 sec.", plugin.GroupID, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// consume sessions of the group until error or canceled.
+func (plugin *PluginConfig) consume(ctx context.Context, inChan utils.InputChannel) (err error) {
+	var (
+		group sarama.ConsumerGroup
+	)
+	if group, err = sarama.NewConsumerGroup(plugin.Brokers, plugin.GroupID, plugin.config); err != nil {
+		return
+	}
+	defer group.Close()
+	go func() {
+		for gerr := range group.Errors() {
+			utils.Logger.Warnf("Kafka input group %s error %s", plugin.GroupID, gerr)
+		}
+	}()
+
+	handler := &groupHandler{plugin: plugin, inChan: inChan}
+	// a session ends at rebalance, join again.
+	for ctx.Err() == nil {
+		if err = group.Consume(ctx, plugin.Topics, handler); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Setup nothing to do.
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup nothing to do.
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim mark message consumed only after its events are sent to
+// pipeline. Partitions are consumed in parallel, each with its own codec,
+// a message is marked when the codec holds none of its lines.
+func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) (err error) {
+	var (
+		codec  utils.Codec
+		last   *sarama.ConsumerMessage
+		events []utils.LogEvent
+	)
+	if codec, err = h.plugin.newCodec(); err != nil {
+		return
+	}
+	for msg := range claim.Messages() {
+		if events, err = utils.DecodeEvents(nil, codec, msg.Value); err != nil {
+			// bad data will never be decoded, drop it.
+			utils.Logger.Warnf("Kafka input decode error %s", err)
+		}
+		if err = h.plugin.emit(sess.Context(), events, msg, h.inChan); err != nil {
+			return
+		}
+		last = msg
+		if c, ok := codec.(utils.BufferedCodec); !ok || c.Buffered() == 0 {
+			sess.MarkMessage(msg, "")
+		}
+	}
+	// lines held by codec end with the claim.
+	if last != nil {
+		if err = h.plugin.emit(sess.Context(), codec.Flush(), last, h.inChan); err != nil {
+			return
+		}
+		sess.MarkMessage(last, "")
+	}
+	return nil
+}
+
+// emit send events of message to pipeline, retry until success or session ends.
+func (plugin *PluginConfig) emit(ctx context.Context, events []utils.LogEvent, msg *sarama.ConsumerMessage, inChan utils.InputChannel) (err error) {
+	for _, ev := range events {
+		if _, ok := ev.Extra["host"]; !ok {
+			ev.Extra["host"] = plugin.hostname
+		}
+		ev.Extra["kafka_topic"] = msg.Topic
+		ev.Extra["kafka_partition"] = msg.Partition
+		ev.Extra["kafka_offset"] = msg.Offset
+		if len(msg.Key) > 0 {
+			ev.Extra["kafka_key"] = string(msg.Key)
+		}
+		for {
+			if err = inChan.Input(ev); err == nil {
+				break
+			}
+			utils.Logger.Warnf("Kafka input %s/%d error %s, retry in 1 sec.", msg.Topic, msg.Partition, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package inputkafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// testInputChannel refuse events while blocked.
+type testInputChannel struct {
+	events  chan utils.LogEvent
+	blocked int32
+}
+
+func (c *testInputChannel) Input(ev utils.LogEvent) error {
+	if atomic.LoadInt32(&c.blocked) == 1 && ev.Message == "b" {
+		return errors.New("disk queue full")
+	}
+	c.events <- ev
+	return nil
+}
+
+// committed the latest offset committed of logs/0.
+func committed(broker *sarama.MockBroker) (offset int64) {
+	offset = -1
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			if o, _, err := req.Offset("logs", 0); err == nil {
+				offset = o
+			}
+		}
+	}
+	return
+}
+
+func Test_Consume(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("logs", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("logs", 0, sarama.OffsetOldest, 0).
+			SetOffset("logs", 0, sarama.OffsetNewest, 2),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "logagent", broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).
+			SetGroupProtocol(sarama.RangeBalanceStrategyName).
+			SetMemberId("m1").
+			SetLeaderId("m1").
+			SetMember("m1", &sarama.ConsumerGroupMemberMetadata{Topics: []string{"logs"}}),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).
+			SetMemberAssignment(&sarama.ConsumerGroupMemberAssignment{
+				Topics: map[string][]int32{"logs": {0}},
+			}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("logagent", "logs", 0, -1, "", sarama.ErrNoError),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).SetVersion(4).
+			SetMessage("logs", 0, 0, sarama.StringEncoder(`{"message":"a"}`)).
+			SetMessage("logs", 0, 1, sarama.StringEncoder(`{"message":"b"}`)).
+			SetHighWaterMark("logs", 0, 2),
+		"HeartbeatRequest":    sarama.NewMockHeartbeatResponse(t),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+	})
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"brokers":        []string{broker.Addr()},
+		"topics":         []string{"logs"},
+		"initial_offset": "oldest",
+	})
+	assert.NoError(t, err)
+	inChan := &testInputChannel{events: make(chan utils.LogEvent, 10), blocked: 1}
+	go plugin.listen(inChan)
+
+	ev := <-inChan.events
+	assert.Equal(t, "a", ev.Message)
+	assert.Equal(t, "logs", ev.Extra["kafka_topic"])
+	assert.Equal(t, int64(0), ev.Extra["kafka_offset"])
+	assert.NotEmpty(t, ev.Extra["host"])
+
+	// b is not accepted, only a is committed.
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, int64(1), committed(broker))
+
+	atomic.StoreInt32(&inChan.blocked, 0)
+	ev = <-inChan.events
+	assert.Equal(t, "b", ev.Message)
+	assert.Equal(t, int64(1), ev.Extra["kafka_offset"])
+	plugin.Stop()
+	assert.Equal(t, int64(2), committed(broker))
+
+	for _, part := range []utils.ConfigPart{
+		{},
+		{"topics": []string{"logs"}, "initial_offset": "latest"},
+	} {
+		_, err = InitHandler(&part)
+		assert.Error(t, err)
+	}
+}
+
+// testSession record marked offsets.
+type testSession struct {
+	sarama.ConsumerGroupSession
+	lock   sync.Mutex
+	marked map[int32]int64
+}
+
+func (s *testSession) Context() context.Context { return context.Background() }
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.marked[msg.Partition] = msg.Offset
+}
+
+// testClaim messages of a partition.
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func Test_ClaimCodec(t *testing.T) {
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"topics": []string{"logs"},
+		"codec":  utils.ConfigPart{"type": "multiline", "pattern": "^\\s"},
+	})
+	assert.NoError(t, err)
+	inChan := &testInputChannel{events: make(chan utils.LogEvent, 10)}
+	handler := &groupHandler{plugin: plugin, inChan: inChan}
+	sess := &testSession{marked: map[int32]int64{}}
+	claims := []*testClaim{
+		{messages: make(chan *sarama.ConsumerMessage, 4)},
+		{messages: make(chan *sarama.ConsumerMessage, 4)},
+	}
+	// lines of partitions are interleaved, every claim merges its own.
+	for i, value := range []string{"a", "b", "  a1", "  b1", "c", "d"} {
+		p := int32(i % 2)
+		claims[p].messages <- &sarama.ConsumerMessage{Topic: "logs", Partition: p, Offset: int64(i / 2), Value: []byte(value)}
+	}
+	wg := sync.WaitGroup{}
+	for _, claim := range claims {
+		close(claim.messages)
+		wg.Add(1)
+		go func(claim *testClaim) {
+			defer wg.Done()
+			assert.NoError(t, handler.ConsumeClaim(sess, claim))
+		}(claim)
+	}
+	wg.Wait()
+	close(inChan.events)
+
+	messages := map[int32][]string{}
+	for ev := range inChan.events {
+		p := ev.Extra["kafka_partition"].(int32)
+		messages[p] = append(messages[p], ev.Message)
+	}
+	assert.Equal(t, []string{"a\n  a1", "c"}, messages[0])
+	assert.Equal(t, []string{"b\n  b1", "d"}, messages[1])
+	// the last message is marked after its lines are flushed.
+	assert.Equal(t, map[int32]int64{0: 2, 1: 2}, sess.marked)
+}
@@ -0,0 +1,216 @@
+package inputlogagent
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "logagent"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.TLSConfig
+	Host           string `json:"host"`            // listen address, default 0.0.0.0:5170
+	MaxBatchSize   int    `json:"max_batch_size"`  // bytes of a batch at most before and after decompression, default 32MiB
+	MaxConnections int    `json:"max_connections"` // 0 no limit
+	Timeout        int    `json:"timeout"`         // seconds of writing an ack, default 10
+
+	hostname     string
+	tlsConfig    *tls.Config
+	listener     net.Listener
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgConns      *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgConns:      &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:5170"
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = 32 * 1024 * 1024
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10
+	}
+	if config.tlsConfig, err = config.ServerTLS(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop accept and close connections, batches not acked will be resent by agents.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	plugin.connsLock.Lock()
+	if plugin.listener != nil {
+		plugin.listener.Close()
+	}
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgConns.Wait()
+	<-plugin.exitSyncChan
+}
+
+// listen accept connections until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	var (
+		conn     net.Conn
+		listener net.Listener
+	)
+	defer close(plugin.exitSyncChan)
+
+	if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+		utils.Logger.Errorf("Logagent listen addr error %s", err)
+		return
+	}
+	if plugin.tlsConfig != nil {
+		listener = tls.NewListener(listener, plugin.tlsConfig)
+	}
+	plugin.connsLock.Lock()
+	select {
+	case <-plugin.exitChan:
+		plugin.connsLock.Unlock()
+		listener.Close()
+		return
+	default:
+		plugin.listener = listener
+	}
+	plugin.connsLock.Unlock()
+	utils.Logger.Infof("Logagent start listen at %s", plugin.Host)
+
+	for {
+		if conn, err = listener.Accept(); err != nil {
+			select {
+			case <-plugin.exitChan:
+				err = nil
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				utils.Logger.Warnf("Logagent accept error %s", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			utils.Logger.Errorf("Logagent accept error %s", err)
+			return
+		}
+		if !plugin.addConn(conn) {
+			utils.Logger.Warnf("Logagent max connections reached, reject %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if limit reached or stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	if plugin.MaxConnections > 0 && len(plugin.conns) >= plugin.MaxConnections {
+		return false
+	}
+	plugin.conns[conn] = 1
+	plugin.wgConns.Add(1)
+	return true
+}
+
+// removeConn close and forget the connection.
+func (plugin *PluginConfig) removeConn(conn net.Conn) {
+	plugin.connsLock.Lock()
+	delete(plugin.conns, conn)
+	plugin.connsLock.Unlock()
+	conn.Close()
+	plugin.wgConns.Done()
+}
+
+// handleConn read batches, ack a batch after all its events are written
+// to the disk queue. The connection is closed without ack on any error,
+// the agent sends the batch again.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	var (
+		reader *utils.AgentReader
+		seq    uint64
+		events []utils.LogEvent
+		err    error
+	)
+	defer plugin.removeConn(conn)
+
+	if reader, err = utils.NewAgentReader(conn, plugin.MaxBatchSize); err != nil {
+		utils.Logger.Errorf("Logagent reader error %s", err)
+		return
+	}
+	for {
+		if seq, events, err = reader.ReadBatch(); err != nil {
+			if ne, ok := err.(net.Error); err != io.EOF && !(ok && ne.Timeout()) {
+				utils.Logger.Warnf("Logagent read from %s error %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		for _, ev := range events {
+			// keep host of the edge agent.
+			if _, ok := ev.Extra["host"]; !ok {
+				ev.Extra["host"] = plugin.hostname
+			}
+			if err = inChan.Input(ev); err != nil {
+				utils.Logger.Warnf("Logagent batch %d from %s not acked %s", seq, conn.RemoteAddr(), err)
+				return
+			}
+		}
+		conn.SetWriteDeadline(time.Now().Add(time.Duration(plugin.Timeout) * time.Second))
+		if _, err = conn.Write(utils.AgentAck(seq)); err != nil {
+			utils.Logger.Warnf("Logagent ack to %s error %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
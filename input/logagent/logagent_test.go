@@ -0,0 +1,80 @@
+package inputlogagent
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func batch(t *testing.T, seq uint64, events ...utils.LogEvent) []byte {
+	var items [][]byte
+	codec, err := utils.NewAgentCodec()
+	assert.NoError(t, err)
+	for _, ev := range events {
+		data, err := codec.Encode(ev)
+		assert.NoError(t, err)
+		items = append(items, data)
+	}
+	frame, err := utils.AgentBatch(seq, items, true)
+	assert.NoError(t, err)
+	return frame
+}
+
+func Test_Ack(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10080",
+	}, 16)
+	conn, err := net.Dial("tcp", "127.0.0.1:10080")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.Write(batch(t, 1,
+		utils.LogEvent{Message: "a", Extra: map[string]interface{}{"host": "edge1"}},
+		utils.LogEvent{Message: "b", Extra: map[string]interface{}{}},
+	))
+	conn.Write(batch(t, 2, utils.LogEvent{Message: "c", Extra: map[string]interface{}{}}))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	ack := make([]byte, 24)
+	_, err = io.ReadFull(conn, ack)
+	assert.NoError(t, err)
+	assert.Equal(t, append(utils.AgentAck(1), utils.AgentAck(2)...), ack)
+
+	ev := <-inChan.Events
+	assert.Equal(t, "a", ev.Message)
+	assert.Equal(t, "edge1", ev.Extra["host"])
+	ev = <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.NotEmpty(t, ev.Extra["host"])
+	ev = <-inChan.Events
+	assert.Equal(t, "c", ev.Message)
+	plugin.Stop()
+}
+
+func Test_NoAckOnInputError(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10081",
+	}, 0)
+	inChan.Fail(errors.New("disk full"))
+	conn, err := net.Dial("tcp", "127.0.0.1:10081")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.Write(batch(t, 1, utils.LogEvent{Message: "a", Extra: map[string]interface{}{}}))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(make([]byte, 12))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+	plugin.Stop()
+}
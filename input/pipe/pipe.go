@@ -0,0 +1,202 @@
+package inputpipe
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "pipe"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.EncodingConfig
+	utils.CodecConfig
+	Path        string `json:"path"`        // fifo file, created if not exists
+	Permissions string `json:"permissions"` // octal mode of created fifo, default "0600"
+
+	hostname     string
+	decoder      *utils.Decoder
+	mode         uint32
+	file         *os.File
+	fileLock     *sync.Mutex
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	var (
+		mode uint64
+	)
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		fileLock:     &sync.Mutex{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Path == "" {
+		err = errors.New("pipe path required")
+		return
+	}
+	if config.Permissions == "" {
+		config.Permissions = "0600"
+	}
+	if mode, err = strconv.ParseUint(config.Permissions, 8, 32); err != nil {
+		return
+	}
+	config.mode = uint32(mode)
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.loopRead)
+}
+
+// Stop stop it.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	for {
+		// unblock reading or waiting a writer.
+		plugin.fileLock.Lock()
+		if plugin.file != nil {
+			plugin.file.SetReadDeadline(time.Now())
+		}
+		plugin.fileLock.Unlock()
+		if w, err := os.OpenFile(plugin.Path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			w.Close()
+		}
+		select {
+		case <-plugin.exitSyncChan:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// stopped check exit signal.
+func (plugin *PluginConfig) stopped() bool {
+	select {
+	case <-plugin.exitChan:
+		return true
+	default:
+	}
+	return false
+}
+
+// open create fifo if not exists, block until a writer opened it.
+func (plugin *PluginConfig) open() (file *os.File, err error) {
+	var (
+		info os.FileInfo
+	)
+	if info, err = os.Stat(plugin.Path); os.IsNotExist(err) {
+		if err = mkfifo(plugin.Path, plugin.mode); err != nil {
+			return
+		}
+	} else if err != nil {
+		return
+	} else if info.Mode()&os.ModeNamedPipe == 0 {
+		err = errors.New(plugin.Path + " exists and is not a named pipe")
+		return
+	}
+	return os.OpenFile(plugin.Path, os.O_RDONLY, 0)
+}
+
+// loopRead read lines, reopen when all writers closed.
+func (plugin *PluginConfig) loopRead(inChan utils.InputChannel) (err error) {
+	var (
+		file *os.File
+		line []byte
+	)
+	defer close(plugin.exitSyncChan)
+
+	for !plugin.stopped() {
+		if file, err = plugin.open(); err != nil {
+			utils.Logger.Errorf("Pipe open %s error %s", plugin.Path, err)
+			select {
+			case <-plugin.exitChan:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		plugin.fileLock.Lock()
+		plugin.file = file
+		plugin.fileLock.Unlock()
+
+		// every writer session has its own codec state.
+		codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+		reader := utils.NewLineReader(file, plugin.decoder)
+		for {
+			line, err = reader.ReadLine()
+			if len(line) > 0 {
+				plugin.emit(codec, line, inChan)
+			}
+			if err != nil {
+				break
+			}
+		}
+		if err != io.EOF && !plugin.stopped() {
+			utils.Logger.Warnf("Pipe read %s error %s", plugin.Path, err)
+		}
+		for _, event := range codec.Flush() {
+			plugin.input(event, inChan)
+		}
+
+		plugin.fileLock.Lock()
+		plugin.file = nil
+		plugin.fileLock.Unlock()
+		file.Close()
+	}
+	err = nil
+	return
+}
+
+// emit decode data and send to pipeline.
+func (plugin *PluginConfig) emit(codec utils.Codec, data []byte, inChan utils.InputChannel) {
+	events, err := utils.DecodeEvents(plugin.decoder, codec, data)
+	if err != nil {
+		utils.Logger.Warnf("Pipe decode error %s", err)
+	}
+	for _, event := range events {
+		plugin.input(event, inChan)
+	}
+}
+
+// input add fields and send to pipeline.
+func (plugin *PluginConfig) input(event utils.LogEvent, inChan utils.InputChannel) {
+	event.Extra["host"] = plugin.hostname
+	event.Extra["path"] = plugin.Path
+	inChan.Input(event)
+}
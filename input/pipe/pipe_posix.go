@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package inputpipe
+
+import (
+	"syscall"
+)
+
+// mkfifo create a named pipe.
+func mkfifo(path string, mode uint32) error {
+	return syscall.Mkfifo(path, mode)
+}
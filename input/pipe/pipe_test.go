@@ -0,0 +1,76 @@
+package inputpipe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Pipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipe")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.fifo")
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"path": path,
+	}, 16)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeNamedPipe)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// writers come and go.
+	for _, msg := range []string{"first", "second"} {
+		w, err := os.OpenFile(path, os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		w.Write([]byte(msg + "\npartial"))
+		w.Close()
+		ev := <-inChan.Events
+		assert.Equal(t, msg, ev.Message)
+		assert.Equal(t, path, ev.Extra["path"])
+		assert.Equal(t, "partial", (<-inChan.Events).Message)
+	}
+	plugin.Stop()
+}
+
+func Test_StopWaiting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipe")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.fifo")
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"path": path,
+	}, 16)
+	// no writer ever opened.
+	done := make(chan int)
+	go func() {
+		plugin.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("stop blocked")
+	}
+	assert.Len(t, inChan.Events, 0)
+
+	// regular file is not a fifo.
+	ioutil.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0644)
+	other, err := InitHandler(&utils.ConfigPart{"path": filepath.Join(dir, "file")})
+	assert.NoError(t, err)
+	_, err = other.open()
+	assert.Error(t, err)
+}
@@ -0,0 +1,10 @@
+package inputpipe
+
+import (
+	"errors"
+)
+
+// mkfifo named pipe not supported on windows.
+func mkfifo(path string, mode uint32) error {
+	return errors.New("pipe input not supported on windows")
+}
@@ -0,0 +1,431 @@
+package inputredis
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "redis"
+)
+
+var (
+	// inputRetryDelay wait before input an event again.
+	inputRetryDelay = time.Second
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.CodecConfig
+	Key        string `json:"key"`         // list, channel, pattern or stream key
+	Host       string `json:"host"`        // default 127.0.0.1:6379
+	DB         int    `json:"db"`          // database of list and stream
+	Password   string `json:"password"`    // auth password
+	DataType   string `json:"data_type"`   // list, channel, pattern_channel or stream, default list
+	Direction  string `json:"direction"`   // list pop from left or right, default left
+	BatchCount int    `json:"batch_count"` // list and stream items per read, default 125
+	Group      string `json:"group"`       // stream consumer group, default logagent
+	Consumer   string `json:"consumer"`    // stream consumer name, default hostname
+	Field      string `json:"field"`       // stream field of encoded event, default event
+	Timeout    int    `json:"timeout"`     // seconds of dial, default 5
+
+	hostname     string
+	codec        utils.Codec
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Key == "" {
+		err = errors.New("redis input key required")
+		return
+	}
+	if config.Host == "" {
+		config.Host = "127.0.0.1:6379"
+	}
+	if config.DataType == "" {
+		config.DataType = "list"
+	}
+	switch config.DataType {
+	case "list", "channel", "pattern_channel", "stream":
+	default:
+		err = errors.New("unknow redis data_type " + config.DataType)
+		return
+	}
+	if config.Direction == "" {
+		config.Direction = "left"
+	}
+	if config.Direction != "left" && config.Direction != "right" {
+		err = errors.New("redis direction must be left or right")
+		return
+	}
+	if config.BatchCount <= 0 {
+		config.BatchCount = 125
+	}
+	if config.Group == "" {
+		config.Group = "logagent"
+	}
+	if config.Consumer == "" {
+		config.Consumer = config.hostname
+	}
+	if config.Field == "" {
+		config.Field = "event"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5
+	}
+	// same as redis output.
+	if config.codec, err = config.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop it.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// listen consume until stopped, reconnect on error.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	for {
+		switch plugin.DataType {
+		case "list":
+			err = plugin.consumeList(inChan)
+		case "channel", "pattern_channel":
+			err = plugin.consumeChannel(inChan)
+		case "stream":
+			err = plugin.consumeStream(inChan)
+		}
+		if plugin.stopped() {
+			return nil
+		}
+		utils.Logger.Warnf("Redis input %s error %s, retry in 1 sec.", plugin.Key, err)
+		select {
+		case <-plugin.exitChan:
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// stopped check exit signal.
+func (plugin *PluginConfig) stopped() bool {
+	select {
+	case <-plugin.exitChan:
+		return true
+	default:
+	}
+	return false
+}
+
+// dial connect redis.
+func (plugin *PluginConfig) dial(readTimeout time.Duration) (redis.Conn, error) {
+	ops := []redis.DialOption{
+		redis.DialConnectTimeout(time.Duration(plugin.Timeout) * time.Second),
+		redis.DialReadTimeout(readTimeout),
+		redis.DialDatabase(plugin.DB),
+	}
+	if plugin.Password != "" {
+		ops = append(ops, redis.DialPassword(plugin.Password))
+	}
+	return redis.Dial("tcp", plugin.Host, ops...)
+}
+
+// emit decode data and send to pipeline.
+func (plugin *PluginConfig) emit(data []byte, inChan utils.InputChannel) (err error) {
+	events, err := utils.DecodeEvents(nil, plugin.codec, data)
+	if err != nil {
+		// bad data will never be decoded, drop it.
+		utils.Logger.Warnf("Redis input decode error %s", err)
+		return nil
+	}
+	for _, ev := range events {
+		if _, ok := ev.Extra["host"]; !ok {
+			ev.Extra["host"] = plugin.hostname
+		}
+		if err = plugin.input(ev, inChan); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// input retry until the event is accepted, error only if stopped.
+func (plugin *PluginConfig) input(ev utils.LogEvent, inChan utils.InputChannel) (err error) {
+	for {
+		if err = inChan.Input(ev); err == nil {
+			return
+		}
+		utils.Logger.Warnf("Redis input %s error %s, retry in %s.", plugin.Key, err, inputRetryDelay)
+		select {
+		case <-plugin.exitChan:
+			return
+		case <-time.After(inputRetryDelay):
+		}
+	}
+}
+
+// consumeList take a batch by LRANGE and LTRIM in a transaction,
+// block by BLPOP or BRPOP if the list is empty. Taken items are no longer
+// in redis, so input is retried until accepted or stopped.
+func (plugin *PluginConfig) consumeList(inChan utils.InputChannel) (err error) {
+	var (
+		items [][]byte
+		n     = plugin.BatchCount
+	)
+	conn, err := plugin.dial(time.Duration(plugin.Timeout+1) * time.Second)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for !plugin.stopped() {
+		if items, err = plugin.takeBatch(conn, n); err != nil {
+			return
+		}
+		if len(items) == 0 {
+			// wait one item at most a second then check exit.
+			cmd := "BLPOP"
+			if plugin.Direction == "right" {
+				cmd = "BRPOP"
+			}
+			var reply [][]byte
+			if reply, err = redis.ByteSlices(conn.Do(cmd, plugin.Key, 1)); err != nil {
+				if err == redis.ErrNil {
+					err = nil
+					continue
+				}
+				return
+			}
+			items = reply[1:]
+		}
+		for _, item := range items {
+			if err = plugin.emit(item, inChan); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// takeBatch at most n items from head or tail.
+func (plugin *PluginConfig) takeBatch(conn redis.Conn, n int) (items [][]byte, err error) {
+	var (
+		replies []interface{}
+	)
+	conn.Send("MULTI")
+	if plugin.Direction == "right" {
+		conn.Send("LRANGE", plugin.Key, -n, -1)
+		conn.Send("LTRIM", plugin.Key, 0, -n-1)
+	} else {
+		conn.Send("LRANGE", plugin.Key, 0, n-1)
+		conn.Send("LTRIM", plugin.Key, n, -1)
+	}
+	if replies, err = redis.Values(conn.Do("EXEC")); err != nil {
+		return
+	}
+	if items, err = redis.ByteSlices(replies[0], nil); err != nil {
+		return
+	}
+	// tail items are popped newest first.
+	if plugin.Direction == "right" {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	return
+}
+
+// consumeChannel SUBSCRIBE or PSUBSCRIBE.
+func (plugin *PluginConfig) consumeChannel(inChan utils.InputChannel) (err error) {
+	conn, err := plugin.dial(0)
+	if err != nil {
+		return
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if plugin.DataType == "pattern_channel" {
+		err = psc.PSubscribe(plugin.Key)
+	} else {
+		err = psc.Subscribe(plugin.Key)
+	}
+	if err != nil {
+		return
+	}
+	// unblock Receive when stopped.
+	done := make(chan int)
+	defer close(done)
+	go func() {
+		select {
+		case <-plugin.exitChan:
+			psc.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			if err = plugin.emit(v.Data, inChan); err != nil {
+				utils.Logger.Warnf("Redis input error %s, message lost", err)
+			}
+		case redis.PMessage:
+			if err = plugin.emit(v.Data, inChan); err != nil {
+				utils.Logger.Warnf("Redis input error %s, message lost", err)
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+// consumeStream XREADGROUP, entries are acked after input.
+// Pending entries of this consumer are read first.
+func (plugin *PluginConfig) consumeStream(inChan utils.InputChannel) (err error) {
+	var (
+		reply   interface{}
+		entries []streamEntry
+		id      = "0"
+	)
+	conn, err := plugin.dial(time.Duration(plugin.Timeout+1) * time.Second)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("XGROUP", "CREATE", plugin.Key, plugin.Group, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return
+	}
+	for !plugin.stopped() {
+		if reply, err = conn.Do("XREADGROUP", "GROUP", plugin.Group, plugin.Consumer,
+			"COUNT", plugin.BatchCount, "BLOCK", 1000, "STREAMS", plugin.Key, id); err != nil {
+			return
+		}
+		if entries, err = parseStreamReply(reply); err != nil {
+			return
+		}
+		// all pending entries handled.
+		if id == "0" && len(entries) == 0 {
+			id = ">"
+			continue
+		}
+		for _, entry := range entries {
+			if err = plugin.emitEntry(entry, inChan); err != nil {
+				return
+			}
+			if _, err = conn.Do("XACK", plugin.Key, plugin.Group, entry.id); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// emitEntry the encoded event field or all fields as event.
+func (plugin *PluginConfig) emitEntry(entry streamEntry, inChan utils.InputChannel) error {
+	if data, ok := entry.fields[plugin.Field]; ok {
+		return plugin.emit([]byte(data), inChan)
+	}
+	// deleted entry still pending.
+	if len(entry.fields) == 0 {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	for k, v := range entry.fields {
+		fields[k] = v
+	}
+	ev := utils.LogEventFromMap(fields)
+	ev.Extra["host"] = plugin.hostname
+	return plugin.input(ev, inChan)
+}
+
+// streamEntry an entry of stream.
+type streamEntry struct {
+	id     string
+	fields map[string]string
+}
+
+// parseStreamReply [[key, [[id, [field, value, ...]], ...]]], nil if timeout.
+func parseStreamReply(reply interface{}) (entries []streamEntry, err error) {
+	var (
+		streams []interface{}
+	)
+	if reply == nil {
+		return
+	}
+	if streams, err = redis.Values(reply, nil); err != nil {
+		return
+	}
+	for _, stream := range streams {
+		var kv, items []interface{}
+		if kv, err = redis.Values(stream, nil); err != nil || len(kv) != 2 {
+			return nil, errors.New("redis stream reply invalid")
+		}
+		if items, err = redis.Values(kv[1], nil); err != nil {
+			return
+		}
+		for _, item := range items {
+			var (
+				pair   []interface{}
+				values []string
+			)
+			if pair, err = redis.Values(item, nil); err != nil || len(pair) != 2 {
+				return nil, errors.New("redis stream entry invalid")
+			}
+			entry := streamEntry{fields: map[string]string{}}
+			if entry.id, err = redis.String(pair[0], nil); err != nil {
+				return
+			}
+			if pair[1] != nil {
+				if values, err = redis.Strings(pair[1], nil); err != nil {
+					return
+				}
+			}
+			for i := 0; i+1 < len(values); i += 2 {
+				entry.fields[values[i]] = values[i+1]
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
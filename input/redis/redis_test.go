@@ -0,0 +1,131 @@
+package inputredis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// failInputChannel fail the first n inputs.
+type failInputChannel struct {
+	*testutil.InputChannel
+	n int
+}
+
+func (c *failInputChannel) Input(ev utils.LogEvent) error {
+	if c.n > 0 {
+		c.n--
+		return errors.New("queue full")
+	}
+	return c.InputChannel.Input(ev)
+}
+
+func Test_EmitRetry(t *testing.T) {
+	inputRetryDelay = 10 * time.Millisecond
+	defer func() {
+		inputRetryDelay = time.Second
+	}()
+	plugin, err := InitHandler(&utils.ConfigPart{"key": "log"})
+	assert.NoError(t, err)
+
+	inChan := &failInputChannel{InputChannel: testutil.NewInputChannel(1), n: 3}
+	assert.NoError(t, plugin.emit([]byte(`{"message":"a"}`), inChan))
+	assert.Equal(t, "a", (<-inChan.Events).Message)
+	assert.Equal(t, 0, inChan.n)
+
+	// give up only when stopped.
+	inChan.n = 1
+	close(plugin.exitChan)
+	assert.Error(t, plugin.emit([]byte(`{"message":"b"}`), inChan))
+	assert.Len(t, inChan.Events, 0)
+}
+
+func Test_ParseStreamReply(t *testing.T) {
+	entries, err := parseStreamReply(nil)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+
+	entries, err = parseStreamReply([]interface{}{
+		[]interface{}{[]byte("log"), []interface{}{
+			[]interface{}{[]byte("1-0"), []interface{}{[]byte("event"), []byte(`{"message":"a"}`)}},
+			[]interface{}{[]byte("2-0"), nil},
+		}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "1-0", entries[0].id)
+	assert.Equal(t, `{"message":"a"}`, entries[0].fields["event"])
+	assert.Len(t, entries[1].fields, 0)
+
+	_, err = parseStreamReply([]interface{}{[]byte("bad")})
+	assert.Error(t, err)
+}
+
+func Test_InitHandler(t *testing.T) {
+	_, err := InitHandler(&utils.ConfigPart{})
+	assert.Error(t, err)
+	_, err = InitHandler(&utils.ConfigPart{"key": "log", "data_type": "set"})
+	assert.Error(t, err)
+}
+
+// Test_List need redis at 127.0.0.1:6379
+func Test_List(t *testing.T) {
+	conn, err := redis.Dial("tcp", "127.0.0.1:6379", redis.DialDatabase(1))
+	if err != nil {
+		t.Skip("redis not available")
+	}
+	defer conn.Close()
+	conn.Do("DEL", "inputredis")
+	for _, msg := range []string{"a", "b", "c"} {
+		conn.Do("RPUSH", "inputredis", `{"message":"`+msg+`"}`)
+	}
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"key":         "inputredis",
+		"db":          1,
+		"batch_count": 2,
+	}, 16)
+	for _, msg := range []string{"a", "b", "c"} {
+		assert.Equal(t, msg, (<-inChan.Events).Message)
+	}
+	conn.Do("RPUSH", "inputredis", `{"message":"d"}`)
+	assert.Equal(t, "d", (<-inChan.Events).Message)
+	plugin.Stop()
+}
+
+// Test_Stream need redis 5 at 127.0.0.1:6379
+func Test_Stream(t *testing.T) {
+	conn, err := redis.Dial("tcp", "127.0.0.1:6379", redis.DialDatabase(1))
+	if err != nil {
+		t.Skip("redis not available")
+	}
+	defer conn.Close()
+	conn.Do("DEL", "inputredis_stream")
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"key":       "inputredis_stream",
+		"db":        1,
+		"data_type": "stream",
+	}, 16)
+	conn.Do("XADD", "inputredis_stream", "*", "event", `{"message":"a"}`)
+	conn.Do("XADD", "inputredis_stream", "*", "message", "b", "level", "info")
+	assert.Equal(t, "a", (<-inChan.Events).Message)
+	ev := <-inChan.Events
+	assert.Equal(t, "b", ev.Message)
+	assert.Equal(t, "info", ev.Extra["level"])
+	plugin.Stop()
+
+	pending, err := redis.Values(conn.Do("XPENDING", "inputredis_stream", "logagent"))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, pending[0])
+}
@@ -1,11 +1,9 @@
 package stdininput
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/tuhuayuan/go-logagent/utils"
 )
@@ -18,11 +16,17 @@ const (
 // PluginConfig Plugin Config struct of this plugin
 type PluginConfig struct {
 	utils.InputPluginConfig
-	Prefix string `json:"prefix"`
+	utils.EncodingConfig
+	utils.CodecConfig
+	Prefix string `json:"prefix"` // prompt printed before every line, none if empty
+	Batch  bool   `json:"batch"`  // drain outputs and exit agent at EOF, prompt never printed
 
 	hostname  string
+	stdin     io.Reader
+	decoder   *utils.Decoder
+	codec     utils.Codec
 	exitChan  chan int
-	inputChan chan string
+	inputChan chan []byte
 }
 
 func init() {
@@ -37,8 +41,9 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 				Type: PluginName,
 			},
 		},
+		stdin:     os.Stdin,
 		exitChan:  make(chan int),
-		inputChan: make(chan string),
+		inputChan: make(chan []byte),
 	}
 	if err = utils.ReflectConfigPart(part, &config); err != nil {
 		return
@@ -46,6 +51,12 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 	if config.hostname, err = os.Hostname(); err != nil {
 		return
 	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	if config.codec, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
 	plugin = &config
 	return
 }
@@ -62,14 +73,23 @@ func (plugin *PluginConfig) Stop() {
 
 func (plugin *PluginConfig) loopRead(inChan utils.InputChannel) (err error) {
 	go func(plugin *PluginConfig) {
-		reader := bufio.NewReader(os.Stdin)
+		var (
+			data []byte
+			err  error
+		)
+		reader := utils.NewLineReader(plugin.stdin, plugin.decoder)
 		for {
-			fmt.Println(plugin.Prefix)
-			data, _, err := reader.ReadLine()
-			if err == io.EOF {
+			if plugin.Prefix != "" && !plugin.Batch {
+				fmt.Println(plugin.Prefix)
+			}
+			data, err = reader.ReadLine()
+			if len(data) > 0 || err == nil {
+				plugin.inputChan <- data
+			}
+			if err != nil {
+				close(plugin.inputChan)
 				return
 			}
-			plugin.inputChan <- string(data)
 		}
 	}(plugin)
 
@@ -77,15 +97,32 @@ func (plugin *PluginConfig) loopRead(inChan utils.InputChannel) (err error) {
 		select {
 		case <-plugin.exitChan:
 			return
-		case input := <-plugin.inputChan:
-			event := utils.LogEvent{
-				Timestamp: time.Now(),
-				Message:   input,
-				Extra: map[string]interface{}{
-					"host": plugin.hostname,
-				},
+		case input, ok := <-plugin.inputChan:
+			var (
+				events []utils.LogEvent
+				derr   error
+			)
+			if ok {
+				if events, derr = utils.DecodeEvents(plugin.decoder, plugin.codec, input); derr != nil {
+					utils.Logger.Warnf("Stdin decode error %s", derr)
+				}
+			} else {
+				// codec buffered lines end at EOF.
+				events = plugin.codec.Flush()
+				plugin.inputChan = nil
+			}
+			for _, event := range events {
+				event.Extra["host"] = plugin.hostname
+				inChan.Input(event)
+			}
+			if !ok && plugin.Batch {
+				utils.Logger.Info("Stdin EOF, finish batch.")
+				if _, derr = plugin.Invoke(func(finisher utils.Finisher) {
+					finisher.Finish()
+				}); derr != nil {
+					utils.Logger.Warnf("Stdin finish batch error %s", derr)
+				}
 			}
-			inChan.Input(event)
 		}
 	}
 }
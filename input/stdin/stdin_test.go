@@ -1,11 +1,14 @@
 package stdininput
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/codegangsta/inject"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
 )
 
 func init() {
@@ -24,3 +27,28 @@ func Test_All(t *testing.T) {
 	assert.NoError(t, err)
 	config.StopInputs()
 }
+
+type testFinisher chan int
+
+func (f testFinisher) Finish() {
+	close(f)
+}
+
+func Test_Batch(t *testing.T) {
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"batch": true,
+	})
+	assert.NoError(t, err)
+	plugin.stdin = strings.NewReader("line1\nline2")
+	finished := make(testFinisher)
+	inj := inject.New()
+	inj.MapTo(finished, (*utils.Finisher)(nil))
+	plugin.SetInjector(inj)
+
+	inChan := testutil.NewInputChannel(4)
+	go plugin.loopRead(inChan)
+	<-finished
+	assert.Equal(t, "line1", (<-inChan.Events).Message)
+	assert.Equal(t, "line2", (<-inChan.Events).Message)
+	plugin.Stop()
+}
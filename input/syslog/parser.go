@@ -0,0 +1,237 @@
+package inputsyslog
+
+// 解析RFC3164和RFC5424格式的syslog消息
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+var (
+	facilityLabels = []string{
+		"kernel", "user-level", "mail", "daemon", "security/authorization",
+		"syslogd", "line printer", "network news", "uucp", "clock",
+		"security/authorization", "ftp", "ntp", "log audit", "log alert",
+		"clock", "local0", "local1", "local2", "local3", "local4", "local5",
+		"local6", "local7",
+	}
+	severityLabels = []string{
+		"emergency", "alert", "critical", "error", "warning", "notice",
+		"informational", "debug",
+	}
+
+	errNoPriority = errors.New("syslog priority missing")
+	errTimestamp  = errors.New("syslog timestamp invalid")
+)
+
+// parse syslog message, fields are put into event.Extra.
+func parse(data []byte, ev *utils.LogEvent, loc *time.Location) (err error) {
+	var (
+		pri  int
+		rest []byte
+	)
+	data = bytes.TrimRight(data, "\r\n\x00")
+	if pri, rest, err = parsePriority(data); err != nil {
+		return
+	}
+	// RFC5424 has version after PRI
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		err = parse5424(rest, ev)
+	} else {
+		err = parse3164(rest, ev, loc)
+	}
+	if err != nil {
+		return
+	}
+	ev.Extra["priority"] = pri
+	ev.Extra["facility"] = pri / 8
+	ev.Extra["severity"] = pri % 8
+	if pri/8 < len(facilityLabels) {
+		ev.Extra["facility_label"] = facilityLabels[pri/8]
+	}
+	ev.Extra["severity_label"] = severityLabels[pri%8]
+	return
+}
+
+// parsePriority parse "<PRI>".
+func parsePriority(data []byte) (pri int, rest []byte, err error) {
+	if len(data) < 3 || data[0] != '<' {
+		err = errNoPriority
+		return
+	}
+	end := bytes.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		err = errNoPriority
+		return
+	}
+	if pri, err = strconv.Atoi(string(data[1:end])); err != nil || pri > 191 {
+		err = errNoPriority
+		return
+	}
+	rest = data[end+1:]
+	return
+}
+
+// parse5424 VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD [MSG]
+func parse5424(data []byte, ev *utils.LogEvent) (err error) {
+	var (
+		fields []string
+		rest   = string(data)
+		sd     map[string]interface{}
+	)
+	for i := 0; i < 6; i++ {
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			err = errors.New("syslog header incomplete")
+			return
+		}
+		fields = append(fields, rest[:sp])
+		rest = rest[sp+1:]
+	}
+	ev.Extra["version"], _ = strconv.Atoi(fields[0])
+	if fields[1] != "-" {
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+			err = errTimestamp
+			return
+		}
+		ev.Timestamp = t
+	}
+	for i, name := range []string{"hostname", "appname", "procid", "msgid"} {
+		if fields[i+2] != "-" {
+			ev.Extra[name] = fields[i+2]
+		}
+	}
+	if sd, rest, err = parseStructuredData(rest); err != nil {
+		return
+	}
+	if len(sd) > 0 {
+		ev.Extra["structured_data"] = sd
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	ev.Message = strings.TrimPrefix(rest, "\ufeff")
+	return
+}
+
+// parseStructuredData parse "-" or [id param="value" ...]...
+func parseStructuredData(data string) (sd map[string]interface{}, rest string, err error) {
+	sd = map[string]interface{}{}
+	if strings.HasPrefix(data, "-") {
+		rest = data[1:]
+		return
+	}
+	for strings.HasPrefix(data, "[") {
+		var (
+			i      = 1
+			id     string
+			params = map[string]interface{}{}
+		)
+		for i < len(data) && data[i] != ' ' && data[i] != ']' {
+			i++
+		}
+		id = data[1:i]
+		for i < len(data) && data[i] == ' ' {
+			// param="value"
+			eq := strings.IndexByte(data[i:], '=')
+			if eq < 0 || i+eq+1 >= len(data) || data[i+eq+1] != '"' {
+				err = errors.New("syslog structured data invalid")
+				return
+			}
+			name := data[i+1 : i+eq]
+			i += eq + 2
+			value := []byte{}
+			for ; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' && i+1 < len(data) && strings.IndexByte(`"\]`, data[i+1]) >= 0 {
+					i++
+				}
+				value = append(value, data[i])
+			}
+			if i >= len(data) {
+				err = errors.New("syslog structured data unterminated")
+				return
+			}
+			params[name] = string(value)
+			i++
+		}
+		if i >= len(data) || data[i] != ']' {
+			err = errors.New("syslog structured data unterminated")
+			return
+		}
+		sd[id] = params
+		data = data[i+1:]
+	}
+	rest = data
+	return
+}
+
+// parse3164 TIMESTAMP HOSTNAME TAG[PID]: MSG
+func parse3164(data []byte, ev *utils.LogEvent, loc *time.Location) (err error) {
+	var (
+		rest = string(data)
+		t    time.Time
+	)
+	// Mmm dd hh:mm:ss, the day is space padded.
+	if len(rest) >= 16 && rest[15] == ' ' {
+		if t, err = time.ParseInLocation(time.Stamp, rest[:15], loc); err == nil {
+			now := time.Now().In(loc)
+			t = t.AddDate(now.Year(), 0, 0)
+			// message of last year at new year's eve.
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			rest = rest[16:]
+		}
+	} else {
+		err = errTimestamp
+	}
+	// some senders use RFC3339 instead.
+	if err != nil {
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			return
+		}
+		if t, err = time.Parse(time.RFC3339Nano, rest[:sp]); err != nil {
+			err = errTimestamp
+			return
+		}
+		rest = rest[sp+1:]
+	}
+	ev.Timestamp = t
+
+	// hostname is missing if the first word is already the tag.
+	sp := strings.IndexByte(rest, ' ')
+	if sp > 0 && !isTag(rest[:sp]) {
+		ev.Extra["hostname"] = rest[:sp]
+		rest = rest[sp+1:]
+	}
+
+	// TAG is a short word, may be followed by [PID].
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_./", r))
+	})
+	if end > 0 && end <= 48 && (rest[end] == '[' || rest[end] == ':') {
+		ev.Extra["appname"] = rest[:end]
+		rest = rest[end:]
+		if rest[0] == '[' {
+			if rb := strings.IndexByte(rest, ']'); rb > 0 {
+				ev.Extra["procid"] = rest[1:rb]
+				rest = rest[rb+1:]
+			}
+		}
+		rest = strings.TrimPrefix(rest, ":")
+		rest = strings.TrimPrefix(rest, " ")
+	}
+	ev.Message = rest
+	return
+}
+
+// isTag check word looks like "tag:" or "tag[pid]:".
+func isTag(word string) bool {
+	return strings.HasSuffix(word, ":") || strings.Contains(word, "[")
+}
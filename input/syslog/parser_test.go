@@ -0,0 +1,82 @@
+package inputsyslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func newTestEvent() *utils.LogEvent {
+	return &utils.LogEvent{
+		Extra: map[string]interface{}{},
+	}
+}
+
+func Test_Parse3164(t *testing.T) {
+	ev := newTestEvent()
+	err := parse([]byte("<34>Oct  1 22:14:15 mymachine su[123]: 'su root' failed for lonvick\n"), ev, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, 34, ev.Extra["priority"])
+	assert.Equal(t, 4, ev.Extra["facility"])
+	assert.Equal(t, 2, ev.Extra["severity"])
+	assert.Equal(t, "critical", ev.Extra["severity_label"])
+	assert.Equal(t, "mymachine", ev.Extra["hostname"])
+	assert.Equal(t, "su", ev.Extra["appname"])
+	assert.Equal(t, "123", ev.Extra["procid"])
+	assert.Equal(t, "'su root' failed for lonvick", ev.Message)
+	assert.Equal(t, time.October, ev.Timestamp.Month())
+	assert.Equal(t, 22, ev.Timestamp.Hour())
+
+	// without hostname
+	ev = newTestEvent()
+	err = parse([]byte("<13>Feb  5 17:32:18 kernel: eth0 link up"), ev, time.UTC)
+	assert.NoError(t, err)
+	assert.Nil(t, ev.Extra["hostname"])
+	assert.Equal(t, "kernel", ev.Extra["appname"])
+	assert.Equal(t, "eth0 link up", ev.Message)
+
+	// RFC3339 timestamp
+	ev = newTestEvent()
+	err = parse([]byte("<13>2017-03-05T10:00:00.123+08:00 web01 nginx: GET /"), ev, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "web01", ev.Extra["hostname"])
+	assert.Equal(t, "GET /", ev.Message)
+	assert.Equal(t, 2, ev.Timestamp.UTC().Hour())
+}
+
+func Test_Parse5424(t *testing.T) {
+	ev := newTestEvent()
+	err := parse([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Appl\"ication"][origin ip="192.0.2.1"] `+"\ufeff"+`An application event`), ev, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ev.Extra["version"])
+	assert.Equal(t, 20, ev.Extra["facility"])
+	assert.Equal(t, "local4", ev.Extra["facility_label"])
+	assert.Equal(t, "mymachine.example.com", ev.Extra["hostname"])
+	assert.Equal(t, "evntslog", ev.Extra["appname"])
+	assert.Nil(t, ev.Extra["procid"])
+	assert.Equal(t, "ID47", ev.Extra["msgid"])
+	sd := ev.Extra["structured_data"].(map[string]interface{})
+	assert.Equal(t, "Appl\"ication", sd["exampleSDID@32473"].(map[string]interface{})["eventSource"])
+	assert.Equal(t, "192.0.2.1", sd["origin"].(map[string]interface{})["ip"])
+	assert.Equal(t, "An application event", ev.Message)
+	assert.Equal(t, 2003, ev.Timestamp.Year())
+
+	ev = newTestEvent()
+	err = parse([]byte(`<13>1 - - - - - -`), ev, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "", ev.Message)
+}
+
+func Test_ParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		"no priority",
+		"<999>Oct  1 22:14:15 host app: msg",
+		"<13>1 2003-10-11T22:14:15.003Z host app - - [unterminated",
+		"<13>yesterday host app: msg",
+	} {
+		assert.Error(t, parse([]byte(data), newTestEvent(), time.UTC), data)
+	}
+}
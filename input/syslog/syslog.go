@@ -0,0 +1,254 @@
+package inputsyslog
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "syslog"
+	// TagParseFailure tag of message not in syslog format.
+	TagParseFailure = "_syslogparsefailure"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.EncodingConfig
+	Host           string   `json:"host"`             // listen address of udp and tcp
+	Protocols      []string `json:"protocols"`        // udp, tcp, default both
+	Framing        string   `json:"framing"`          // tcp framing, default auto
+	MaxMessageSize int      `json:"max_message_size"` // bytes of one message at most
+	Timezone       string   `json:"timezone"`         // zone of RFC3164 timestamp
+
+	hostname     string
+	decoder      *utils.Decoder
+	location     *time.Location
+	closers      []func() error
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgExit       *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgExit:       &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:514"
+	}
+	if len(config.Protocols) == 0 {
+		config.Protocols = []string{"udp", "tcp"}
+	}
+	if config.Framing == "" {
+		config.Framing = "auto"
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 64 * 1024
+	}
+	if _, err = utils.NewFrameReader(nil, config.Framing, config.MaxMessageSize); err != nil {
+		return
+	}
+	if config.location, err = time.LoadLocation(config.Timezone); err != nil {
+		return
+	}
+	if config.Timezone == "" {
+		config.location = time.Local
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop it.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// listen start udp and tcp listeners, block until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	for _, proto := range plugin.Protocols {
+		switch proto {
+		case "udp":
+			var conn net.PacketConn
+			if conn, err = net.ListenPacket("udp", plugin.Host); err != nil {
+				break
+			}
+			plugin.closers = append(plugin.closers, conn.Close)
+			plugin.wgExit.Add(1)
+			go plugin.loopUDP(conn, inChan)
+		case "tcp":
+			var listener net.Listener
+			if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+				break
+			}
+			plugin.closers = append(plugin.closers, listener.Close)
+			plugin.wgExit.Add(1)
+			go plugin.loopTCP(listener, inChan)
+		default:
+			utils.Logger.Warnf("Syslog unknow protocol %s", proto)
+		}
+		if err != nil {
+			utils.Logger.Errorf("Syslog listen %s %s error %s", proto, plugin.Host, err)
+			break
+		}
+	}
+	if err == nil {
+		utils.Logger.Infof("Syslog start listen at %s", plugin.Host)
+		<-plugin.exitChan
+	}
+
+	for _, closer := range plugin.closers {
+		closer()
+	}
+	// unblock reading, buffered frames are still handled.
+	plugin.connsLock.Lock()
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgExit.Wait()
+	return
+}
+
+// loopUDP a message per datagram.
+func (plugin *PluginConfig) loopUDP(conn net.PacketConn, inChan utils.InputChannel) {
+	defer plugin.wgExit.Done()
+
+	data := make([]byte, plugin.MaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(data)
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			utils.Logger.Warnf("Syslog read udp error %s", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		inChan.Input(plugin.newEvent(data[:n], addr))
+	}
+}
+
+// loopTCP accept connections until listener closed.
+func (plugin *PluginConfig) loopTCP(listener net.Listener, inChan utils.InputChannel) {
+	defer plugin.wgExit.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			utils.Logger.Warnf("Syslog accept error %s", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !plugin.addConn(conn) {
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	plugin.conns[conn] = 1
+	plugin.wgExit.Add(1)
+	return true
+}
+
+// handleConn a message per frame.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	defer func() {
+		plugin.connsLock.Lock()
+		delete(plugin.conns, conn)
+		plugin.connsLock.Unlock()
+		conn.Close()
+		plugin.wgExit.Done()
+	}()
+
+	reader, _ := utils.NewFrameReader(conn, plugin.Framing, plugin.MaxMessageSize)
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil && err != utils.ErrFrameTruncated {
+			return
+		}
+		if len(frame) > 0 {
+			inChan.Input(plugin.newEvent(frame, conn.RemoteAddr()))
+		}
+	}
+}
+
+// newEvent parse message, tag it if not syslog format.
+func (plugin *PluginConfig) newEvent(data []byte, addr net.Addr) utils.LogEvent {
+	ev := utils.LogEvent{
+		Timestamp: time.Now(),
+		Extra:     map[string]interface{}{},
+	}
+	text := plugin.decoder.Decode(data, &ev)
+	if err := parse([]byte(text), &ev, plugin.location); err != nil {
+		utils.Logger.Debugf("Syslog parse error %s", err)
+		ev.Timestamp = time.Now()
+		ev.Message = text
+		ev.Extra = map[string]interface{}{}
+		ev.AddTag(TagParseFailure)
+	}
+	ev.Extra["host"] = plugin.hostname
+	if host, port, err := net.SplitHostPort(addr.String()); err == nil {
+		ev.Extra["clientIP"] = host
+		ev.Extra["clientPort"], _ = strconv.Atoi(port)
+	}
+	return ev
+}
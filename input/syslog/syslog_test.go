@@ -0,0 +1,41 @@
+package inputsyslog
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Listen(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10514",
+	}, 4)
+
+	udp, err := net.Dial("udp", "127.0.0.1:10514")
+	assert.NoError(t, err)
+	defer udp.Close()
+	udp.Write([]byte("<13>Feb  5 17:32:18 host app: udp message"))
+	ev := <-inChan.Events
+	assert.Equal(t, "udp message", ev.Message)
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+
+	tcp, err := net.Dial("tcp", "127.0.0.1:10514")
+	assert.NoError(t, err)
+	defer tcp.Close()
+	tcp.Write([]byte("30 <13>1 - host app - - - framed\nnot syslog\n"))
+	ev = <-inChan.Events
+	assert.Equal(t, "framed", ev.Message)
+	ev = <-inChan.Events
+	assert.Equal(t, "not syslog", ev.Message)
+	assert.Equal(t, []string{TagParseFailure}, ev.Tags)
+
+	plugin.Stop()
+}
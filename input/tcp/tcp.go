@@ -0,0 +1,238 @@
+package inputtcp
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "tcp"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.EncodingConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Host           string `json:"host"`             // listen address
+	Framing        string `json:"framing"`          // newline, octet_counted or auto
+	MaxMessageSize int    `json:"max_message_size"` // bytes of one message at most
+	MaxConnections int    `json:"max_connections"`  // 0 no limit
+
+	hostname     string
+	decoder      *utils.Decoder
+	tlsConfig    *tls.Config
+	listener     net.Listener
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgConns      *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgConns:      &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Host == "" {
+		config.Host = "0.0.0.0:5140"
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	// check codec and framing config early.
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	if _, err = utils.NewFrameReader(nil, config.Framing, config.MaxMessageSize); err != nil {
+		return
+	}
+	if config.tlsConfig, err = config.ServerTLS(); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop accept, drain lines already received then close connections.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	plugin.connsLock.Lock()
+	if plugin.listener != nil {
+		plugin.listener.Close()
+	}
+	// unblock reading, buffered frames are still handled.
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgConns.Wait()
+	<-plugin.exitSyncChan
+}
+
+// listen accept connections until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	var (
+		conn     net.Conn
+		listener net.Listener
+	)
+	defer close(plugin.exitSyncChan)
+
+	if listener, err = net.Listen("tcp", plugin.Host); err != nil {
+		utils.Logger.Errorf("Tcp listen addr error %s", err)
+		return
+	}
+	if plugin.tlsConfig != nil {
+		listener = tls.NewListener(listener, plugin.tlsConfig)
+	}
+	plugin.connsLock.Lock()
+	select {
+	case <-plugin.exitChan:
+		plugin.connsLock.Unlock()
+		listener.Close()
+		return
+	default:
+		plugin.listener = listener
+	}
+	plugin.connsLock.Unlock()
+	utils.Logger.Infof("Tcp start listen at %s", plugin.Host)
+
+	for {
+		if conn, err = listener.Accept(); err != nil {
+			select {
+			case <-plugin.exitChan:
+				err = nil
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				utils.Logger.Warnf("Tcp accept error %s", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			utils.Logger.Errorf("Tcp accept error %s", err)
+			return
+		}
+		if !plugin.addConn(conn) {
+			utils.Logger.Warnf("Tcp max connections reached, reject %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if limit reached or stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	if plugin.MaxConnections > 0 && len(plugin.conns) >= plugin.MaxConnections {
+		return false
+	}
+	plugin.conns[conn] = 1
+	plugin.wgConns.Add(1)
+	return true
+}
+
+// removeConn close and forget the connection.
+func (plugin *PluginConfig) removeConn(conn net.Conn) {
+	plugin.connsLock.Lock()
+	delete(plugin.conns, conn)
+	plugin.connsLock.Unlock()
+	conn.Close()
+	plugin.wgConns.Done()
+}
+
+// handleConn read frames from a connection and emit logevent.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	var (
+		frame  []byte
+		events []utils.LogEvent
+		fields = map[string]interface{}{
+			"host": plugin.hostname,
+		}
+		err error
+	)
+	defer plugin.removeConn(conn)
+
+	if host, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		fields["clientIP"] = host
+		fields["clientPort"], _ = strconv.Atoi(port)
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err = tlsConn.Handshake(); err != nil {
+			utils.Logger.Warnf("Tcp tls handshake with %s error %s", conn.RemoteAddr(), err)
+			return
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			fields["clientCN"] = certs[0].Subject.CommonName
+		}
+	}
+
+	// every connection decode with its own codec state.
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	reader, _ := utils.NewFrameReader(conn, plugin.Framing, plugin.MaxMessageSize)
+	emit := func(events []utils.LogEvent) {
+		for _, event := range events {
+			for k, v := range fields {
+				event.Extra[k] = v
+			}
+			inChan.Input(event)
+		}
+	}
+	defer func() {
+		emit(codec.Flush())
+	}()
+
+	for {
+		if frame, err = reader.ReadFrame(); err != nil {
+			if err != utils.ErrFrameTruncated {
+				return
+			}
+			utils.Logger.Warnf("Tcp message from %s truncated", conn.RemoteAddr())
+		}
+		if events, err = utils.DecodeEvents(plugin.decoder, codec, frame); err != nil {
+			utils.Logger.Warnf("Tcp decode error %s", err)
+		}
+		emit(events)
+	}
+}
@@ -0,0 +1,77 @@
+package inputtcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Newline(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host": "127.0.0.1:10030",
+	}, 16)
+	conn, err := net.Dial("tcp", "127.0.0.1:10030")
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("Log message 消息\r\nsecond"))
+	assert.NoError(t, err)
+
+	ev := <-inChan.Events
+	assert.Equal(t, "Log message 消息", ev.Message)
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+	assert.NotZero(t, ev.Extra["clientPort"])
+
+	// last line without newline is sent when connection closed.
+	conn.Close()
+	ev = <-inChan.Events
+	assert.Equal(t, "second", ev.Message)
+	plugin.Stop()
+}
+
+func Test_OctetCounted(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":             "127.0.0.1:10031",
+		"framing":          "octet_counted",
+		"max_message_size": 4,
+	}, 16)
+	conn, err := net.Dial("tcp", "127.0.0.1:10031")
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte("3 a\nb8 12345678"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a\nb", (<-inChan.Events).Message)
+	assert.Equal(t, "1234", (<-inChan.Events).Message)
+	conn.Close()
+	plugin.Stop()
+}
+
+func Test_MaxConnections(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":            "127.0.0.1:10032",
+		"max_connections": 1,
+	}, 16)
+	conn1, err := net.Dial("tcp", "127.0.0.1:10032")
+	assert.NoError(t, err)
+	defer conn1.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	conn2, err := net.Dial("tcp", "127.0.0.1:10032")
+	assert.NoError(t, err)
+	defer conn2.Close()
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn2.Read(make([]byte, 1))
+	assert.Error(t, err)
+
+	// stop drain the lines already sent.
+	conn1.Write([]byte("line1\nline2\n"))
+	time.Sleep(100 * time.Millisecond)
+	plugin.Stop()
+	assert.Len(t, inChan.Events, 2)
+}
@@ -4,6 +4,9 @@ import (
 	"encoding/binary"
 	"net"
 	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tuhuayuan/go-logagent/utils"
@@ -12,17 +15,31 @@ import (
 const (
 	// PluginName name of this plugin
 	PluginName = "udp"
+	// TagTruncated tag of datagram larger than max_size.
+	TagTruncated = "_udptruncated"
+	// MaxDatagramSize max payload of udp.
+	MaxDatagramSize = 64 * 1024
 )
 
 // PluginConfig Plugin Config struct of this plugin
 type PluginConfig struct {
 	utils.InputPluginConfig
-	Host  string `json:"host"`
-	Port  string `json:"port"`
-	Magic uint16 `json:"magic"`
+	utils.EncodingConfig
+	utils.CodecConfig
+	Host          string  `json:"host"`
+	Port          string  `json:"port"`
+	Magic         *uint16 `json:"magic"`          // check and strip 2 bytes prefix if set
+	MaxSize       int     `json:"max_size"`       // max datagram size, default 64KiB
+	Workers       int     `json:"workers"`        // reader goroutines, default cpu number
+	ReadBuffer    int     `json:"read_buffer"`    // socket receive buffer bytes, 0 system default
+	StatsInterval int     `json:"stats_interval"` // seconds between drop reports, default 60
 
 	hostname   string
-	dataChan   chan string
+	decoder    *utils.Decoder
+	received   uint64
+	truncated  uint64
+	rejected   uint64
+	wgWorkers  *sync.WaitGroup
 	exitSignal chan bool
 	exitNotify chan bool
 }
@@ -40,7 +57,7 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 			},
 		},
 
-		dataChan:   make(chan string, 1),
+		wgWorkers:  &sync.WaitGroup{},
 		exitSignal: make(chan bool, 1),
 		exitNotify: make(chan bool, 1),
 	}
@@ -53,6 +70,21 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 	if config.Host == "" {
 		config.Host = "0.0.0.0"
 	}
+	if config.MaxSize <= 0 || config.MaxSize > MaxDatagramSize {
+		config.MaxSize = MaxDatagramSize
+	}
+	if config.Workers <= 0 {
+		config.Workers = runtime.NumCPU()
+	}
+	if config.StatsInterval <= 0 {
+		config.StatsInterval = 60
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
 	plugin = &config
 	return
 }
@@ -68,52 +100,123 @@ func (plugin *PluginConfig) Stop() {
 	<-plugin.exitNotify
 }
 
+// Counters number of received, truncated and rejected datagrams.
+func (plugin *PluginConfig) Counters() (received, truncated, rejected uint64) {
+	return atomic.LoadUint64(&plugin.received),
+		atomic.LoadUint64(&plugin.truncated),
+		atomic.LoadUint64(&plugin.rejected)
+}
+
 // listen read data from udp emit logevent.
 func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
-	addr, err := net.ResolveUDPAddr("udp", plugin.Host+":"+plugin.Port)
+	var (
+		lastTruncated uint64
+		lastRejected  uint64
+	)
+	defer func() {
+		plugin.exitNotify <- true
+	}()
 
+	addr, err := net.ResolveUDPAddr("udp", plugin.Host+":"+plugin.Port)
 	if err != nil {
 		utils.Logger.Errorf("Udp plugin addr error %s", err)
+		<-plugin.exitSignal
 		return
 	}
 
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
 		utils.Logger.Errorf("Udp listen addr error %s", err)
+		<-plugin.exitSignal
 		return
 	}
+	if plugin.ReadBuffer > 0 {
+		if err = conn.SetReadBuffer(plugin.ReadBuffer); err != nil {
+			utils.Logger.Warnf("Udp set read buffer error %s", err)
+		}
+	}
 
-	defer conn.Close()
+	for i := 0; i < plugin.Workers; i++ {
+		plugin.wgWorkers.Add(1)
+		go plugin.loopRead(conn, inChan)
+	}
 
+	ticker := time.NewTicker(time.Duration(plugin.StatsInterval) * time.Second)
+	defer ticker.Stop()
 	for {
-		go plugin.handlerData(conn)
-
 		select {
-		case data := <-plugin.dataChan:
-			inChan.Input(utils.LogEvent{
-				Timestamp: time.Now(),
-				Message:   data,
-				Extra: map[string]interface{}{
-					"host": plugin.hostname,
-				},
-			})
-
+		case <-ticker.C:
+			_, truncated, rejected := plugin.Counters()
+			if truncated != lastTruncated || rejected != lastRejected {
+				utils.Logger.Warnf("Udp %s truncated %d rejected %d datagrams",
+					addr, truncated-lastTruncated, rejected-lastRejected)
+				lastTruncated, lastRejected = truncated, rejected
+			}
 		case <-plugin.exitSignal:
-			plugin.exitNotify <- true
+			conn.Close()
+			plugin.wgWorkers.Wait()
+			received, truncated, rejected := plugin.Counters()
+			utils.Logger.Infof("Udp %s received %d truncated %d rejected %d datagrams",
+				addr, received, truncated, rejected)
 			return
 		}
 	}
 }
 
-// handler udp data
-func (plugin *PluginConfig) handlerData(conn *net.UDPConn) {
-	data := make([]byte, 1024)
-	n, _, err := conn.ReadFromUDP(data)
-	if err != nil {
-		utils.Logger.Warnf("Read data from udp error %s", err)
-		return
-	}
-	if n > 2 && plugin.Magic == binary.BigEndian.Uint16(data[0:2]) {
-		plugin.dataChan <- string(data[2:n])
+// loopRead read datagrams until the connection closed.
+func (plugin *PluginConfig) loopRead(conn *net.UDPConn, inChan utils.InputChannel) {
+	var (
+		n      int
+		raddr  *net.UDPAddr
+		err    error
+		events []utils.LogEvent
+		// one more byte to detect truncation.
+		data = make([]byte, plugin.MaxSize+1)
+	)
+	defer plugin.wgWorkers.Done()
+
+	// codec state is kept per reader.
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	for {
+		if n, raddr, err = conn.ReadFromUDP(data); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				utils.Logger.Warnf("Read data from udp error %s", err)
+				continue
+			}
+			return
+		}
+		atomic.AddUint64(&plugin.received, 1)
+
+		payload := data[:n]
+		truncated := n > plugin.MaxSize
+		if truncated {
+			payload = data[:plugin.MaxSize]
+			atomic.AddUint64(&plugin.truncated, 1)
+		}
+		if plugin.Magic != nil {
+			if n < 2 || *plugin.Magic != binary.BigEndian.Uint16(payload[0:2]) {
+				atomic.AddUint64(&plugin.rejected, 1)
+				continue
+			}
+			payload = payload[2:]
+		}
+		if len(payload) == 0 {
+			continue
+		}
+
+		if events, err = utils.DecodeEvents(plugin.decoder, codec, payload); err != nil {
+			atomic.AddUint64(&plugin.rejected, 1)
+			utils.Logger.Debugf("Udp decode error %s", err)
+			continue
+		}
+		for _, event := range events {
+			event.Extra["host"] = plugin.hostname
+			event.Extra["clientIP"] = raddr.IP.String()
+			event.Extra["clientPort"] = raddr.Port
+			if truncated {
+				event.AddTag(TagTruncated)
+			}
+			inChan.Input(event)
+		}
 	}
 }
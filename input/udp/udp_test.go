@@ -10,6 +10,7 @@ import (
 
 	"github.com/tuhuayuan/go-logagent/queue"
 	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
 )
 
 func init() {
@@ -43,3 +44,57 @@ func Test_Udp(t *testing.T) {
 	})
 
 }
+
+func Test_Truncated(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":     "127.0.0.1",
+		"port":     "10021",
+		"max_size": 8,
+		"workers":  2,
+	}, 16)
+	conn, err := net.Dial("udp", "127.0.0.1:10021")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	conn.Write([]byte("12345678"))
+	ev := <-inChan.Events
+	assert.Equal(t, "12345678", ev.Message)
+	assert.Equal(t, "127.0.0.1", ev.Extra["clientIP"])
+	assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, ev.Extra["clientPort"])
+	assert.NotContains(t, ev.Tags, TagTruncated)
+
+	conn.Write([]byte("1234567890"))
+	ev = <-inChan.Events
+	assert.Equal(t, "12345678", ev.Message)
+	assert.Contains(t, ev.Tags, TagTruncated)
+
+	plugin.Stop()
+	received, truncated, rejected := plugin.(*PluginConfig).Counters()
+	assert.Equal(t, uint64(2), received)
+	assert.Equal(t, uint64(1), truncated)
+	assert.Equal(t, uint64(0), rejected)
+}
+
+func Test_MagicRejected(t *testing.T) {
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"host":        "127.0.0.1",
+		"port":        "10022",
+		"magic":       16,
+		"read_buffer": 1 << 20,
+	}, 16)
+	conn, err := net.Dial("udp", "127.0.0.1:10022")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	data := []byte("  bad")
+	binary.BigEndian.PutUint16(data, 17)
+	conn.Write(data)
+	conn.Write([]byte("x"))
+	binary.BigEndian.PutUint16(data, 16)
+	conn.Write(data)
+
+	assert.Equal(t, "bad", (<-inChan.Events).Message)
+	plugin.Stop()
+	_, _, rejected := plugin.(*PluginConfig).Counters()
+	assert.Equal(t, uint64(2), rejected)
+}
@@ -0,0 +1,293 @@
+package inputunix
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin
+	PluginName = "unix"
+)
+
+// PluginConfig Plugin Config struct of this plugin
+type PluginConfig struct {
+	utils.InputPluginConfig
+	utils.EncodingConfig
+	utils.CodecConfig
+	Path           string `json:"path"`             // socket file
+	SocketType     string `json:"socket_type"`      // stream or datagram, default stream
+	Permissions    string `json:"permissions"`      // octal mode of socket file, ex: "0666"
+	MaxMessageSize int    `json:"max_message_size"` // bytes of a datagram at most, default 64KiB
+
+	hostname     string
+	decoder      *utils.Decoder
+	mode         os.FileMode
+	closer       io.Closer
+	conns        map[net.Conn]int
+	connsLock    *sync.Mutex
+	wgExit       *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	config := PluginConfig{
+		InputPluginConfig: utils.InputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		conns:        map[net.Conn]int{},
+		connsLock:    &sync.Mutex{},
+		wgExit:       &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &config); err != nil {
+		return
+	}
+	if config.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if config.Path == "" {
+		err = errors.New("unix socket path required")
+		return
+	}
+	if config.SocketType == "" {
+		config.SocketType = "stream"
+	}
+	if config.SocketType != "stream" && config.SocketType != "datagram" {
+		err = errors.New("unix socket_type must be stream or datagram")
+		return
+	}
+	if config.Permissions != "" {
+		var mode uint64
+		if mode, err = strconv.ParseUint(config.Permissions, 8, 32); err != nil {
+			return
+		}
+		config.mode = os.FileMode(mode)
+	}
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = 64 * 1024
+	}
+	if config.decoder, err = config.NewDecoder(); err != nil {
+		return
+	}
+	if _, err = config.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	plugin = &config
+	return
+}
+
+// Start start it.
+func (plugin *PluginConfig) Start() {
+	plugin.Invoke(plugin.listen)
+}
+
+// Stop stop it, socket file is removed.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+}
+
+// removeStale remove socket file nobody listen on.
+func (plugin *PluginConfig) removeStale() error {
+	info, err := os.Lstat(plugin.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(plugin.Path + " exists and is not a socket")
+	}
+	network := "unix"
+	if plugin.SocketType == "datagram" {
+		network = "unixgram"
+	}
+	if conn, err := net.DialTimeout(network, plugin.Path, time.Second); err == nil {
+		conn.Close()
+		return errors.New(plugin.Path + " is in use")
+	}
+	return os.Remove(plugin.Path)
+}
+
+// listen create socket, block until stopped.
+func (plugin *PluginConfig) listen(inChan utils.InputChannel) (err error) {
+	defer close(plugin.exitSyncChan)
+
+	if err = plugin.removeStale(); err != nil {
+		utils.Logger.Errorf("Unix listen %s error %s", plugin.Path, err)
+		return
+	}
+	if plugin.SocketType == "datagram" {
+		var conn *net.UnixConn
+		if conn, err = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: plugin.Path, Net: "unixgram"}); err == nil {
+			plugin.closer = conn
+			plugin.wgExit.Add(1)
+			go plugin.loopDatagram(conn, inChan)
+		}
+	} else {
+		var listener *net.UnixListener
+		if listener, err = net.ListenUnix("unix", &net.UnixAddr{Name: plugin.Path, Net: "unix"}); err == nil {
+			plugin.closer = listener
+			plugin.wgExit.Add(1)
+			go plugin.loopAccept(listener, inChan)
+		}
+	}
+	if err != nil {
+		utils.Logger.Errorf("Unix listen %s error %s", plugin.Path, err)
+		return
+	}
+	if plugin.mode != 0 {
+		if err = os.Chmod(plugin.Path, plugin.mode); err != nil {
+			utils.Logger.Warnf("Unix chmod %s error %s", plugin.Path, err)
+		}
+	}
+	utils.Logger.Infof("Unix start listen at %s", plugin.Path)
+	<-plugin.exitChan
+
+	plugin.closer.Close()
+	// unblock reading, buffered lines are still handled.
+	plugin.connsLock.Lock()
+	for conn := range plugin.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	plugin.connsLock.Unlock()
+	plugin.wgExit.Wait()
+	os.Remove(plugin.Path)
+	return
+}
+
+// loopDatagram a message per datagram.
+func (plugin *PluginConfig) loopDatagram(conn *net.UnixConn, inChan utils.InputChannel) {
+	defer plugin.wgExit.Done()
+
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	data := make([]byte, plugin.MaxMessageSize)
+	for {
+		n, err := conn.Read(data)
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			utils.Logger.Warnf("Unix read %s error %s", plugin.Path, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		plugin.emit(codec, trimNewline(data[:n]), inChan)
+	}
+}
+
+// loopAccept accept connections until listener closed.
+func (plugin *PluginConfig) loopAccept(listener *net.UnixListener, inChan utils.InputChannel) {
+	defer plugin.wgExit.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-plugin.exitChan:
+				return
+			default:
+			}
+			utils.Logger.Warnf("Unix accept %s error %s", plugin.Path, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if !plugin.addConn(conn) {
+			conn.Close()
+			continue
+		}
+		go plugin.handleConn(conn, inChan)
+	}
+}
+
+// addConn track the connection, false if stopping.
+func (plugin *PluginConfig) addConn(conn net.Conn) bool {
+	plugin.connsLock.Lock()
+	defer plugin.connsLock.Unlock()
+
+	select {
+	case <-plugin.exitChan:
+		return false
+	default:
+	}
+	plugin.conns[conn] = 1
+	plugin.wgExit.Add(1)
+	return true
+}
+
+// handleConn a message per line.
+func (plugin *PluginConfig) handleConn(conn net.Conn, inChan utils.InputChannel) {
+	defer func() {
+		plugin.connsLock.Lock()
+		delete(plugin.conns, conn)
+		plugin.connsLock.Unlock()
+		conn.Close()
+		plugin.wgExit.Done()
+	}()
+
+	codec, _ := plugin.NewCodec(utils.ConfigPart{"type": "plain"})
+	reader := utils.NewLineReader(conn, plugin.decoder)
+	for {
+		line, err := reader.ReadLine()
+		if len(line) > 0 {
+			plugin.emit(codec, line, inChan)
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, event := range codec.Flush() {
+		plugin.input(event, inChan)
+	}
+}
+
+// emit decode data and send to pipeline.
+func (plugin *PluginConfig) emit(codec utils.Codec, data []byte, inChan utils.InputChannel) {
+	events, err := utils.DecodeEvents(plugin.decoder, codec, data)
+	if err != nil {
+		utils.Logger.Warnf("Unix decode error %s", err)
+	}
+	for _, event := range events {
+		plugin.input(event, inChan)
+	}
+}
+
+// input add fields and send to pipeline.
+func (plugin *PluginConfig) input(event utils.LogEvent, inChan utils.InputChannel) {
+	event.Extra["host"] = plugin.hostname
+	event.Extra["path"] = plugin.Path
+	inChan.Input(event)
+}
+
+// trimNewline remove trailing newline and null of a datagram.
+func trimNewline(data []byte) []byte {
+	for len(data) > 0 {
+		switch data[len(data)-1] {
+		case '\n', '\r', 0:
+			data = data[:len(data)-1]
+			continue
+		}
+		break
+	}
+	return data
+}
@@ -0,0 +1,98 @@
+package inputunix
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+	"github.com/tuhuayuan/go-logagent/utils/testutil"
+)
+
+func init() {
+	utils.RegistInputHandler(PluginName, InitHandler)
+}
+
+func Test_Stream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"path":        path,
+		"permissions": "0666",
+	}, 16)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	conn.Write([]byte("line1\nline2"))
+	conn.Close()
+	ev := <-inChan.Events
+	assert.Equal(t, "line1", ev.Message)
+	assert.Equal(t, path, ev.Extra["path"])
+	assert.Equal(t, "line2", (<-inChan.Events).Message)
+
+	plugin.Stop()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_Datagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"path":        path,
+		"socket_type": "datagram",
+	}, 16)
+	conn, err := net.Dial("unixgram", path)
+	assert.NoError(t, err)
+	conn.Write([]byte("message1\n"))
+	conn.Write([]byte("message2\x00"))
+	conn.Close()
+	assert.Equal(t, "message1", (<-inChan.Events).Message)
+	assert.Equal(t, "message2", (<-inChan.Events).Message)
+	plugin.Stop()
+}
+
+func Test_Stale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+
+	// socket file left by a crashed process.
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	assert.NoError(t, err)
+	listener.SetUnlinkOnClose(false)
+	listener.Close()
+
+	plugin, inChan := testutil.StartInput(t, PluginName, utils.ConfigPart{
+		"path": path,
+	}, 16)
+	conn, err := net.Dial("unix", path)
+	assert.NoError(t, err)
+	conn.Write([]byte("hello\n"))
+	assert.Equal(t, "hello", (<-inChan.Events).Message)
+	conn.Close()
+
+	// socket in use is never removed.
+	other, err := InitHandler(&utils.ConfigPart{"path": path})
+	assert.NoError(t, err)
+	assert.Error(t, other.removeStale())
+	plugin.Stop()
+
+	// not a socket.
+	ioutil.WriteFile(path, []byte("data"), 0644)
+	assert.Error(t, other.removeStale())
+}
@@ -2,6 +2,14 @@ package outputelastic
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/tuhuayuan/go-logagent/utils"
 
@@ -11,22 +19,75 @@ import (
 const (
 	// PluginName name of this plugin
 	PluginName = "elastic"
+
+	// bulkRetries bulk requests of a batch at most.
+	bulkRetries = 3
+)
+
+var (
+	// bulkRetryDelay wait before documents to be retried are sent again.
+	bulkRetryDelay = time.Second
 )
 
 // PluginConfig plugin struct
 type PluginConfig struct {
 	utils.OutputPluginConfig
 
-	Hosts    []string `json:"hosts"`
-	Username string   `json:"username"`
-	Password string   `json:"password"`
+	Hosts           []string `json:"hosts"`
+	Username        string   `json:"username"`
+	Password        string   `json:"password"`
+	Index           string   `json:"index"`             // index format, default logagent-${@date}
+	DocumentType    string   `json:"document_type"`     // type format, default doc
+	DocumentID      string   `json:"document_id"`       // id format, elastic generate id if empty
+	Pipeline        string   `json:"pipeline"`          // ingest pipeline format
+	Source          string   `json:"source"`            // event: the whole event, message: json message, default event
+	BatchSize       int      `json:"batch_size"`        // documents per bulk request, default 500
+	BatchBytes      int      `json:"batch_bytes"`       // bytes of documents per bulk request, default 5MiB
+	FlushInterval   int      `json:"flush_interval"`    // seconds queued events wait for a full batch at most, default 1
+	DeadLetterIndex string   `json:"dead_letter_index"` // index of rejected documents, dropped if empty
+	Timeout         int      `json:"timeout"`           // seconds of a bulk request, default 60
+
+	TemplateFile         string `json:"template_file"`          // index template json file installed at startup
+	TemplateName         string `json:"template_name"`          // default logagent
+	TemplateOverwrite    bool   `json:"template_overwrite"`     // update template if exists
+	RolloverAlias        string `json:"rollover_alias"`         // write to the alias instead of index if set
+	RolloverInitialIndex string `json:"rollover_initial_index"` // first index of alias, default <alias>-000001
+	RolloverMaxAge       string `json:"rollover_max_age"`       // ex: 1d, default 1d if no condition set
+	RolloverMaxDocs      int64  `json:"rollover_max_docs"`      // documents of an index at most
+	RolloverMaxSize      string `json:"rollover_max_size"`      // ex: 50gb, elastic 6.1 or later
+	RolloverInterval     int    `json:"rollover_interval"`      // seconds between condition checks, default 300
 
 	conn         *elastic.Client
-	bufChan      chan utils.LogEvent
+	template     string
+	ready        bool
+	connLock     *sync.Mutex // conn and ready are shared by bulk and rollover
+	indexed      uint64
+	retried      uint64
+	rejected     uint64
 	exitChan     chan int
 	exitSyncChan chan int
 }
 
+// bulkItem a document waiting for bulk.
+type bulkItem struct {
+	index      string
+	docType    string
+	id         string
+	pipeline   string
+	doc        json.RawMessage
+	timestamp  time.Time
+	deadIndex  string
+	deadLetter bool // a rejected document, never routed again
+}
+
+// rejectedItem a document elastic refused.
+type rejectedItem struct {
+	*bulkItem
+	status int
+	kind   string
+	reason string
+}
+
 func init() {
 	utils.RegistOutputHandler(PluginName, InitHandler)
 }
@@ -39,7 +100,7 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 				Type: PluginName,
 			},
 		},
-		bufChan:      make(chan utils.LogEvent),
+		connLock:     &sync.Mutex{},
 		exitChan:     make(chan int),
 		exitSyncChan: make(chan int),
 	}
@@ -49,45 +110,306 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 		utils.Logger.Errorf("Elastic plugin config error %q", err)
 		return
 	}
-	// setup elastic client
-
-	config.conn, err = elastic.NewClient(
-		elastic.SetURL(config.Hosts...),
-		elastic.SetBasicAuth(config.Username, config.Password),
-	)
-	if err != nil {
+	if config.Index == "" {
+		config.Index = "logagent-${@date}"
+	}
+	if config.DocumentType == "" {
+		config.DocumentType = "doc"
+	}
+	if config.Source == "" {
+		config.Source = "event"
+	}
+	if config.Source != "event" && config.Source != "message" {
+		err = errors.New("elastic source must be event or message")
+		return
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.BatchBytes <= 0 {
+		config.BatchBytes = 5 * 1024 * 1024
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 1
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 60
+	}
+	if err = config.initManage(); err != nil {
+		return
+	}
+	// setup elastic client, retry at bulk if cluster is down now.
+	if err = config.connect(); err != nil {
 		utils.Logger.Warnf("Elasic cluster health check error %q", err)
+		err = nil
+	} else if !config.ready {
+		if err = config.setup(); err != nil {
+			utils.Logger.Warnf("Elastic: setup template and alias error %q, retry at bulk", err)
+			err = nil
+		} else {
+			config.ready = true
+		}
 	}
 	plugin = &config
+	go plugin.loopRollover()
+	return
+}
+
+// format the setting with event, fallback if any field absent.
+func format(ev utils.LogEvent, setting string, fallback string) string {
+	if setting == "" {
+		return ""
+	}
+	if value := ev.Format(setting); !strings.Contains(value, "${") {
+		return value
+	}
+	return ev.Format(fallback)
+}
+
+// connect create elastic client.
+func (plugin *PluginConfig) connect() (err error) {
+	plugin.conn, err = elastic.NewClient(
+		elastic.SetURL(plugin.Hosts...),
+		elastic.SetBasicAuth(plugin.Username, plugin.Password),
+	)
 	return
 }
 
-// Process send log event.
+// Process index an event.
 func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	return plugin.ProcessBatch([]utils.LogEvent{ev})
+}
+
+// Batch events of a batch and time they wait at most.
+func (plugin *PluginConfig) Batch() (int, time.Duration) {
+	return plugin.BatchSize, time.Duration(plugin.FlushInterval) * time.Second
+}
+
+// ProcessBatch index events by bulk requests of batch_bytes at most. Documents
+// elastic asks to retry are sent again a few times, an error is returned if
+// some are still not indexed, then the whole batch is sent again. Rejected
+// documents are routed to dead letter index.
+func (plugin *PluginConfig) ProcessBatch(events []utils.LogEvent) (err error) {
 	var (
-		docIndex string
-		docType  string
-		docID    string
+		items    []*bulkItem
+		rejected []rejectedItem
 	)
+	for _, ev := range events {
+		item, ierr := plugin.item(ev)
+		if ierr != nil {
+			// unsupported value never be marshaled, drop it.
+			utils.Logger.Warnf("Elastic: marshal event error %q", ierr)
+			continue
+		}
+		if !json.Valid(item.doc) {
+			rejected = append(rejected, rejectedItem{bulkItem: item, status: http.StatusBadRequest,
+				kind: "invalid_json", reason: "message is not a json document"})
+			continue
+		}
+		items = append(items, item)
+	}
+	items = append(items, plugin.reject(rejected)...)
 
-	docIndex = ev.Format(ev.Extra["@elastic_docindex"].(string))
-	docType = ev.Format(ev.Extra["@elastic_doctype"].(string))
-	docID = ev.Format(ev.Extra["@elastic_docid"].(string))
-	_, err = plugin.conn.Index().
-		Index(docIndex).
-		Type(docType).
-		Id(docID).
-		BodyString(ev.Message).
-		Do(context.Background())
-	if err != nil {
-		utils.Logger.Warnf("Elastic: output index error %q", err)
+	for attempt := 1; len(items) > 0; attempt++ {
+		var retry []*bulkItem
+		for len(items) > 0 {
+			n := plugin.chunk(items)
+			r, rejected, berr := plugin.bulk(items[:n])
+			if berr != nil {
+				return berr
+			}
+			retry = append(retry, r...)
+			// dead letters are sent in this round.
+			items = append(items[n:], plugin.reject(rejected)...)
+		}
+		if len(retry) == 0 {
+			break
+		}
+		if attempt >= bulkRetries {
+			return fmt.Errorf("elastic %d documents not indexed after %d bulks", len(retry), attempt)
+		}
+		time.Sleep(bulkRetryDelay)
+		items = retry
 	}
 	return
 }
 
-// Stop stop loop.
+// Stop stop rollover and client.
 func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
 	if plugin.conn != nil {
 		plugin.conn.Stop()
 	}
 }
+
+// Counters documents indexed, retried and rejected.
+func (plugin *PluginConfig) Counters() (indexed, retried, rejected uint64) {
+	return atomic.LoadUint64(&plugin.indexed),
+		atomic.LoadUint64(&plugin.retried),
+		atomic.LoadUint64(&plugin.rejected)
+}
+
+// loopRollover check rollover conditions at interval.
+func (plugin *PluginConfig) loopRollover() {
+	defer close(plugin.exitSyncChan)
+
+	rollover := time.NewTicker(time.Duration(plugin.RolloverInterval) * time.Second)
+	defer rollover.Stop()
+	for {
+		select {
+		case <-plugin.exitChan:
+			return
+		case <-rollover.C:
+			if plugin.RolloverAlias != "" {
+				plugin.rollover()
+			}
+		}
+	}
+}
+
+// item the document of event.
+func (plugin *PluginConfig) item(ev utils.LogEvent) (item *bulkItem, err error) {
+	item = &bulkItem{
+		index:     plugin.index(ev),
+		docType:   format(ev, plugin.DocumentType, "doc"),
+		id:        format(ev, plugin.DocumentID, ""),
+		pipeline:  format(ev, plugin.Pipeline, ""),
+		timestamp: ev.Timestamp,
+	}
+	if plugin.Source == "message" {
+		item.doc = json.RawMessage(ev.Message)
+	} else if item.doc, err = json.Marshal(ev.GetMap()); err != nil {
+		return
+	}
+	if plugin.DeadLetterIndex != "" {
+		item.deadIndex = ev.Format(plugin.DeadLetterIndex)
+	}
+	return
+}
+
+// chunk count of leading items in a bulk request, one at least.
+func (plugin *PluginConfig) chunk(items []*bulkItem) (n int) {
+	var (
+		size int
+	)
+	for n < len(items) {
+		if size += len(items[n].doc); n > 0 && size > plugin.BatchBytes {
+			break
+		}
+		n++
+	}
+	return
+}
+
+// bulk send items by a bulk request, documents to be retried and rejected
+// ones are returned.
+func (plugin *PluginConfig) bulk(items []*bulkItem) (retry []*bulkItem, rejected []rejectedItem, err error) {
+	var (
+		resp    *elastic.BulkResponse
+		indexed int
+	)
+	plugin.connLock.Lock()
+	defer plugin.connLock.Unlock()
+	if plugin.conn == nil {
+		if err = plugin.connect(); err != nil {
+			return
+		}
+	}
+	// writing to alias before it exists creates a plain index.
+	if !plugin.ready {
+		if err = plugin.setup(); err != nil {
+			return
+		}
+		plugin.ready = true
+	}
+	bulk := plugin.conn.Bulk()
+	for _, item := range items {
+		req := elastic.NewBulkIndexRequest().
+			Index(item.index).
+			Type(item.docType).
+			Id(item.id).
+			Doc(item.doc)
+		if item.pipeline != "" {
+			req.Pipeline(item.pipeline)
+		}
+		bulk.Add(req)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(plugin.Timeout)*time.Second)
+	defer cancel()
+	if resp, err = bulk.Do(ctx); err != nil {
+		return
+	}
+	if retry, rejected, indexed, err = splitResponse(items, resp); err != nil {
+		return
+	}
+	atomic.AddUint64(&plugin.indexed, uint64(indexed))
+	atomic.AddUint64(&plugin.retried, uint64(len(retry)))
+	utils.Logger.Debugf("Elastic: bulk %d documents, indexed %d, retry %d, rejected %d",
+		len(items), indexed, len(retry), len(rejected))
+	return
+}
+
+// reject log rejected documents, dead letters of them are returned if index configed.
+func (plugin *PluginConfig) reject(rejected []rejectedItem) (deadLetters []*bulkItem) {
+	for _, item := range rejected {
+		utils.Logger.Warnf("Elastic: document index %s id %q rejected, status %d %s: %s",
+			item.index, item.id, item.status, item.kind, item.reason)
+		atomic.AddUint64(&plugin.rejected, 1)
+		if item.deadLetter || item.deadIndex == "" {
+			continue
+		}
+		doc, err := json.Marshal(map[string]interface{}{
+			"@timestamp":   item.timestamp.UTC().Format(time.RFC3339Nano),
+			"index":        item.index,
+			"type":         item.docType,
+			"id":           item.id,
+			"status":       item.status,
+			"error_type":   item.kind,
+			"error_reason": item.reason,
+			"message":      string(item.doc),
+		})
+		if err != nil {
+			continue
+		}
+		deadLetters = append(deadLetters, &bulkItem{
+			index:      item.deadIndex,
+			docType:    item.docType,
+			doc:        doc,
+			timestamp:  item.timestamp,
+			deadLetter: true,
+		})
+	}
+	return
+}
+
+// splitResponse classify documents by the items of bulk response,
+// too many requests and unavailable ones are to be retried.
+func splitResponse(items []*bulkItem, resp *elastic.BulkResponse) (
+	retry []*bulkItem, rejected []rejectedItem, indexed int, err error) {
+	if resp == nil || len(resp.Items) != len(items) {
+		err = errors.New("elastic bulk response items mismatch")
+		return
+	}
+	for i, result := range resp.Items {
+		for _, r := range result {
+			switch {
+			case r == nil:
+				indexed++
+			case r.Status == http.StatusTooManyRequests || r.Status == http.StatusServiceUnavailable:
+				retry = append(retry, items[i])
+			case r.Status >= 200 && r.Status < 300:
+				indexed++
+			default:
+				item := rejectedItem{bulkItem: items[i], status: r.Status}
+				if r.Error != nil {
+					item.kind, item.reason = r.Error.Type, r.Error.Reason
+				} else {
+					item.reason = fmt.Sprintf("status %d", r.Status)
+				}
+				rejected = append(rejected, item)
+			}
+		}
+	}
+	return
+}
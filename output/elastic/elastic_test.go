@@ -2,12 +2,16 @@ package outputelastic
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tuhuayuan/go-logagent/utils"
+
+	elastic "gopkg.in/olivere/elastic.v5"
 )
 
 func init() {
@@ -27,7 +31,10 @@ func Test_Run(t *testing.T) {
         "output": [
             {
                 "type": "elastic",
-                "hosts": ["http://127.0.0.1:9200"]
+                "hosts": ["http://127.0.0.1:9200"],
+                "index": "${@date}.logagent.test",
+                "document_type": "test",
+                "source": "message"
             }
         ]
     }
@@ -46,11 +53,7 @@ func Test_Run(t *testing.T) {
 	ev := utils.LogEvent{
 		Timestamp: time.Now(),
 		Message:   string(raw),
-		Extra: map[string]interface{}{
-			"@elastic_docindex": "${@date}.logagent.test",
-			"@elastic_doctype":  "test",
-			"@elastic_docid":    "",
-		},
+		Extra:     map[string]interface{}{},
 	}
 
 	_, err = plugin.Invoke(func(outChan utils.OutputChannel) {
@@ -60,3 +63,146 @@ func Test_Run(t *testing.T) {
 	plugin.StopOutputs()
 	assert.NoError(t, err)
 }
+
+func Test_SplitResponse(t *testing.T) {
+	items := []*bulkItem{
+		{index: "a", doc: json.RawMessage(`{}`)},
+		{index: "b", doc: json.RawMessage(`{}`)},
+		{index: "c", doc: json.RawMessage(`{"n": "x"}`), deadIndex: "dead"},
+		{index: "d", doc: json.RawMessage(`{}`)},
+	}
+	resp := &elastic.BulkResponse{
+		Errors: true,
+		Items: []map[string]*elastic.BulkResponseItem{
+			{"index": {Status: 201}},
+			{"index": {Status: 429, Error: &elastic.ErrorDetails{Type: "es_rejected_execution_exception"}}},
+			{"index": {Status: 400, Error: &elastic.ErrorDetails{Type: "mapper_parsing_exception", Reason: "failed to parse [n]"}}},
+			{"index": {Status: 503}},
+		},
+	}
+	retry, rejected, indexed, err := splitResponse(items, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, indexed)
+	assert.Equal(t, []*bulkItem{items[1], items[3]}, retry)
+	assert.Len(t, rejected, 1)
+	assert.Equal(t, "c", rejected[0].index)
+	assert.Equal(t, "mapper_parsing_exception", rejected[0].kind)
+
+	_, _, _, err = splitResponse(items, &elastic.BulkResponse{})
+	assert.Error(t, err)
+
+	// rejected document goes to dead letter index once.
+	plugin, err := InitHandler(&utils.ConfigPart{"hosts": []string{"http://127.0.0.1:9200"}})
+	assert.NoError(t, err)
+	deadLetters := plugin.reject(rejected)
+	assert.Len(t, deadLetters, 1)
+	dead := deadLetters[0]
+	assert.Equal(t, "dead", dead.index)
+	assert.True(t, dead.deadLetter)
+	doc := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(dead.doc, &doc))
+	assert.Equal(t, "c", doc["index"])
+	assert.Equal(t, `{"n": "x"}`, doc["message"])
+	assert.Equal(t, "failed to parse [n]", doc["error_reason"])
+
+	assert.Len(t, plugin.reject([]rejectedItem{{bulkItem: dead, status: 400}}), 0)
+	_, _, n := plugin.Counters()
+	assert.Equal(t, uint64(2), n)
+	plugin.Stop()
+}
+
+func Test_Document(t *testing.T) {
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"hosts":       []string{"http://127.0.0.1:9200"},
+		"index":       "logs-${app}-${+2006.01.02}",
+		"document_id": "${request_id}",
+		"pipeline":    "${pipeline}",
+	})
+	assert.NoError(t, err)
+	ts := time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC)
+	item, err := plugin.item(utils.LogEvent{
+		Timestamp: ts,
+		Message:   "plain text",
+		Tags:      []string{"web"},
+		Extra:     map[string]interface{}{"app": "shop", "request_id": "r1", "pipeline": "geoip"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-shop-"+time.Now().Format("2006.01.02"), item.index)
+	assert.Equal(t, "doc", item.docType)
+	assert.Equal(t, "r1", item.id)
+	assert.Equal(t, "geoip", item.pipeline)
+	doc := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(item.doc, &doc))
+	assert.Equal(t, "plain text", doc["message"])
+	assert.Equal(t, "shop", doc["app"])
+	assert.Equal(t, []interface{}{"web"}, doc["tags"])
+	assert.Equal(t, "2017-05-01T08:00:00", doc["@timestamp"])
+
+	// fields absent.
+	item, err = plugin.item(utils.LogEvent{
+		Timestamp: ts,
+		Message:   "no fields",
+		Extra:     map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "logagent-2017-05-01", item.index)
+	assert.Equal(t, "", item.id)
+	assert.Equal(t, "", item.pipeline)
+
+	_, err = InitHandler(&utils.ConfigPart{"source": "body"})
+	assert.Error(t, err)
+	plugin.Stop()
+}
+
+func Test_Chunk(t *testing.T) {
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"hosts":       []string{"http://127.0.0.1:9200"},
+		"batch_bytes": 10,
+	})
+	assert.NoError(t, err)
+	items := []*bulkItem{
+		{doc: json.RawMessage(`{"a":1}`)},
+		{doc: json.RawMessage(`{}`)},
+		{doc: json.RawMessage(`{"b":2}`)},
+		{doc: json.RawMessage(`{"a document larger than batch bytes":1}`)},
+	}
+	assert.Equal(t, 2, plugin.chunk(items))
+	assert.Equal(t, 1, plugin.chunk(items[2:]))
+	// a large document is sent alone.
+	assert.Equal(t, 1, plugin.chunk(items[3:]))
+	plugin.Stop()
+}
+
+func Test_Manage(t *testing.T) {
+	file, err := ioutil.TempFile("", "template")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(`{"template": "logs-*", "settings": {"number_of_shards": 1}}`)
+	file.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"hosts":          []string{"http://127.0.0.1:9200"},
+		"template_file":  file.Name(),
+		"rollover_alias": "logs",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "logagent", plugin.TemplateName)
+	assert.Equal(t, "logs-000001", plugin.RolloverInitialIndex)
+	assert.Equal(t, "1d", plugin.RolloverMaxAge)
+	assert.Equal(t, "logs", plugin.index(utils.LogEvent{Extra: map[string]interface{}{}}))
+	plugin.Stop()
+
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"rollover_alias":    "logs",
+		"rollover_max_docs": 1000000,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "", plugin.RolloverMaxAge)
+	plugin.Stop()
+
+	ioutil.WriteFile(file.Name(), []byte("{oops"), 0644)
+	_, err = InitHandler(&utils.ConfigPart{"template_file": file.Name()})
+	assert.Error(t, err)
+	_, err = InitHandler(&utils.ConfigPart{"template_file": file.Name() + ".missing"})
+	assert.Error(t, err)
+}
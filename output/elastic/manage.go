@@ -0,0 +1,118 @@
+package outputelastic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+// initManage check template and rollover options.
+func (plugin *PluginConfig) initManage() (err error) {
+	var (
+		data []byte
+	)
+	if plugin.TemplateFile != "" {
+		if data, err = ioutil.ReadFile(plugin.TemplateFile); err != nil {
+			return
+		}
+		if !json.Valid(data) {
+			return errors.New("elastic template file " + plugin.TemplateFile + " is not json")
+		}
+		plugin.template = string(data)
+	}
+	if plugin.TemplateName == "" {
+		plugin.TemplateName = "logagent"
+	}
+	if plugin.RolloverAlias == "" {
+		plugin.ready = plugin.template == ""
+	}
+	if plugin.RolloverInitialIndex == "" {
+		plugin.RolloverInitialIndex = plugin.RolloverAlias + "-000001"
+	}
+	if plugin.RolloverMaxAge == "" && plugin.RolloverMaxDocs <= 0 && plugin.RolloverMaxSize == "" {
+		plugin.RolloverMaxAge = "1d"
+	}
+	if plugin.RolloverInterval <= 0 {
+		plugin.RolloverInterval = 300
+	}
+	return
+}
+
+// index the document written to.
+func (plugin *PluginConfig) index(ev utils.LogEvent) string {
+	if plugin.RolloverAlias != "" {
+		return plugin.RolloverAlias
+	}
+	return format(ev, plugin.Index, "logagent-${@date}")
+}
+
+// setup install template, create the first index of rollover alias, lock held.
+func (plugin *PluginConfig) setup() (err error) {
+	var (
+		exists bool
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(plugin.Timeout)*time.Second)
+	defer cancel()
+
+	if plugin.template != "" {
+		if !plugin.TemplateOverwrite {
+			if exists, err = plugin.conn.IndexTemplateExists(plugin.TemplateName).Do(ctx); err != nil {
+				return
+			}
+		}
+		if !exists {
+			if _, err = plugin.conn.IndexPutTemplate(plugin.TemplateName).BodyString(plugin.template).Do(ctx); err != nil {
+				return
+			}
+			utils.Logger.Infof("Elastic: index template %s installed", plugin.TemplateName)
+		}
+	}
+	if plugin.RolloverAlias != "" {
+		if exists, err = plugin.conn.IndexExists(plugin.RolloverAlias).Do(ctx); err != nil || exists {
+			return
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"aliases": map[string]interface{}{plugin.RolloverAlias: map[string]interface{}{}},
+		})
+		if _, err = plugin.conn.CreateIndex(plugin.RolloverInitialIndex).BodyString(string(body)).Do(ctx); err != nil {
+			return
+		}
+		utils.Logger.Infof("Elastic: index %s created with alias %s", plugin.RolloverInitialIndex, plugin.RolloverAlias)
+	}
+	return
+}
+
+// rollover the alias if any condition met.
+func (plugin *PluginConfig) rollover() {
+	plugin.connLock.Lock()
+	defer plugin.connLock.Unlock()
+	if plugin.conn == nil || !plugin.ready {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(plugin.Timeout)*time.Second)
+	defer cancel()
+	service := plugin.conn.RolloverIndex(plugin.RolloverAlias)
+	if plugin.RolloverMaxAge != "" {
+		service.AddMaxIndexAgeCondition(plugin.RolloverMaxAge)
+	}
+	if plugin.RolloverMaxDocs > 0 {
+		service.AddMaxIndexDocsCondition(plugin.RolloverMaxDocs)
+	}
+	if plugin.RolloverMaxSize != "" {
+		service.AddCondition("max_size", plugin.RolloverMaxSize)
+	}
+	resp, err := service.Do(ctx)
+	if err != nil {
+		utils.Logger.Warnf("Elastic: rollover %s error %q", plugin.RolloverAlias, err)
+		return
+	}
+	if resp.RolledOver {
+		utils.Logger.Infof("Elastic: alias %s rolled over from %s to %s",
+			plugin.RolloverAlias, resp.OldIndex, resp.NewIndex)
+	}
+}
@@ -0,0 +1,382 @@
+package outputfile
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "file"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	Path           string `json:"path"`            // path format, ex: /archive/${host}/${+2006-01-02}/app.log
+	FallbackPath   string `json:"fallback_path"`   // file of events whose path leaves the static directory of path, default <static directory>/fallback.log
+	FileMode       string `json:"file_mode"`       // octal mode of created file, default "0644"
+	RotateSize     int64  `json:"rotate_size"`     // rotate when file is larger, 0 is never
+	RotateInterval int    `json:"rotate_interval"` // seconds a file is written before rotated, 0 is never
+	Compress       bool   `json:"compress"`        // gzip rotated files, idle closed files are rotated too
+	IdleTimeout    int    `json:"idle_timeout"`    // seconds to close a file not written, default 300
+	MaxOpen        int    `json:"max_open"`        // open files at most, least recently written is closed, default 128
+	Fsync          string `json:"fsync"`           // none, always or interval, default none
+	SyncInterval   int    `json:"sync_interval"`   // seconds between fsync of interval, default 1
+
+	codec        utils.Codec
+	mode         os.FileMode
+	root         string // static directory of path
+	files        map[string]*openFile
+	filesLock    *sync.Mutex
+	wgCompress   *sync.WaitGroup
+	exitChan     chan int
+	exitSyncChan chan int
+}
+
+// openFile a file being written.
+type openFile struct {
+	*os.File
+	size      int64
+	opened    time.Time
+	lastWrite time.Time
+	lastSync  time.Time
+	dirty     bool
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	var (
+		mode uint64
+	)
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		files:        map[string]*openFile{},
+		filesLock:    &sync.Mutex{},
+		wgCompress:   &sync.WaitGroup{},
+		exitChan:     make(chan int),
+		exitSyncChan: make(chan int),
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Path == "" {
+		err = errors.New("file output path required")
+		return
+	}
+	if conf.FileMode == "" {
+		conf.FileMode = "0644"
+	}
+	if mode, err = strconv.ParseUint(conf.FileMode, 8, 32); err != nil {
+		return
+	}
+	conf.mode = os.FileMode(mode)
+	// directory before the first field, field values must not leave it.
+	if i := strings.Index(conf.Path, "${"); i >= 0 {
+		conf.root = filepath.Dir(conf.Path[:i] + "x")
+	} else {
+		conf.root = filepath.Dir(conf.Path)
+	}
+	if conf.FallbackPath == "" {
+		conf.FallbackPath = filepath.Join(conf.root, "fallback.log")
+	}
+	conf.FallbackPath = filepath.Clean(conf.FallbackPath)
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = 300
+	}
+	if conf.MaxOpen <= 0 {
+		conf.MaxOpen = 128
+	}
+	if conf.Fsync == "" {
+		conf.Fsync = "none"
+	}
+	switch conf.Fsync {
+	case "none", "always", "interval":
+	default:
+		err = errors.New("file fsync must be none, always or interval")
+		return
+	}
+	if conf.SyncInterval <= 0 {
+		conf.SyncInterval = 1
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json_lines"}); err != nil {
+		return
+	}
+	plugin = &conf
+	go plugin.loopCheck()
+	return
+}
+
+// Process append event to the file of formatted path.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		data []byte
+		f    *openFile
+		n    int
+	)
+	if data, err = plugin.codec.Encode(ev); err != nil {
+		utils.Logger.Warnf("File output encode error %q", err)
+		return nil
+	}
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	path := filepath.Clean(ev.Format(plugin.Path))
+	if !plugin.contained(path) {
+		utils.Logger.Warnf("File output path %q leaves %q, write to %s", path, plugin.root, plugin.FallbackPath)
+		path = plugin.FallbackPath
+	}
+
+	plugin.filesLock.Lock()
+	defer plugin.filesLock.Unlock()
+
+	now := time.Now()
+	if f, err = plugin.open(path, now); err != nil {
+		return
+	}
+	if plugin.shouldRotate(f, int64(len(data)), now) {
+		plugin.rotate(path, f)
+		if f, err = plugin.open(path, now); err != nil {
+			return
+		}
+	}
+	n, err = f.Write(data)
+	f.size += int64(n)
+	f.lastWrite, f.dirty = now, true
+	if err != nil {
+		return
+	}
+	if plugin.Fsync == "always" {
+		err = plugin.sync(f, now)
+	}
+	return
+}
+
+// contained check path is a file under the static directory.
+func (plugin *PluginConfig) contained(path string) bool {
+	rel, err := filepath.Rel(plugin.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return true
+}
+
+// Stop close all files, wait compression.
+func (plugin *PluginConfig) Stop() {
+	close(plugin.exitChan)
+	<-plugin.exitSyncChan
+
+	plugin.filesLock.Lock()
+	for path, f := range plugin.files {
+		plugin.close(path, f)
+	}
+	plugin.filesLock.Unlock()
+	plugin.wgCompress.Wait()
+}
+
+// loopCheck rotate, close idle and fsync files every second.
+func (plugin *PluginConfig) loopCheck() {
+	defer close(plugin.exitSyncChan)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-plugin.exitChan:
+			return
+		case now := <-ticker.C:
+			plugin.check(now)
+		}
+	}
+}
+
+// check files at now.
+func (plugin *PluginConfig) check(now time.Time) {
+	plugin.filesLock.Lock()
+	defer plugin.filesLock.Unlock()
+
+	for path, f := range plugin.files {
+		switch {
+		case now.Sub(f.lastWrite) >= time.Duration(plugin.IdleTimeout)*time.Second:
+			if plugin.Compress {
+				plugin.rotate(path, f)
+			} else {
+				plugin.close(path, f)
+			}
+		case plugin.shouldRotate(f, 0, now):
+			plugin.rotate(path, f)
+		case plugin.Fsync == "interval" && f.dirty &&
+			now.Sub(f.lastSync) >= time.Duration(plugin.SyncInterval)*time.Second:
+			if err := plugin.sync(f, now); err != nil {
+				utils.Logger.Warnf("File output sync %s error %q", path, err)
+			}
+		}
+	}
+}
+
+// open the file of path, least recently written file is closed if too many, lock held.
+func (plugin *PluginConfig) open(path string, now time.Time) (f *openFile, err error) {
+	var (
+		file *os.File
+		info os.FileInfo
+	)
+	if f, ok := plugin.files[path]; ok {
+		return f, nil
+	}
+	if len(plugin.files) >= plugin.MaxOpen {
+		var (
+			oldest     string
+			oldestTime time.Time
+		)
+		for p, of := range plugin.files {
+			if oldest == "" || of.lastWrite.Before(oldestTime) {
+				oldest, oldestTime = p, of.lastWrite
+			}
+		}
+		plugin.close(oldest, plugin.files[oldest])
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, plugin.mode); err != nil {
+		return
+	}
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return
+	}
+	f = &openFile{
+		File:      file,
+		size:      info.Size(),
+		opened:    now,
+		lastWrite: now,
+		lastSync:  now,
+	}
+	plugin.files[path] = f
+	return
+}
+
+// close the file, lock held.
+func (plugin *PluginConfig) close(path string, f *openFile) {
+	delete(plugin.files, path)
+	if f.dirty && plugin.Fsync != "none" {
+		f.Sync()
+	}
+	if err := f.Close(); err != nil {
+		utils.Logger.Warnf("File output close %s error %q", path, err)
+	}
+}
+
+// sync fsync the file.
+func (plugin *PluginConfig) sync(f *openFile, now time.Time) (err error) {
+	if err = f.Sync(); err == nil {
+		f.dirty, f.lastSync = false, now
+	}
+	return
+}
+
+// shouldRotate check size with data to be written and age, empty file is never rotated.
+func (plugin *PluginConfig) shouldRotate(f *openFile, size int64, now time.Time) bool {
+	if f.size == 0 {
+		return false
+	}
+	if plugin.RotateSize > 0 && f.size+size > plugin.RotateSize {
+		return true
+	}
+	return plugin.RotateInterval > 0 &&
+		now.Sub(f.opened) >= time.Duration(plugin.RotateInterval)*time.Second
+}
+
+// rotate close and rename the file with time suffix, compress it if required, lock held.
+func (plugin *PluginConfig) rotate(path string, f *openFile) {
+	plugin.close(path, f)
+	rotated := unusedPath(path + "." + time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, rotated); err != nil {
+		utils.Logger.Warnf("File output rotate %s error %q", path, err)
+		return
+	}
+	if plugin.Compress {
+		plugin.compress(rotated)
+	}
+}
+
+// compress gzip the rotated file in background, origin is removed.
+func (plugin *PluginConfig) compress(path string) {
+	target := path + ".gz"
+	plugin.wgCompress.Add(1)
+	go func() {
+		defer plugin.wgCompress.Done()
+		if err := gzipFile(path, target, plugin.mode); err != nil {
+			utils.Logger.Warnf("File output compress %s error %q", path, err)
+			return
+		}
+		os.Remove(path)
+	}()
+}
+
+// unusedPath path, or path.N if exists. The compressed name path.gz must be
+// unused too.
+func unusedPath(path string) string {
+	target := path
+	for i := 1; ; i++ {
+		if !exists(target) && !exists(target+".gz") {
+			return target
+		}
+		target = fmt.Sprintf("%s.%d", path, i)
+	}
+}
+
+// exists false only if nothing at path.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !os.IsNotExist(err)
+}
+
+// gzipFile compress src to dst, dst is never overwritten and removed if
+// compression failed.
+func gzipFile(src string, dst string, mode os.FileMode) (err error) {
+	var (
+		in  *os.File
+		out *os.File
+	)
+	if in, err = os.Open(src); err != nil {
+		return
+	}
+	defer in.Close()
+	if out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode); err != nil {
+		return
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+	writer := gzip.NewWriter(out)
+	if _, err = io.Copy(writer, in); err != nil {
+		return
+	}
+	if err = writer.Close(); err != nil {
+		return
+	}
+	return out.Sync()
+}
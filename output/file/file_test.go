@@ -0,0 +1,190 @@
+package outputfile
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func newEvent(app string, message string) utils.LogEvent {
+	return utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC),
+		Message:   message,
+		Extra:     map[string]interface{}{"app": app},
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func Test_Path(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"path":  filepath.Join(dir, "${app}", "${+2006-01-02}", "app.log"),
+		"fsync": "always",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent("web", "hello")))
+	assert.NoError(t, plugin.Process(newEvent("db", "world")))
+	plugin.Stop()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "web", time.Now().Format("2006-01-02"), "app.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"hello"}`+"\n", string(data))
+
+	// line codec, appended after restart.
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"path":  filepath.Join(dir, "${app}.log"),
+		"codec": utils.ConfigPart{"type": "line", "format": "${app}: ${message}"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent("web", "first")))
+	plugin.Stop()
+	plugin, _ = InitHandler(&utils.ConfigPart{"path": filepath.Join(dir, "${app}.log"), "codec": "line"})
+	assert.NoError(t, plugin.Process(newEvent("web", "second")))
+	plugin.Stop()
+	data, err = ioutil.ReadFile(filepath.Join(dir, "web.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "web: first\nsecond\n", string(data))
+
+	_, err = InitHandler(&utils.ConfigPart{"path": "x.log", "fsync": "sometimes"})
+	assert.Error(t, err)
+}
+
+func Test_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"path":        path,
+		"codec":       "line",
+		"rotate_size": 10,
+		"compress":    true,
+	})
+	assert.NoError(t, err)
+	for _, msg := range []string{"line1", "line2", "line3"} {
+		assert.NoError(t, plugin.Process(newEvent("web", msg)))
+	}
+	plugin.Stop()
+
+	rotated, _ := filepath.Glob(path + ".*.gz")
+	assert.Len(t, rotated, 2)
+	contents := []string{}
+	for _, file := range rotated {
+		contents = append(contents, readGzip(t, file))
+	}
+	assert.ElementsMatch(t, []string{"line1\n", "line2\n"}, contents)
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "line3\n", string(data))
+	left, _ := filepath.Glob(path + ".*")
+	assert.Len(t, left, 2)
+}
+
+func Test_IdleAndMaxOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"path":         filepath.Join(dir, "${app}.log"),
+		"codec":        "line",
+		"max_open":     2,
+		"idle_timeout": 60,
+		"compress":     true,
+	})
+	assert.NoError(t, err)
+	for _, app := range []string{"a", "b", "c", "a"} {
+		assert.NoError(t, plugin.Process(newEvent(app, app)))
+		time.Sleep(10 * time.Millisecond)
+	}
+	plugin.filesLock.Lock()
+	assert.Len(t, plugin.files, 2)
+	assert.Contains(t, plugin.files, filepath.Join(dir, "a.log"))
+	plugin.filesLock.Unlock()
+
+	// idle files are rotated and compressed.
+	plugin.check(time.Now().Add(time.Minute))
+	plugin.Stop()
+	rotated, _ := filepath.Glob(filepath.Join(dir, "*.log.*.gz"))
+	assert.Len(t, rotated, 2)
+	// a evicted and reopened, appended to the same file.
+	expected := map[string]string{"a": "a\na\n", "c": "c\n"}
+	for _, file := range rotated {
+		name := filepath.Base(file)
+		assert.True(t, strings.HasPrefix(name, "a.log.") || strings.HasPrefix(name, "c.log."))
+		assert.Equal(t, expected[name[:1]], readGzip(t, file))
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "b.log"))
+	assert.Equal(t, "b\n", string(data))
+}
+
+func Test_UnusedPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log.20170501-080000")
+
+	// compressed name of an earlier rotation is taken.
+	assert.NoError(t, ioutil.WriteFile(path+".gz", []byte("earlier"), 0644))
+	assert.Equal(t, path+".1", unusedPath(path))
+	assert.NoError(t, ioutil.WriteFile(path+".1", []byte("earlier"), 0644))
+	assert.Equal(t, path+".2", unusedPath(path))
+
+	// an existing target is neither overwritten nor removed.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("new"), 0644))
+	assert.Error(t, gzipFile(path, path+".gz", 0644))
+	data, err := ioutil.ReadFile(path + ".gz")
+	assert.NoError(t, err)
+	assert.Equal(t, "earlier", string(data))
+	assert.NoError(t, gzipFile(path, path+".1.gz", 0644))
+	assert.Equal(t, "new", readGzip(t, path+".1.gz"))
+}
+
+func Test_PathEscape(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputfile")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"path":  filepath.Join(dir, "logs", "${app}", "app.log"),
+		"codec": "line",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent("web", "ok")))
+	// field values leaving the static directory go to the fallback.
+	assert.NoError(t, plugin.Process(newEvent("../../escape", "up")))
+	assert.NoError(t, plugin.Process(newEvent("..", "parent")))
+	plugin.Stop()
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "logs", "web", "app.log"))
+	assert.Equal(t, "ok\n", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "logs", "fallback.log"))
+	assert.Equal(t, "up\nparent\n", string(data))
+	_, err = os.Stat(filepath.Join(dir, "escape"))
+	assert.True(t, os.IsNotExist(err))
+}
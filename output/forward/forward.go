@@ -0,0 +1,206 @@
+package outputforward
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ugorji/go/codec"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "forward"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.TLSConfig
+	Host         string `json:"host"`          // fluentd address, default 127.0.0.1:24224
+	Tag          string `json:"tag"`           // tag format, default logagent
+	SharedKey    string `json:"shared_key"`    // shared key handshake if set
+	SelfHostname string `json:"self_hostname"` // hostname in handshake, default os hostname
+	RequireAck   bool   `json:"require_ack"`   // wait ack of every chunk
+	Timeout      int    `json:"timeout"`       // seconds of dial, write and ack, default 5
+
+	handle    *codec.MsgpackHandle
+	tlsConfig *tls.Config
+	conn      net.Conn
+	dec       *codec.Decoder
+	enc       *codec.Encoder
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		handle: utils.NewForwardHandle(),
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Host == "" {
+		conf.Host = "127.0.0.1:24224"
+	}
+	if conf.Tag == "" {
+		conf.Tag = "logagent"
+	}
+	if conf.SelfHostname == "" {
+		if conf.SelfHostname, err = os.Hostname(); err != nil {
+			return
+		}
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	plugin = &conf
+	return
+}
+
+// Process send event in message mode, wait ack if required.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		msg     []interface{}
+		chunk   string
+		timeout = time.Duration(plugin.Timeout) * time.Second
+	)
+	record := ev.GetMap()
+	delete(record, "@timestamp")
+	msg = []interface{}{ev.Format(plugin.Tag), utils.ForwardTime(ev.Timestamp.UnixNano()), record}
+	if plugin.RequireAck {
+		id := make([]byte, 16)
+		if _, err = rand.Read(id); err != nil {
+			return
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		msg = append(msg, map[string]interface{}{"chunk": chunk})
+	}
+
+	if plugin.conn == nil {
+		if err = plugin.connect(); err != nil {
+			utils.Logger.Warnf("Forward connect %s error %s", plugin.Host, err)
+			return
+		}
+	}
+	defer func() {
+		if err != nil {
+			utils.Logger.Warnf("Forward send error %s", err)
+			plugin.Stop()
+		}
+	}()
+	plugin.conn.SetDeadline(time.Now().Add(timeout))
+	if err = plugin.enc.Encode(msg); err != nil {
+		return
+	}
+	if plugin.RequireAck {
+		var resp map[string]interface{}
+		if err = plugin.dec.Decode(&resp); err != nil {
+			return
+		}
+		if string(utils.ForwardBytes(resp["ack"])) != chunk {
+			err = errors.New("forward ack mismatch")
+		}
+	}
+	return
+}
+
+// Stop close connection.
+func (plugin *PluginConfig) Stop() {
+	if plugin.conn != nil {
+		plugin.conn.Close()
+		plugin.conn = nil
+	}
+}
+
+// connect dial and handshake if shared key configed.
+func (plugin *PluginConfig) connect() (err error) {
+	var (
+		conn    net.Conn
+		timeout = time.Duration(plugin.Timeout) * time.Second
+		dialer  = &net.Dialer{Timeout: timeout}
+	)
+	if plugin.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", plugin.Host, plugin.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", plugin.Host)
+	}
+	if err != nil {
+		return
+	}
+	plugin.conn = conn
+	plugin.dec = codec.NewDecoder(bufio.NewReader(conn), plugin.handle)
+	plugin.enc = codec.NewEncoder(conn, plugin.handle)
+	if plugin.SharedKey != "" {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if err = plugin.handshake(); err != nil {
+			plugin.Stop()
+		}
+	}
+	return
+}
+
+// handshake answer HELO with PING, check PONG.
+func (plugin *PluginConfig) handshake() (err error) {
+	var (
+		helo []interface{}
+		pong []interface{}
+		salt = make([]byte, 16)
+		key  = []byte(plugin.SharedKey)
+	)
+	if err = plugin.dec.Decode(&helo); err != nil {
+		return
+	}
+	if len(helo) < 2 || helo[0] != "HELO" {
+		return errors.New("forward helo expected")
+	}
+	options, _ := helo[1].(map[string]interface{})
+	nonce := utils.ForwardBytes(options["nonce"])
+	if auth := utils.ForwardBytes(options["auth"]); len(auth) > 0 {
+		return errors.New("forward user authentication not supported")
+	}
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+	if err = plugin.enc.Encode([]interface{}{
+		"PING", plugin.SelfHostname, salt,
+		utils.ForwardDigest(salt, []byte(plugin.SelfHostname), nonce, key), "", "",
+	}); err != nil {
+		return
+	}
+	// ["PONG", result, reason, hostname, digest]
+	if err = plugin.dec.Decode(&pong); err != nil {
+		return
+	}
+	if len(pong) < 5 || pong[0] != "PONG" {
+		return errors.New("forward pong expected")
+	}
+	if ok, _ := pong[1].(bool); !ok {
+		return errors.New("forward authentication failed " + string(utils.ForwardBytes(pong[2])))
+	}
+	serverHost := utils.ForwardBytes(pong[3])
+	digest := utils.ForwardDigest(salt, serverHost, nonce, key)
+	if subtle.ConstantTimeCompare(utils.ForwardBytes(pong[4]), []byte(digest)) != 1 {
+		return errors.New("forward server shared key mismatch")
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package outputforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codegangsta/inject"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/input/forward"
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+type testInputChannel chan utils.LogEvent
+
+func (c testInputChannel) Input(ev utils.LogEvent) error {
+	c <- ev
+	return nil
+}
+
+func Test_Process(t *testing.T) {
+	inChan := make(testInputChannel, 16)
+	server, err := inputforward.InitHandler(&utils.ConfigPart{
+		"host":       "127.0.0.1:10072",
+		"shared_key": "secret",
+	})
+	assert.NoError(t, err)
+	inj := inject.New()
+	inj.MapTo(inChan, (*utils.InputChannel)(nil))
+	server.SetInjector(inj)
+	go server.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":        "127.0.0.1:10072",
+		"tag":         "app.${type}",
+		"shared_key":  "secret",
+		"require_ack": true,
+	})
+	assert.NoError(t, err)
+	ts := time.Now()
+	assert.NoError(t, plugin.Process(utils.LogEvent{
+		Timestamp: ts,
+		Message:   "message",
+		Tags:      []string{"a"},
+		Extra: map[string]interface{}{
+			"type": "nginx",
+		},
+	}))
+	ev := <-inChan
+	assert.Equal(t, "message", ev.Message)
+	assert.Equal(t, "app.nginx", ev.Extra["tag"])
+	assert.Equal(t, []string{"a"}, ev.Tags)
+	assert.True(t, ts.Equal(ev.Timestamp))
+
+	// wrong key is refused.
+	plugin.Stop()
+	plugin.SharedKey = "wrong"
+	assert.Error(t, plugin.Process(utils.LogEvent{Message: "lost"}))
+	server.Stop()
+}
@@ -0,0 +1,195 @@
+package outputgelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "gelf"
+
+	maxChunks = 128
+)
+
+var (
+	errMessageTooLarge = errors.New("gelf message too large")
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.TLSConfig
+	Host        string `json:"host"`        // graylog address, default 127.0.0.1:12201
+	Protocol    string `json:"protocol"`    // udp or tcp, default udp
+	Compression string `json:"compression"` // udp only, gzip, zlib or none, default gzip
+	ChunkSize   int    `json:"chunk_size"`  // udp chunk bytes, default 1420
+	Timeout     int    `json:"timeout"`     // seconds of dial and write, default 5
+
+	codec     utils.Codec
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Host == "" {
+		conf.Host = "127.0.0.1:12201"
+	}
+	if conf.Protocol == "" {
+		conf.Protocol = "udp"
+	}
+	if conf.Protocol != "udp" && conf.Protocol != "tcp" {
+		err = errors.New("gelf protocol must be udp or tcp")
+		return
+	}
+	if conf.Compression == "" {
+		conf.Compression = "gzip"
+	}
+	switch conf.Compression {
+	case "gzip", "zlib", "none":
+	default:
+		err = errors.New("gelf compression must be gzip, zlib or none")
+		return
+	}
+	if conf.ChunkSize <= 12 {
+		conf.ChunkSize = 1420
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	if conf.codec, err = utils.NewCodec(utils.ConfigPart{"type": "gelf"}); err != nil {
+		return
+	}
+	plugin = &conf
+	return
+}
+
+// Process send event to graylog.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = plugin.codec.Encode(ev); err != nil {
+		utils.Logger.Errorf("Gelf encode failed %s: %v", err, ev)
+		return nil
+	}
+	if plugin.conn == nil {
+		if err = plugin.dial(); err != nil {
+			utils.Logger.Warnf("Gelf dial %s error %s", plugin.Host, err)
+			return
+		}
+	}
+	plugin.conn.SetWriteDeadline(time.Now().Add(time.Duration(plugin.Timeout) * time.Second))
+	if plugin.Protocol == "tcp" {
+		_, err = plugin.conn.Write(append(data, 0))
+	} else {
+		err = plugin.writeUDP(data)
+	}
+	if err == errMessageTooLarge {
+		// retry will never succeed.
+		utils.Logger.Errorf("Gelf message of %d bytes dropped, too many chunks", len(data))
+		return nil
+	}
+	if err != nil {
+		utils.Logger.Warnf("Gelf write error %s", err)
+		plugin.conn.Close()
+		plugin.conn = nil
+	}
+	return
+}
+
+// Stop close connection.
+func (plugin *PluginConfig) Stop() {
+	if plugin.conn != nil {
+		plugin.conn.Close()
+		plugin.conn = nil
+	}
+}
+
+// dial connect graylog.
+func (plugin *PluginConfig) dial() (err error) {
+	dialer := &net.Dialer{
+		Timeout: time.Duration(plugin.Timeout) * time.Second,
+	}
+	if plugin.Protocol == "tcp" && plugin.tlsConfig != nil {
+		plugin.conn, err = tls.DialWithDialer(dialer, "tcp", plugin.Host, plugin.tlsConfig)
+		return
+	}
+	plugin.conn, err = dialer.Dial(plugin.Protocol, plugin.Host)
+	return
+}
+
+// writeUDP compress and chunk if needed.
+func (plugin *PluginConfig) writeUDP(data []byte) (err error) {
+	var (
+		buff = &bytes.Buffer{}
+		id   = make([]byte, 8)
+	)
+	switch plugin.Compression {
+	case "gzip":
+		w := gzip.NewWriter(buff)
+		w.Write(data)
+		w.Close()
+		data = buff.Bytes()
+	case "zlib":
+		w := zlib.NewWriter(buff)
+		w.Write(data)
+		w.Close()
+		data = buff.Bytes()
+	}
+	if len(data) <= plugin.ChunkSize {
+		_, err = plugin.conn.Write(data)
+		return
+	}
+
+	// magic(2) id(8) sequence(1) count(1)
+	size := plugin.ChunkSize - 12
+	count := (len(data) + size - 1) / size
+	if count > maxChunks {
+		return errMessageTooLarge
+	}
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	chunk := make([]byte, 0, plugin.ChunkSize)
+	for seq := 0; seq < count; seq++ {
+		end := (seq + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk = append(chunk[:0], 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, data[seq*size:end]...)
+		if _, err = plugin.conn.Write(chunk); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,98 @@
+package outputgelf
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func Test_UDPChunked(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:10062")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":        "127.0.0.1:10062",
+		"compression": "none",
+		"chunk_size":  64,
+	})
+	assert.NoError(t, err)
+	defer plugin.Stop()
+	ev := utils.LogEvent{
+		Timestamp: time.Now(),
+		Message:   "a message longer than one chunk of sixty four bytes",
+		Extra: map[string]interface{}{
+			"level": 6,
+		},
+	}
+	assert.NoError(t, plugin.Process(ev))
+
+	data := make([]byte, 1024)
+	message := &bytes.Buffer{}
+	for seq := byte(0); ; seq++ {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(data)
+		assert.NoError(t, err)
+		assert.True(t, n <= 64)
+		assert.Equal(t, []byte{0x1e, 0x0f}, data[:2])
+		assert.Equal(t, seq, data[10])
+		message.Write(data[12:n])
+		if seq+1 == data[11] {
+			break
+		}
+	}
+	codec, _ := utils.NewCodec(utils.ConfigPart{"type": "gelf"})
+	events, err := codec.Decode(message.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, ev.Message, events[0].Message)
+	assert.Equal(t, 6, events[0].Extra["level"])
+
+	// gzip compressed in one datagram.
+	plugin.ChunkSize = 1420
+	plugin.Compression = "gzip"
+	assert.NoError(t, plugin.Process(ev))
+	n, _, err := conn.ReadFrom(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, data[:2])
+	events, err = codec.Decode(data[:n])
+	assert.NoError(t, err)
+	assert.Equal(t, ev.Message, events[0].Message)
+}
+
+func Test_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:10063")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":     "127.0.0.1:10063",
+		"protocol": "tcp",
+	})
+	assert.NoError(t, err)
+	defer plugin.Stop()
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "a"}))
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "b"}))
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	codec, _ := utils.NewCodec(utils.ConfigPart{"type": "gelf"})
+	for _, msg := range []string{"a", "b"} {
+		data, err := reader.ReadBytes(0)
+		assert.NoError(t, err)
+		events, err := codec.Decode(data[:len(data)-1])
+		assert.NoError(t, err)
+		assert.Equal(t, msg, events[0].Message)
+	}
+}
@@ -0,0 +1,256 @@
+package outputhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "http"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	URL           string            `json:"url"`            // url format, ex: http://alert/api/${app}
+	Method        string            `json:"method"`         // default POST
+	Headers       map[string]string `json:"headers"`        // extra request headers
+	AuthToken     string            `json:"auth_token"`     // bearer token
+	AuthUser      string            `json:"auth_user"`      // basic auth user
+	AuthPassword  string            `json:"auth_password"`  // basic auth password
+	Gzip          bool              `json:"gzip"`           // gzip request body
+	Timeout       int               `json:"timeout"`        // seconds of a request, default 10
+	BatchCount    int               `json:"batch_count"`    // events per request, default 1 is an event per request
+	BatchFormat   string            `json:"batch_format"`   // json_array or ndjson, default json_array
+	FlushInterval int               `json:"flush_interval"` // milliseconds queued events wait for a full batch at most, default 1000
+	RetryStatus   []int             `json:"retry_status"`   // status to retry, default 408, 429, 500, 502, 503, 504
+
+	codec  utils.Codec
+	client *http.Client
+	retry  map[int]bool
+}
+
+// requestItem an encoded event.
+type requestItem struct {
+	url  string
+	data []byte
+}
+
+// statusError response of unexpected status.
+type statusError struct {
+	status int
+	body   string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("http status %d %s", e.status, e.body)
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	var (
+		tlsConfig *tls.Config
+	)
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+		retry: map[int]bool{},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.URL == "" {
+		err = errors.New("http output url required")
+		return
+	}
+	if conf.Method == "" {
+		conf.Method = http.MethodPost
+	}
+	conf.Method = strings.ToUpper(conf.Method)
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10
+	}
+	if conf.BatchCount <= 0 {
+		conf.BatchCount = 1
+	}
+	if conf.BatchFormat == "" {
+		conf.BatchFormat = "json_array"
+	}
+	if conf.BatchFormat != "json_array" && conf.BatchFormat != "ndjson" {
+		err = errors.New("http batch_format must be json_array or ndjson")
+		return
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 1000
+	}
+	if len(conf.RetryStatus) == 0 {
+		conf.RetryStatus = []int{408, 429, 500, 502, 503, 504}
+	}
+	for _, status := range conf.RetryStatus {
+		conf.retry[status] = true
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
+	if tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	conf.client = &http.Client{
+		Timeout: time.Duration(conf.Timeout) * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConnsPerHost: 4,
+		},
+	}
+	plugin = &conf
+	return
+}
+
+// Process send an event.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	return plugin.ProcessBatch([]utils.LogEvent{ev})
+}
+
+// Batch events of a request and time they wait at most.
+func (plugin *PluginConfig) Batch() (int, time.Duration) {
+	return plugin.BatchCount, time.Duration(plugin.FlushInterval) * time.Millisecond
+}
+
+// ProcessBatch send events grouped by url. An error is returned if any request
+// failed with retryable status or connection error, then the whole batch is
+// sent again. Events of other failed status are dropped.
+func (plugin *PluginConfig) ProcessBatch(events []utils.LogEvent) (err error) {
+	var (
+		order  []string
+		groups = map[string][]requestItem{}
+	)
+	for _, ev := range events {
+		data, eerr := plugin.codec.Encode(ev)
+		if eerr != nil {
+			utils.Logger.Warnf("Http output encode error %q", eerr)
+			continue
+		}
+		url := ev.Format(plugin.URL)
+		if _, ok := groups[url]; !ok {
+			order = append(order, url)
+		}
+		groups[url] = append(groups[url], requestItem{url: url, data: data})
+	}
+	for _, url := range order {
+		items := groups[url]
+		for start := 0; start < len(items); start += plugin.BatchCount {
+			end := start + plugin.BatchCount
+			if end > len(items) {
+				end = len(items)
+			}
+			serr := plugin.send(url, items[start:end])
+			if serr == nil {
+				continue
+			}
+			if e, ok := serr.(statusError); ok && !plugin.retry[e.status] {
+				utils.Logger.Warnf("Http output %s error %q, %d events lost.", url, serr, end-start)
+				continue
+			}
+			return serr
+		}
+	}
+	return
+}
+
+// Stop close idle connections.
+func (plugin *PluginConfig) Stop() {
+	plugin.client.Transport.(*http.Transport).CloseIdleConnections()
+}
+
+// send a request of items.
+func (plugin *PluginConfig) send(url string, items []requestItem) (err error) {
+	var (
+		req  *http.Request
+		resp *http.Response
+		body []byte
+	)
+	body = plugin.body(items)
+	if plugin.Gzip {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(body)
+		writer.Close()
+		body = buf.Bytes()
+	}
+	if req, err = http.NewRequest(plugin.Method, url, bytes.NewReader(body)); err != nil {
+		return
+	}
+	if plugin.BatchCount > 1 && plugin.BatchFormat == "ndjson" {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if plugin.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for key, value := range plugin.Headers {
+		req.Header.Set(key, value)
+	}
+	if plugin.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+plugin.AuthToken)
+	} else if plugin.AuthUser != "" {
+		req.SetBasicAuth(plugin.AuthUser, plugin.AuthPassword)
+	}
+
+	if resp, err = plugin.client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	reply, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError{status: resp.StatusCode, body: strings.TrimSpace(string(reply))}
+	}
+	return
+}
+
+// body a single event, or events of batch format.
+func (plugin *PluginConfig) body(items []requestItem) []byte {
+	var (
+		buf bytes.Buffer
+	)
+	if plugin.BatchCount == 1 {
+		return items[0].data
+	}
+	if plugin.BatchFormat == "ndjson" {
+		for _, item := range items {
+			buf.Write(bytes.TrimRight(item.data, "\n"))
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+	buf.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(bytes.TrimRight(item.data, "\n"))
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
@@ -0,0 +1,174 @@
+package outputhttp
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// request received by test server.
+type request struct {
+	method   string
+	path     string
+	header   http.Header
+	user     string
+	password string
+	body     string
+}
+
+// newServer reply status in turn, 200 if run out.
+func newServer(t *testing.T, status ...int) (*httptest.Server, func() []request) {
+	var (
+		lock     sync.Mutex
+		requests []request
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			assert.NoError(t, err)
+			reader = gz
+		}
+		body, _ := ioutil.ReadAll(reader)
+		user, password, _ := r.BasicAuth()
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, request{
+			method:   r.Method,
+			path:     r.URL.Path,
+			header:   r.Header,
+			user:     user,
+			password: password,
+			body:     string(body),
+		})
+		if len(status) > 0 {
+			w.WriteHeader(status[0])
+			status = status[1:]
+		}
+	}))
+	return server, func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]request{}, requests...)
+	}
+}
+
+func newEvent(app string, message string) utils.LogEvent {
+	return utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC),
+		Message:   message,
+		Extra:     map[string]interface{}{"app": app},
+	}
+}
+
+func Test_Single(t *testing.T) {
+	server, received := newServer(t)
+	defer server.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"url":           server.URL + "/alert/${app}",
+		"method":        "put",
+		"headers":       map[string]string{"X-Source": "logagent"},
+		"auth_user":     "user",
+		"auth_password": "secret",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent("web", "hello")))
+	requests := received()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "PUT", requests[0].method)
+	assert.Equal(t, "/alert/web", requests[0].path)
+	assert.Equal(t, "logagent", requests[0].header.Get("X-Source"))
+	assert.Equal(t, "application/json", requests[0].header.Get("Content-Type"))
+	assert.Equal(t, "user", requests[0].user)
+	assert.Equal(t, "secret", requests[0].password)
+	assert.Equal(t, `{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"hello"}`, requests[0].body)
+	plugin.Stop()
+
+	_, err = InitHandler(&utils.ConfigPart{"url": server.URL, "batch_format": "xml"})
+	assert.Error(t, err)
+	_, err = InitHandler(&utils.ConfigPart{})
+	assert.Error(t, err)
+}
+
+func Test_Batch(t *testing.T) {
+	server, received := newServer(t)
+	defer server.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"url":         server.URL + "/${app}",
+		"batch_count": 2,
+		"auth_token":  "token",
+		"gzip":        true,
+	})
+	assert.NoError(t, err)
+	count, interval := plugin.Batch()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, time.Second, interval)
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("web", "a"), newEvent("db", "b")}))
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("web", "c"), newEvent("web", "d")}))
+	plugin.Stop()
+	requests := received()
+	assert.Len(t, requests, 3)
+	assert.Equal(t, "/web", requests[0].path)
+	assert.Equal(t, "Bearer token", requests[0].header.Get("Authorization"))
+	assert.Equal(t, `[{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"a"}]`, requests[0].body)
+	assert.Equal(t, "/db", requests[1].path)
+	assert.Equal(t, "/web", requests[2].path)
+	assert.Equal(t, `[{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"c"},`+
+		`{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"d"}]`, requests[2].body)
+
+	server, received = newServer(t)
+	defer server.Close()
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"url":          server.URL,
+		"batch_count":  2,
+		"batch_format": "ndjson",
+		"codec":        utils.ConfigPart{"type": "line", "format": "${app}"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("web", "a"), newEvent("db", "b")}))
+	plugin.Stop()
+	requests = received()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "application/x-ndjson", requests[0].header.Get("Content-Type"))
+	assert.Equal(t, "web\ndb\n", requests[0].body)
+}
+
+func Test_Retry(t *testing.T) {
+	server, received := newServer(t, 503, http.StatusBadRequest)
+	defer server.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{"url": server.URL})
+	assert.NoError(t, err)
+	// 503 is returned, the event stays in disk queue.
+	assert.Error(t, plugin.Process(newEvent("web", "a")))
+	// a got 400 on retry and is dropped, b is sent.
+	assert.NoError(t, plugin.Process(newEvent("web", "a")))
+	assert.NoError(t, plugin.Process(newEvent("web", "b")))
+	plugin.Stop()
+	requests := received()
+	assert.Len(t, requests, 3)
+	assert.Contains(t, requests[2].body, `"message":"b"`)
+
+	// connection error is always retried.
+	server.Close()
+	plugin, err = InitHandler(&utils.ConfigPart{"url": server.URL, "retry_status": []int{500}, "batch_count": 2})
+	assert.NoError(t, err)
+	assert.Error(t, plugin.Process(newEvent("web", "a")))
+	assert.Error(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("web", "a"), newEvent("web", "b")}))
+	plugin.Stop()
+}
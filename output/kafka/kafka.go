@@ -0,0 +1,242 @@
+package outputkafka
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "kafka"
+)
+
+var (
+	compressions = map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+	requiredAcks = map[string]sarama.RequiredAcks{
+		"none":   sarama.NoResponse,
+		"leader": sarama.WaitForLocal,
+		"all":    sarama.WaitForAll,
+	}
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Brokers       []string `json:"brokers"`        // bootstrap brokers, default 127.0.0.1:9092
+	Topic         string   `json:"topic"`          // topic format, default logagent
+	Key           string   `json:"key"`            // partition key format, ex: ${host}, random partition if empty or absent
+	Version       string   `json:"version"`        // kafka version, default 1.0.0, zstd requires 2.1.0
+	ClientID      string   `json:"client_id"`      // default logagent
+	Compression   string   `json:"compression"`    // none, gzip, snappy, lz4 or zstd, default none
+	RequiredAcks  string   `json:"required_acks"`  // none, leader or all, default leader
+	BatchCount    int      `json:"batch_count"`    // messages per send, default 100
+	FlushInterval int      `json:"flush_interval"` // milliseconds queued events wait for a full batch at most, default 1000
+	MaxRetries    int      `json:"max_retries"`    // producer retries before a send fails, default 3
+	Timeout       int      `json:"timeout"`        // seconds of dial and produce, default 10
+
+	config   *sarama.Config
+	producer sarama.SyncProducer
+	codec    utils.Codec
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if len(conf.Brokers) == 0 {
+		conf.Brokers = []string{"127.0.0.1:9092"}
+	}
+	if conf.Topic == "" {
+		conf.Topic = "logagent"
+	}
+	if conf.BatchCount <= 0 {
+		conf.BatchCount = 100
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 1000
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
+	if conf.config, err = conf.newConfig(); err != nil {
+		return
+	}
+	// brokers may be down now, connect again at send.
+	if err = conf.connect(); err != nil {
+		utils.Logger.Warnf("Kafka output connect error %q, retry at send", err)
+		err = nil
+	}
+	plugin = &conf
+	return
+}
+
+// newConfig producer config of options.
+func (plugin *PluginConfig) newConfig() (config *sarama.Config, err error) {
+	var (
+		ok bool
+	)
+	config = sarama.NewConfig()
+	if plugin.Version == "" {
+		plugin.Version = "1.0.0"
+	}
+	if config.Version, err = sarama.ParseKafkaVersion(plugin.Version); err != nil {
+		return
+	}
+	if plugin.ClientID == "" {
+		plugin.ClientID = "logagent"
+	}
+	config.ClientID = plugin.ClientID
+	if plugin.Compression == "" {
+		plugin.Compression = "none"
+	}
+	if config.Producer.Compression, ok = compressions[plugin.Compression]; !ok {
+		err = errors.New("kafka compression must be none, gzip, snappy, lz4 or zstd")
+		return
+	}
+	if plugin.RequiredAcks == "" {
+		plugin.RequiredAcks = "leader"
+	}
+	if config.Producer.RequiredAcks, ok = requiredAcks[plugin.RequiredAcks]; !ok {
+		err = errors.New("kafka required_acks must be none, leader or all")
+		return
+	}
+	if plugin.MaxRetries <= 0 {
+		plugin.MaxRetries = 3
+	}
+	if plugin.Timeout <= 0 {
+		plugin.Timeout = 10
+	}
+	timeout := time.Duration(plugin.Timeout) * time.Second
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	if config.Net.TLS.Config, err = plugin.ClientTLS(); err != nil {
+		return
+	}
+	config.Net.TLS.Enable = config.Net.TLS.Config != nil
+	config.Producer.Timeout = timeout
+	config.Producer.Retry.Max = plugin.MaxRetries
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	err = config.Validate()
+	return
+}
+
+// connect create producer.
+func (plugin *PluginConfig) connect() (err error) {
+	plugin.producer, err = sarama.NewSyncProducer(plugin.Brokers, plugin.config)
+	return
+}
+
+// Process send an event.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	return plugin.ProcessBatch([]utils.LogEvent{ev})
+}
+
+// Batch events of a send and time they wait at most.
+func (plugin *PluginConfig) Batch() (int, time.Duration) {
+	return plugin.BatchCount, time.Duration(plugin.FlushInterval) * time.Millisecond
+}
+
+// ProcessBatch send events as messages. An error is returned if any message
+// failed after producer retries, except those kafka never accepts, then the
+// whole batch is sent again.
+func (plugin *PluginConfig) ProcessBatch(events []utils.LogEvent) (err error) {
+	var (
+		msgs []*sarama.ProducerMessage
+	)
+	for _, ev := range events {
+		msg, merr := plugin.message(ev)
+		if merr != nil {
+			utils.Logger.Warnf("Kafka output encode error %q", merr)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	if plugin.producer == nil {
+		if err = plugin.connect(); err != nil {
+			return
+		}
+	}
+	if err = plugin.producer.SendMessages(msgs); err == nil {
+		return
+	}
+	perrs, ok := err.(sarama.ProducerErrors)
+	if !ok {
+		return
+	}
+	for _, perr := range perrs {
+		if !rejected(perr.Err) {
+			return
+		}
+	}
+	for _, perr := range perrs {
+		utils.Logger.Warnf("Kafka output topic %s error %q, message lost.", perr.Msg.Topic, perr.Err)
+	}
+	return nil
+}
+
+// Stop close producer.
+func (plugin *PluginConfig) Stop() {
+	if plugin.producer != nil {
+		plugin.producer.Close()
+	}
+}
+
+// message of event, messages carry producer state, build new ones every time.
+func (plugin *PluginConfig) message(ev utils.LogEvent) (msg *sarama.ProducerMessage, err error) {
+	var (
+		data []byte
+	)
+	if data, err = plugin.codec.Encode(ev); err != nil {
+		return
+	}
+	msg = &sarama.ProducerMessage{
+		Topic:     ev.Format(plugin.Topic),
+		Value:     sarama.ByteEncoder(data),
+		Timestamp: ev.Timestamp,
+	}
+	// nil key is partitioned randomly.
+	if key := ev.Format(plugin.Key); key != "" && !strings.Contains(key, "${") {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	return
+}
+
+// rejected errors never success on retry.
+func rejected(err error) bool {
+	switch err {
+	case sarama.ErrMessageSizeTooLarge, sarama.ErrInvalidMessage, sarama.ErrInvalidMessageSize,
+		sarama.ErrInvalidTopic, sarama.ErrMessageSetSizeTooLarge, sarama.ErrTopicAuthorizationFailed:
+		return true
+	}
+	return false
+}
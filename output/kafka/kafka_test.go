@@ -0,0 +1,88 @@
+package outputkafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func newEvent(host string) utils.LogEvent {
+	return utils.LogEvent{
+		Message: "hello",
+		Extra:   map[string]interface{}{"app": "web", "host": host},
+	}
+}
+
+// partition of key in topic of 2 partitions.
+func partition(t *testing.T, key string) int32 {
+	p, err := sarama.NewHashPartitioner("logs-web").Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, 2)
+	assert.NoError(t, err)
+	return p
+}
+
+func Test_Produce(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetBroker(broker.Addr(), broker.BrokerID()).
+		SetLeader("logs-web", 0, broker.BrokerID()).
+		SetLeader("logs-web", 1, broker.BrokerID())
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest":  sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"brokers":       []string{broker.Addr()},
+		"topic":         "logs-${app}",
+		"key":           "${host}",
+		"batch_count":   2,
+		"required_acks": "all",
+		"compression":   "gzip",
+		"max_retries":   1,
+	})
+	assert.NoError(t, err)
+	msg, err := plugin.message(newEvent("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "logs-web", msg.Topic)
+	assert.Equal(t, sarama.StringEncoder("a"), msg.Key)
+	assert.Equal(t, sarama.ByteEncoder(`{"@timestamp":"0001-01-01T00:00:00","app":"web","host":"a","message":"hello"}`), msg.Value)
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("a"), newEvent("b")}))
+
+	// partition of a lost its leader, the batch is sent again.
+	other := "b"
+	for partition(t, other) == partition(t, "a") {
+		other += "b"
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3).
+			SetError("logs-web", partition(t, "a"), sarama.ErrNotLeaderForPartition),
+	})
+	assert.Error(t, plugin.ProcessBatch([]utils.LogEvent{newEvent("a"), newEvent(other)}))
+
+	// kafka never accepts, dropped.
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3).
+			SetError("logs-web", partition(t, "a"), sarama.ErrInvalidMessage),
+	})
+	assert.NoError(t, plugin.Process(newEvent("a")))
+	plugin.Stop()
+
+	for _, part := range []utils.ConfigPart{
+		{"compression": "brotli"},
+		{"required_acks": "2"},
+		{"version": "x"},
+	} {
+		_, err = InitHandler(&part)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,205 @@
+package outputlogagent
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "logagent"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.TLSConfig
+	Hosts         []string `json:"hosts"`          // receiver agents, batches are balanced over them, default 127.0.0.1:5170
+	Compression   string   `json:"compression"`    // none or gzip, default gzip
+	BatchCount    int      `json:"batch_count"`    // events per batch, default 200
+	FlushInterval int      `json:"flush_interval"` // milliseconds queued events wait for a full batch at most, default 1000
+	Timeout       int      `json:"timeout"`        // seconds of dial, send and ack, default 30
+	Backoff       int      `json:"backoff"`        // seconds a failed receiver is skipped, default 5
+
+	tlsConfig *tls.Config
+	codec     utils.Codec
+	receivers []*receiver
+	next      int
+	seq       uint64
+}
+
+// receiver connection to a receiver agent.
+type receiver struct {
+	addr      string
+	conn      net.Conn
+	reader    *utils.AgentReader
+	downUntil time.Time
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if len(conf.Hosts) == 0 {
+		conf.Hosts = []string{"127.0.0.1:5170"}
+	}
+	if conf.Compression == "" {
+		conf.Compression = "gzip"
+	}
+	if conf.Compression != "none" && conf.Compression != "gzip" {
+		err = errors.New("logagent compression must be none or gzip")
+		return
+	}
+	if conf.BatchCount <= 0 {
+		conf.BatchCount = 200
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 1000
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 30
+	}
+	if conf.Backoff <= 0 {
+		conf.Backoff = 5
+	}
+	if conf.codec, err = utils.NewAgentCodec(); err != nil {
+		return
+	}
+	if conf.tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	for _, host := range conf.Hosts {
+		conf.receivers = append(conf.receivers, &receiver{addr: host})
+	}
+	plugin = &conf
+	return
+}
+
+// Process send an event.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	return plugin.ProcessBatch([]utils.LogEvent{ev})
+}
+
+// Batch events of a batch and time they wait at most.
+func (plugin *PluginConfig) Batch() (int, time.Duration) {
+	return plugin.BatchCount, time.Duration(plugin.FlushInterval) * time.Millisecond
+}
+
+// ProcessBatch send events as a batch. Receivers take batches in turn, a
+// failed receiver is skipped for backoff seconds and the batch goes to the
+// next one. An error is returned if no receiver acked.
+func (plugin *PluginConfig) ProcessBatch(events []utils.LogEvent) (err error) {
+	var (
+		items [][]byte
+		frame []byte
+	)
+	for _, ev := range events {
+		data, eerr := plugin.codec.Encode(ev)
+		if eerr != nil {
+			utils.Logger.Warnf("Logagent output encode error %q", eerr)
+			continue
+		}
+		items = append(items, data)
+	}
+	if len(items) == 0 {
+		return
+	}
+	plugin.seq++
+	if frame, err = utils.AgentBatch(plugin.seq, items, plugin.Compression == "gzip"); err != nil {
+		return
+	}
+	err = errors.New("logagent no receiver available")
+	for i := 0; i < len(plugin.receivers); i++ {
+		r := plugin.receivers[plugin.next]
+		plugin.next = (plugin.next + 1) % len(plugin.receivers)
+		if time.Now().Before(r.downUntil) {
+			continue
+		}
+		if err = plugin.send(r, frame); err == nil {
+			return
+		}
+		utils.Logger.Warnf("Logagent output %s error %q, retry in %d sec.", r.addr, err, plugin.Backoff)
+		r.close()
+		r.downUntil = time.Now().Add(time.Duration(plugin.Backoff) * time.Second)
+	}
+	return
+}
+
+// Stop close connections.
+func (plugin *PluginConfig) Stop() {
+	for _, r := range plugin.receivers {
+		r.close()
+	}
+}
+
+// send a batch frame and wait its ack. The receiver acks after events are
+// in its disk queue, a batch may be sent twice if the ack is lost.
+func (plugin *PluginConfig) send(r *receiver, frame []byte) (err error) {
+	var (
+		seq     uint64
+		timeout = time.Duration(plugin.Timeout) * time.Second
+	)
+	if r.conn == nil {
+		if err = r.dial(timeout, plugin.tlsConfig); err != nil {
+			return
+		}
+	}
+	r.conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = r.conn.Write(frame); err != nil {
+		return
+	}
+	if seq, err = r.reader.ReadAck(); err != nil {
+		return
+	}
+	if seq != plugin.seq {
+		err = errors.New("logagent ack mismatch " + strconv.FormatUint(seq, 10))
+	}
+	return
+}
+
+// dial connect the receiver.
+func (r *receiver) dial(timeout time.Duration, tlsConfig *tls.Config) (err error) {
+	var (
+		conn   net.Conn
+		dialer = &net.Dialer{Timeout: timeout}
+	)
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return
+	}
+	if r.reader, err = utils.NewAgentReader(conn, 0); err != nil {
+		conn.Close()
+		return
+	}
+	r.conn = conn
+	return
+}
+
+// close the connection.
+func (r *receiver) close() {
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
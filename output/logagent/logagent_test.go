@@ -0,0 +1,122 @@
+package outputlogagent
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// testReceiver record messages of batches, ack them if ack is set.
+type testReceiver struct {
+	listener net.Listener
+	ack      bool
+	messages []string
+	lock     sync.Mutex
+}
+
+func startReceiver(t *testing.T, addr string, ack bool) *testReceiver {
+	listener, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	r := &testReceiver{listener: listener, ack: ack}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.handle(conn)
+		}
+	}()
+	return r
+}
+
+func (r *testReceiver) handle(conn net.Conn) {
+	defer conn.Close()
+	reader, _ := utils.NewAgentReader(conn, 0)
+	for {
+		seq, events, err := reader.ReadBatch()
+		if err != nil || !r.ack {
+			return
+		}
+		r.lock.Lock()
+		for _, ev := range events {
+			r.messages = append(r.messages, ev.Message)
+		}
+		r.lock.Unlock()
+		conn.Write(utils.AgentAck(seq))
+	}
+}
+
+func (r *testReceiver) received() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.messages...)
+}
+
+func event(msg string) utils.LogEvent {
+	return utils.LogEvent{Timestamp: time.Now(), Message: msg, Extra: map[string]interface{}{}}
+}
+
+func Test_Balance(t *testing.T) {
+	r1 := startReceiver(t, "127.0.0.1:10082", true)
+	defer r1.listener.Close()
+	r2 := startReceiver(t, "127.0.0.1:10083", true)
+	defer r2.listener.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"hosts":       []string{"127.0.0.1:10082", "127.0.0.1:10083"},
+		"batch_count": 2,
+	})
+	assert.NoError(t, err)
+	count, interval := plugin.Batch()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, time.Second, interval)
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{event("a"), event("b")}))
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{event("c"), event("d")}))
+	assert.NoError(t, plugin.Process(event("e")))
+	plugin.Stop()
+	assert.Equal(t, []string{"a", "b", "e"}, r1.received())
+	assert.Equal(t, []string{"c", "d"}, r2.received())
+}
+
+func Test_Failover(t *testing.T) {
+	live := startReceiver(t, "127.0.0.1:10084", true)
+	defer live.listener.Close()
+	mute := startReceiver(t, "127.0.0.1:10085", false)
+	defer mute.listener.Close()
+
+	// nothing listen at 10086, mute receiver never acks.
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"hosts":       []string{"127.0.0.1:10086", "127.0.0.1:10085", "127.0.0.1:10084"},
+		"batch_count": 1,
+		"compression": "none",
+		"backoff":     60,
+	})
+	assert.NoError(t, err)
+	for _, msg := range []string{"a", "b", "c"} {
+		assert.NoError(t, plugin.Process(event(msg)))
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, live.received())
+	assert.True(t, plugin.receivers[0].downUntil.After(time.Now()))
+	assert.True(t, plugin.receivers[1].downUntil.After(time.Now()))
+
+	// an error is returned while no receiver acks, events stay in disk queue.
+	live.listener.Close()
+	plugin.receivers[2].close()
+	assert.Error(t, plugin.Process(event("d")))
+	assert.Error(t, plugin.Process(event("d")))
+	assert.Equal(t, []string{"a", "b", "c"}, live.received())
+	plugin.Stop()
+
+	_, err = InitHandler(&utils.ConfigPart{"compression": "lz4"})
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package outputredis
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -16,19 +18,36 @@ const (
 // PluginConfig config struct.
 type PluginConfig struct {
 	utils.OutputPluginConfig
-	Key      string `json:"key"`
-	Host     string `json:"host"`
-	DB       int    `json:"db"`
-	Password string `json:"password"`
-	DataType string `json:"data_type"`
-	Timeout  int    `json:"timeout"`
-
-	pool         *redis.Pool
-	bufChan      chan utils.LogEvent
-	exitChan     chan int
-	exitSyncChan chan int
+	utils.CodecConfig
+	Key             string   `json:"key"`
+	Host            string   `json:"host"`        // standalone address, default 127.0.0.1:6379
+	Mode            string   `json:"mode"`        // standalone, sentinel or cluster, default standalone
+	Sentinels       []string `json:"sentinels"`   // sentinel addresses of sentinel mode
+	MasterName      string   `json:"master_name"` // master monitored by sentinels
+	Hosts           []string `json:"hosts"`       // cluster seed nodes, default host
+	DB              int      `json:"db"`
+	Password        string   `json:"password"`
+	DataType        string   `json:"data_type"`         // list, channel or stream, default list
+	Timeout         int      `json:"timeout"`           // seconds of dial, read and write, default 5
+	BatchCount      int      `json:"batch_count"`       // events per pipeline, default 50
+	FlushInterval   int      `json:"flush_interval"`    // milliseconds queued events wait for a full batch at most, default 1000
+	MaxListLength   int64    `json:"max_list_length"`   // back off if list is longer, 0 is unlimited
+	StreamMaxLength int64    `json:"stream_max_length"` // XADD MAXLEN ~, 0 is unlimited
+	Field           string   `json:"field"`             // stream field of encoded event, default event
+
+	router router
+	codec  utils.Codec
+}
+
+// pipelineItem an encoded event.
+type pipelineItem struct {
+	key  string
+	data []byte
 }
 
+// errCongested list is too long.
+var errCongested = errors.New("redis list is congested")
+
 func init() {
 	utils.RegistOutputHandler(PluginName, InitHandler)
 }
@@ -41,81 +60,227 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 				Type: PluginName,
 			},
 		},
-
-		bufChan:      make(chan utils.LogEvent),
-		exitChan:     make(chan int),
-		exitSyncChan: make(chan int),
 	}
 	if err = utils.ReflectConfigPart(part, &conf); err != nil {
 		return
 	}
+	if conf.Host == "" {
+		conf.Host = "127.0.0.1:6379"
+	}
+	if conf.DataType == "" {
+		conf.DataType = "list"
+	}
+	switch conf.DataType {
+	case "list", "channel", "stream":
+	default:
+		err = errors.New("unknow redis data_type " + conf.DataType)
+		return
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.BatchCount <= 0 {
+		conf.BatchCount = 50
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 1000
+	}
+	if conf.Field == "" {
+		conf.Field = "event"
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
 
-	// init connection pool
-	conf.pool = &redis.Pool{
-		MaxIdle:     16,
-		MaxActive:   16,
-		IdleTimeout: 60 * time.Second,
-		Dial: func() (redis.Conn, error) {
-
-			ops := []redis.DialOption{
-				redis.DialConnectTimeout(time.Second * 5),
-				redis.DialDatabase(conf.DB),
-			}
-			if conf.Password != "" {
-				ops = append(ops, redis.DialPassword(conf.Password))
-			}
-			conn, err := redis.Dial("tcp", conf.Host, ops...)
-			if err != nil {
-				utils.Logger.Warnf("Redis output dial redis error %q", err)
-				return nil, err
-			}
-			return conn, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
+	if conf.Mode == "" {
+		conf.Mode = "standalone"
+	}
+	switch conf.Mode {
+	case "standalone":
+		conf.router = newStandaloneRouter(conf.Host, conf.dial(true))
+	case "sentinel":
+		if len(conf.Sentinels) == 0 || conf.MasterName == "" {
+			err = errors.New("redis sentinels and master_name required")
+			return
+		}
+		conf.router = newSentinelRouter(conf.Sentinels, conf.MasterName, conf.dialSentinel, conf.dial(true))
+	case "cluster":
+		if len(conf.Hosts) == 0 {
+			conf.Hosts = []string{conf.Host}
+		}
+		// cluster has only database 0.
+		conf.router = newClusterRouter(conf.Hosts, conf.dial(false))
+	default:
+		err = errors.New("unknow redis mode " + conf.Mode)
+		return
 	}
 
 	plugin = &conf
 	return
 }
 
-// Process flush log event
+// dial return the func dial a node.
+func (plugin *PluginConfig) dial(selectDB bool) dialFunc {
+	return func(addr string) (redis.Conn, error) {
+		timeout := time.Duration(plugin.Timeout) * time.Second
+		ops := []redis.DialOption{
+			redis.DialConnectTimeout(timeout),
+			redis.DialReadTimeout(timeout),
+			redis.DialWriteTimeout(timeout),
+		}
+		if selectDB {
+			ops = append(ops, redis.DialDatabase(plugin.DB))
+		}
+		if plugin.Password != "" {
+			ops = append(ops, redis.DialPassword(plugin.Password))
+		}
+		conn, err := redis.Dial("tcp", addr, ops...)
+		if err != nil {
+			utils.Logger.Warnf("Redis output dial redis %s error %q", addr, err)
+		}
+		return conn, err
+	}
+}
+
+// dialSentinel sentinel has no database and password.
+func (plugin *PluginConfig) dialSentinel(addr string) (redis.Conn, error) {
+	timeout := time.Duration(plugin.Timeout) * time.Second
+	return redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(timeout),
+		redis.DialReadTimeout(timeout),
+		redis.DialWriteTimeout(timeout))
+}
+
+// Process send an event.
 func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	return plugin.ProcessBatch([]utils.LogEvent{ev})
+}
+
+// Batch events of a pipeline and time they wait at most.
+func (plugin *PluginConfig) Batch() (int, time.Duration) {
+	return plugin.BatchCount, time.Duration(plugin.FlushInterval) * time.Millisecond
+}
+
+// ProcessBatch pipeline events to their nodes. An error is returned if any
+// node failed, redirected or is congested, then the whole batch is sent again.
+func (plugin *PluginConfig) ProcessBatch(events []utils.LogEvent) (err error) {
 	var (
-		conn redis.Conn
-		data []byte
-		key  string
+		order  []*redis.Pool
+		groups = map[*redis.Pool][]pipelineItem{}
+		retry  bool
 	)
+	for _, ev := range events {
+		data, eerr := plugin.codec.Encode(ev)
+		if eerr != nil {
+			utils.Logger.Errorf("marshal failed: %v", ev)
+			continue
+		}
+		item := pipelineItem{key: ev.Format(plugin.Key), data: data}
+		p, perr := plugin.router.pool(item.key)
+		if perr != nil {
+			err, retry = perr, true
+			continue
+		}
+		if _, ok := groups[p]; !ok {
+			order = append(order, p)
+		}
+		groups[p] = append(groups[p], item)
+	}
+	for _, p := range order {
+		if gerr := plugin.flushNode(p, groups[p]); gerr != nil {
+			err = gerr
+			if gerr != errCongested {
+				retry = true
+			}
+		}
+	}
+	if retry {
+		plugin.router.refresh()
+	}
+	return
+}
+
+// Stop close connections.
+func (plugin *PluginConfig) Stop() {
+	plugin.router.close()
+}
 
-	if data, err = ev.Marshal(true); err != nil {
-		utils.Logger.Errorf("marshal failed: %v", ev)
+// flushNode pipeline items to a node, an error is returned if any item
+// should be retried.
+func (plugin *PluginConfig) flushNode(p *redis.Pool, items []pipelineItem) (err error) {
+	var (
+		replies []interface{}
+	)
+	conn := p.Get()
+	defer conn.Close()
+	if err = conn.Err(); err != nil {
 		return
 	}
-	// get store key
-	key = ev.Format(plugin.Key)
-	// get a connection
-	conn = plugin.pool.Get()
-	if err = conn.Err(); err != nil {
+	if err = plugin.checkCapacity(conn, items); err != nil {
 		return
 	}
-	defer conn.Close()
 
-	// types
-	switch plugin.DataType {
-	case "list":
-		_, err = conn.Do("rpush", key, data)
-	case "channel":
-		_, err = conn.Do("publish", key, data)
+	for _, item := range items {
+		cmd, args := plugin.command(item)
+		if err = conn.Send(cmd, args...); err != nil {
+			return
+		}
+	}
+	if replies, err = redis.Values(conn.Do("")); err != nil {
+		return
 	}
-	if err != nil {
-		utils.Logger.Warnf("Redis error %q, log lost.", err)
+	for i, reply := range replies {
+		rerr, ok := reply.(redis.Error)
+		if !ok {
+			continue
+		}
+		if retryable(rerr) {
+			err = rerr
+			continue
+		}
+		// command error like WRONGTYPE never success on retry.
+		utils.Logger.Warnf("Redis output key %s error %q, log lost.", items[i].key, rerr)
 	}
 	return
 }
 
-// Stop stop loopEvent goroutine
-func (plugin *PluginConfig) Stop() {
-	plugin.pool.Close()
+// checkCapacity back off if any list is longer than max_list_length.
+func (plugin *PluginConfig) checkCapacity(conn redis.Conn, items []pipelineItem) (err error) {
+	var (
+		length int64
+		keys   = map[string]bool{}
+	)
+	if plugin.DataType != "list" || plugin.MaxListLength <= 0 {
+		return
+	}
+	for _, item := range items {
+		if keys[item.key] {
+			continue
+		}
+		keys[item.key] = true
+		if length, err = redis.Int64(conn.Do("LLEN", item.key)); err != nil {
+			return
+		}
+		if length >= plugin.MaxListLength {
+			utils.Logger.Warnf("Redis output list %s length %d reach %d, back off.",
+				item.key, length, plugin.MaxListLength)
+			return errCongested
+		}
+	}
+	return
+}
+
+// command of data type.
+func (plugin *PluginConfig) command(item pipelineItem) (cmd string, args []interface{}) {
+	switch plugin.DataType {
+	case "channel":
+		return "PUBLISH", []interface{}{item.key, item.data}
+	case "stream":
+		args = []interface{}{item.key}
+		if plugin.StreamMaxLength > 0 {
+			args = append(args, "MAXLEN", "~", fmt.Sprint(plugin.StreamMaxLength))
+		}
+		return "XADD", append(args, "*", plugin.Field, item.data)
+	}
+	return "RPUSH", []interface{}{item.key, item.data}
 }
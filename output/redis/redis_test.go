@@ -1,9 +1,12 @@
 package outputredis
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/garyburd/redigo/redis"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tuhuayuan/go-logagent/utils"
@@ -13,6 +16,58 @@ func init() {
 	utils.RegistOutputHandler(PluginName, InitHandler)
 }
 
+// fakeConn record commands, LLEN reply length.
+type fakeConn struct {
+	sync.Mutex
+	length   int64
+	commands []string
+	pending  int
+}
+
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Err() error   { return nil }
+func (c *fakeConn) Flush() error { return nil }
+
+func (c *fakeConn) Receive() (interface{}, error) { return nil, nil }
+
+func (c *fakeConn) Send(cmd string, args ...interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+	c.commands = append(c.commands, fmt.Sprintf("%s %s", cmd, args))
+	c.pending++
+	return nil
+}
+
+func (c *fakeConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	switch cmd {
+	case "":
+		replies := make([]interface{}, c.pending)
+		c.pending = 0
+		return replies, nil
+	case "LLEN":
+		return c.length, nil
+	}
+	return "OK", nil
+}
+
+func (c *fakeConn) sent() []string {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string{}, c.commands...)
+}
+
+func fakePlugin(t *testing.T, part utils.ConfigPart) (*PluginConfig, *fakeConn) {
+	plugin, err := InitHandler(&part)
+	assert.NoError(t, err)
+	conn := &fakeConn{}
+	plugin.router = newStandaloneRouter("fake", func(addr string) (redis.Conn, error) {
+		return conn, nil
+	})
+	return plugin, conn
+}
+
 func Test_All(t *testing.T) {
 	plugin, err := utils.LoadFromString(`{
 		"output": [{
@@ -42,3 +97,68 @@ func Test_All(t *testing.T) {
 	err = plugin.StopOutputs()
 	assert.NoError(t, err)
 }
+
+func Test_Pipeline(t *testing.T) {
+	plugin, conn := fakePlugin(t, utils.ConfigPart{
+		"key":         "log-${app}",
+		"batch_count": 2,
+	})
+	ev := utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC),
+		Message:   "hello",
+		Extra:     map[string]interface{}{"app": "web"},
+	}
+	count, interval := plugin.Batch()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, time.Second, interval)
+
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{ev, ev}))
+	// compact json.
+	data := `{"@timestamp":"2017-05-01T08:00:00","app":"web","message":"hello"}`
+	assert.Equal(t, []string{"RPUSH [log-web " + data + "]", "RPUSH [log-web " + data + "]"}, conn.sent())
+
+	// a single event is sent before Process returns.
+	assert.NoError(t, plugin.Process(ev))
+	assert.Len(t, conn.sent(), 3)
+	plugin.Stop()
+}
+
+func Test_Stream(t *testing.T) {
+	plugin, conn := fakePlugin(t, utils.ConfigPart{
+		"key":               "log",
+		"data_type":         "stream",
+		"stream_max_length": 1000,
+	})
+	ev := utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC),
+		Message:   "hello",
+		Extra:     map[string]interface{}{},
+	}
+	assert.NoError(t, plugin.Process(ev))
+	plugin.Stop()
+	assert.Equal(t, []string{`XADD [log MAXLEN ~ 1000 * event {"@timestamp":"2017-05-01T08:00:00","message":"hello"}]`}, conn.sent())
+
+	_, err := InitHandler(&utils.ConfigPart{"key": "log", "data_type": "set"})
+	assert.Error(t, err)
+}
+
+func Test_Congested(t *testing.T) {
+	plugin, conn := fakePlugin(t, utils.ConfigPart{
+		"key":             "log",
+		"batch_count":     1,
+		"max_list_length": 100,
+	})
+	conn.length = 100
+	ev := utils.LogEvent{Message: "hello", Extra: map[string]interface{}{}}
+	// nothing is sent, events stay in disk queue.
+	assert.Equal(t, errCongested, plugin.Process(ev))
+	assert.Equal(t, errCongested, plugin.ProcessBatch([]utils.LogEvent{ev, ev}))
+	assert.Len(t, conn.sent(), 0)
+
+	conn.Lock()
+	conn.length = 99
+	conn.Unlock()
+	assert.NoError(t, plugin.ProcessBatch([]utils.LogEvent{ev, ev}))
+	assert.Len(t, conn.sent(), 2)
+	plugin.Stop()
+}
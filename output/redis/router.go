@@ -0,0 +1,345 @@
+package outputredis
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+// router find the pool a key belongs to.
+type router interface {
+	pool(key string) (*redis.Pool, error)
+	refresh() // called after connection error or redirection
+	close()
+}
+
+// dialFunc dial a redis node.
+type dialFunc func(addr string) (redis.Conn, error)
+
+// newPool pool of a node, dial is called for every new connection.
+func newPool(dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     16,
+		MaxActive:   16,
+		IdleTimeout: 60 * time.Second,
+		Dial:        dial,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// standaloneRouter a single node.
+type standaloneRouter struct {
+	p *redis.Pool
+}
+
+func newStandaloneRouter(addr string, dial dialFunc) *standaloneRouter {
+	return &standaloneRouter{
+		p: newPool(func() (redis.Conn, error) {
+			return dial(addr)
+		}),
+	}
+}
+
+func (r *standaloneRouter) pool(key string) (*redis.Pool, error) {
+	return r.p, nil
+}
+
+func (r *standaloneRouter) refresh() {
+}
+
+func (r *standaloneRouter) close() {
+	r.p.Close()
+}
+
+// sentinelRouter master discovered by sentinels, resolved again on every dial.
+type sentinelRouter struct {
+	sentinels  []string
+	masterName string
+	dial       dialFunc
+	dialNode   dialFunc
+	p          *redis.Pool // nil if closed
+	lock       *sync.Mutex
+}
+
+func newSentinelRouter(sentinels []string, masterName string, dialSentinel dialFunc, dial dialFunc) *sentinelRouter {
+	r := &sentinelRouter{
+		sentinels:  sentinels,
+		masterName: masterName,
+		dial:       dialSentinel,
+		dialNode:   dial,
+		lock:       &sync.Mutex{},
+	}
+	r.p = newPool(r.dialMaster)
+	return r
+}
+
+// master ask sentinels in turn.
+func (r *sentinelRouter) master() (addr string, err error) {
+	r.lock.Lock()
+	sentinels := append([]string{}, r.sentinels...)
+	r.lock.Unlock()
+	for _, sentinel := range sentinels {
+		var (
+			conn  redis.Conn
+			reply []string
+		)
+		if conn, err = r.dial(sentinel); err != nil {
+			continue
+		}
+		reply, err = redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", r.masterName))
+		conn.Close()
+		if err == nil && len(reply) == 2 {
+			r.prefer(sentinel)
+			return net.JoinHostPort(reply[0], reply[1]), nil
+		}
+		if err == nil || err == redis.ErrNil {
+			err = errors.New("sentinel " + sentinel + " knows no master " + r.masterName)
+		}
+	}
+	if err == nil {
+		err = errors.New("no sentinel configed")
+	}
+	return
+}
+
+// prefer the sentinel answered next time.
+func (r *sentinelRouter) prefer(sentinel string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range r.sentinels {
+		if r.sentinels[i] == sentinel {
+			r.sentinels[0], r.sentinels[i] = r.sentinels[i], r.sentinels[0]
+			return
+		}
+	}
+}
+
+// dialMaster dial the master, make sure its role during failover.
+func (r *sentinelRouter) dialMaster() (conn redis.Conn, err error) {
+	var (
+		addr string
+		role []interface{}
+	)
+	if addr, err = r.master(); err != nil {
+		return
+	}
+	if conn, err = r.dialNode(addr); err != nil {
+		return
+	}
+	if role, err = redis.Values(conn.Do("ROLE")); err == nil && len(role) > 0 {
+		if name, _ := redis.String(role[0], nil); name != "master" {
+			err = errors.New("redis " + addr + " is " + name + " not master")
+		}
+	}
+	if err != nil {
+		conn.Close()
+		conn = nil
+	}
+	return
+}
+
+func (r *sentinelRouter) pool(key string) (*redis.Pool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.p == nil {
+		return nil, errors.New("redis sentinel router closed")
+	}
+	return r.p, nil
+}
+
+// refresh drop connections to the old master, nothing to do if closed.
+func (r *sentinelRouter) refresh() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.p == nil {
+		return
+	}
+	r.p.Close()
+	r.p = newPool(r.dialMaster)
+}
+
+func (r *sentinelRouter) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.p != nil {
+		r.p.Close()
+		r.p = nil
+	}
+}
+
+// clusterSlots count of redis cluster hash slots.
+const clusterSlots = 16384
+
+// clusterRouter route keys by hash slot.
+type clusterRouter struct {
+	seeds []string
+	dial  dialFunc
+	slots [clusterSlots]string
+	pools map[string]*redis.Pool
+	lock  *sync.Mutex
+}
+
+func newClusterRouter(seeds []string, dial dialFunc) *clusterRouter {
+	r := &clusterRouter{
+		seeds: seeds,
+		dial:  dial,
+		pools: map[string]*redis.Pool{},
+		lock:  &sync.Mutex{},
+	}
+	r.refresh()
+	return r
+}
+
+// refresh load slots from any known node by CLUSTER SLOTS.
+func (r *clusterRouter) refresh() {
+	var (
+		err   error
+		nodes = append([]string{}, r.seeds...)
+	)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for addr := range r.pools {
+		nodes = append(nodes, addr)
+	}
+	for _, addr := range nodes {
+		var (
+			conn  redis.Conn
+			reply []interface{}
+		)
+		if conn, err = r.dial(addr); err != nil {
+			continue
+		}
+		reply, err = redis.Values(conn.Do("CLUSTER", "SLOTS"))
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		if err = r.load(reply); err == nil {
+			return
+		}
+	}
+	utils.Logger.Warnf("Redis cluster slots refresh error %q", err)
+}
+
+// load [[start, end, [host, port, ...], replicas...], ...], lock held.
+func (r *clusterRouter) load(reply []interface{}) (err error) {
+	var (
+		slots [clusterSlots]string
+		used  = map[string]bool{}
+	)
+	for _, item := range reply {
+		var (
+			fields     []interface{}
+			node       []interface{}
+			start, end int
+			host       string
+			port       int
+		)
+		if fields, err = redis.Values(item, nil); err != nil || len(fields) < 3 {
+			return errors.New("redis cluster slots reply invalid")
+		}
+		if start, err = redis.Int(fields[0], nil); err != nil {
+			return
+		}
+		if end, err = redis.Int(fields[1], nil); err != nil {
+			return
+		}
+		if node, err = redis.Values(fields[2], nil); err != nil || len(node) < 2 {
+			return errors.New("redis cluster slots node invalid")
+		}
+		if host, err = redis.String(node[0], nil); err != nil {
+			return
+		}
+		if port, err = redis.Int(node[1], nil); err != nil {
+			return
+		}
+		if start < 0 || end >= clusterSlots || start > end {
+			return errors.New("redis cluster slots range invalid")
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		used[addr] = true
+		for i := start; i <= end; i++ {
+			slots[i] = addr
+		}
+	}
+	r.slots = slots
+	// nodes left the cluster.
+	for addr, p := range r.pools {
+		if !used[addr] {
+			p.Close()
+			delete(r.pools, addr)
+		}
+	}
+	return nil
+}
+
+func (r *clusterRouter) pool(key string) (*redis.Pool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	addr := r.slots[slot(key)]
+	if addr == "" {
+		return nil, errors.New("redis cluster slot of " + key + " not served")
+	}
+	p, ok := r.pools[addr]
+	if !ok {
+		p = newPool(func() (redis.Conn, error) {
+			return r.dial(addr)
+		})
+		r.pools[addr] = p
+	}
+	return p, nil
+}
+
+func (r *clusterRouter) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for addr, p := range r.pools {
+		p.Close()
+		delete(r.pools, addr)
+	}
+}
+
+// slot of key, only the hash tag inside {} is hashed if present.
+func slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16([]byte(key)) % clusterSlots)
+}
+
+// crc16 CCITT XMODEM used by redis cluster.
+func crc16(data []byte) (crc uint16) {
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return
+}
+
+// retryable redirection and failover errors, the command will success later.
+func retryable(err redis.Error) bool {
+	for _, prefix := range []string{"MOVED ", "ASK ", "TRYAGAIN", "CLUSTERDOWN", "READONLY", "LOADING"} {
+		if strings.HasPrefix(string(err), prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+package outputredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+// fakeError reply of fake server.
+type fakeError string
+
+// fakeServer speak RESP, reply by handler.
+type fakeServer struct {
+	listener net.Listener
+	host     string
+	port     int64
+	lock     sync.Mutex
+	handler  func(args []string) interface{}
+	commands []string
+}
+
+func newFakeServer(t *testing.T, handler func(args []string) interface{}) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &fakeServer{
+		listener: listener,
+		host:     addr.IP.String(),
+		port:     int64(addr.Port),
+		handler:  handler,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) addr() string {
+	return net.JoinHostPort(s.host, strconv.FormatInt(s.port, 10))
+}
+
+func (s *fakeServer) setHandler(handler func(args []string) interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handler = handler
+}
+
+// received commands except PING.
+func (s *fakeServer) received(prefix string) (commands []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, cmd := range s.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			commands = append(commands, cmd)
+		}
+	}
+	return
+}
+
+func (s *fakeServer) close() {
+	s.listener.Close()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		if args[0] != "PING" {
+			s.commands = append(s.commands, strings.Join(args, " "))
+		}
+		handler := s.handler
+		s.lock.Unlock()
+
+		var reply interface{} = "OK"
+		if args[0] == "PING" {
+			reply = "PONG"
+		} else if handler != nil {
+			reply = handler(args)
+		}
+		if _, err = conn.Write(writeReply(nil, reply)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) (args []string, err error) {
+	var (
+		line string
+		n    int
+	)
+	if line, err = reader.ReadString('\n'); err != nil {
+		return
+	}
+	if n, err = strconv.Atoi(strings.TrimSpace(line[1:])); err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		var size int
+		if line, err = reader.ReadString('\n'); err != nil {
+			return
+		}
+		if size, err = strconv.Atoi(strings.TrimSpace(line[1:])); err != nil {
+			return
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return
+		}
+		args = append(args, string(data[:size]))
+	}
+	return
+}
+
+func writeReply(buf []byte, reply interface{}) []byte {
+	switch v := reply.(type) {
+	case nil:
+		return append(buf, "$-1\r\n"...)
+	case string:
+		return append(buf, "+"+v+"\r\n"...)
+	case fakeError:
+		return append(buf, "-"+string(v)+"\r\n"...)
+	case int:
+		return append(buf, fmt.Sprintf(":%d\r\n", v)...)
+	case int64:
+		return append(buf, fmt.Sprintf(":%d\r\n", v)...)
+	case []byte:
+		return append(buf, fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)...)
+	case []interface{}:
+		buf = append(buf, fmt.Sprintf("*%d\r\n", len(v))...)
+		for _, item := range v {
+			buf = writeReply(buf, item)
+		}
+	}
+	return buf
+}
+
+func Test_Slot(t *testing.T) {
+	assert.Equal(t, 12182, slot("foo"))
+	assert.Equal(t, 5061, slot("bar"))
+	assert.Equal(t, slot("user1000"), slot("{user1000}.following"))
+	assert.Equal(t, slot("{user1000}.followers"), slot("{user1000}.following"))
+	// empty hash tag, the whole key is hashed.
+	assert.NotEqual(t, slot("{}foo"), slot("foo"))
+}
+
+func Test_Sentinel(t *testing.T) {
+	master := func(args []string) interface{} {
+		switch args[0] {
+		case "ROLE":
+			return []interface{}{[]byte("master"), int64(0), []interface{}{}}
+		case "RPUSH":
+			return int64(1)
+		}
+		return "OK"
+	}
+	nodeA := newFakeServer(t, master)
+	defer nodeA.close()
+	nodeB := newFakeServer(t, master)
+	defer nodeB.close()
+
+	current := nodeA
+	lock := sync.Mutex{}
+	sentinel := newFakeServer(t, func(args []string) interface{} {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(args) == 3 && args[1] == "get-master-addr-by-name" && args[2] == "mymaster" {
+			return []interface{}{[]byte(current.host), []byte(strconv.FormatInt(current.port, 10))}
+		}
+		return nil
+	})
+	defer sentinel.close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"mode":        "sentinel",
+		"sentinels":   []string{"127.0.0.1:1", sentinel.addr()},
+		"master_name": "mymaster",
+		"key":         "log",
+		"batch_count": 1,
+	})
+	assert.NoError(t, err)
+	ev := utils.LogEvent{Message: "hello", Extra: map[string]interface{}{}}
+	assert.NoError(t, plugin.Process(ev))
+	assert.Len(t, nodeA.received("RPUSH"), 1)
+
+	// failover, the old master is a replica now.
+	lock.Lock()
+	current = nodeB
+	lock.Unlock()
+	nodeA.setHandler(func(args []string) interface{} {
+		switch args[0] {
+		case "ROLE":
+			return []interface{}{[]byte("slave"), []byte("127.0.0.1"), int64(6379), []byte("connected"), int64(0)}
+		case "RPUSH":
+			return fakeError("READONLY You can't write against a read only replica.")
+		}
+		return "OK"
+	})
+	// rejected event is sent again to the new master.
+	assert.Error(t, plugin.Process(ev))
+	assert.NoError(t, plugin.Process(ev))
+	plugin.Stop()
+	assert.Len(t, nodeA.received("RPUSH"), 2)
+	assert.Len(t, nodeB.received("RPUSH"), 1)
+
+	_, err = InitHandler(&utils.ConfigPart{"mode": "sentinel", "key": "log"})
+	assert.Error(t, err)
+}
+
+func Test_SentinelClose(t *testing.T) {
+	dial := func(addr string) (redis.Conn, error) {
+		return nil, errors.New("unreachable")
+	}
+	r := newSentinelRouter([]string{"a", "b"}, "mymaster", dial, dial)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.refresh()
+				r.pool("log")
+			}
+		}()
+	}
+	r.close()
+	wg.Wait()
+	// no pool is created after close.
+	_, err := r.pool("log")
+	assert.Error(t, err)
+	r.refresh()
+	assert.Nil(t, r.p)
+	r.close()
+}
+
+func Test_Cluster(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		slots []interface{}
+	)
+	handler := func(args []string) interface{} {
+		switch args[0] {
+		case "CLUSTER":
+			lock.Lock()
+			defer lock.Unlock()
+			return slots
+		case "RPUSH":
+			return int64(1)
+		}
+		return "OK"
+	}
+	nodeA := newFakeServer(t, handler)
+	defer nodeA.close()
+	nodeB := newFakeServer(t, handler)
+	defer nodeB.close()
+	slots = []interface{}{
+		[]interface{}{int64(0), int64(8191), []interface{}{[]byte(nodeA.host), nodeA.port, []byte("a")}},
+		[]interface{}{int64(8192), int64(16383), []interface{}{[]byte(nodeB.host), nodeB.port, []byte("b")}},
+	}
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"mode":        "cluster",
+		"hosts":       []string{"127.0.0.1:1", nodeB.addr()},
+		"key":         "${key}",
+		"batch_count": 2,
+	})
+	assert.NoError(t, err)
+	for _, key := range []string{"bar", "foo"} {
+		assert.NoError(t, plugin.Process(utils.LogEvent{Message: key, Extra: map[string]interface{}{"key": key}}))
+	}
+	assert.Equal(t, []string{`RPUSH bar {"@timestamp":"0001-01-01T00:00:00","key":"bar","message":"bar"}`},
+		nodeA.received("RPUSH"))
+	assert.Len(t, nodeB.received("RPUSH foo"), 1)
+
+	// slot of foo moved to node A.
+	lock.Lock()
+	slots = []interface{}{
+		[]interface{}{int64(0), int64(16383), []interface{}{[]byte(nodeA.host), nodeA.port, []byte("a")}},
+	}
+	lock.Unlock()
+	nodeB.setHandler(func(args []string) interface{} {
+		if args[0] == "RPUSH" {
+			return fakeError("MOVED 12182 " + nodeA.addr())
+		}
+		return handler(args)
+	})
+	// redirected event is sent again after slots refreshed.
+	ev := utils.LogEvent{Message: "foo", Extra: map[string]interface{}{"key": "foo"}}
+	assert.Error(t, plugin.Process(ev))
+	assert.NoError(t, plugin.Process(ev))
+	plugin.Stop()
+	assert.Len(t, nodeA.received("RPUSH foo"), 1)
+	assert.Len(t, nodeB.received("RPUSH foo"), 2)
+}
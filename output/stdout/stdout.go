@@ -2,6 +2,7 @@ package outputstdout
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/tuhuayuan/go-logagent/utils"
 )
@@ -14,6 +15,9 @@ const (
 // PluginConfig struct of this plugin.
 type PluginConfig struct {
 	utils.OutputPluginConfig
+	utils.CodecConfig
+
+	codec utils.Codec
 }
 
 func init() {
@@ -34,17 +38,20 @@ func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
 		utils.Logger.Errorf("Patch output plugin create error %q", err)
 		return
 	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json", "indent": true}); err != nil {
+		return
+	}
 	plugin = &conf
 	return
 }
 
 // Process fluch event to stdout
 func (plugin *PluginConfig) Process(event utils.LogEvent) (err error) {
-	data, err := event.Marshal(true)
+	data, err := plugin.codec.Encode(event)
 	if err != nil {
 		return
 	}
-	fmt.Println("\n", string(data))
+	fmt.Println(strings.TrimSuffix(string(data), "\n"))
 	return
 }
 
@@ -0,0 +1,250 @@
+package outputsyslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "syslog"
+)
+
+var (
+	facilities = map[string]int{
+		"kern": 0, "kernel": 0, "user": 1, "user-level": 1, "mail": 2, "daemon": 3,
+		"auth": 4, "security": 4, "syslog": 5, "syslogd": 5, "lpr": 6, "news": 7,
+		"uucp": 8, "cron": 9, "clock": 9, "authpriv": 10, "ftp": 11, "ntp": 12,
+		"audit": 13, "alert": 14, "local0": 16, "local1": 17, "local2": 18,
+		"local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+	severities = map[string]int{
+		"emerg": 0, "emergency": 0, "panic": 0, "alert": 1, "crit": 2, "critical": 2,
+		"err": 3, "error": 3, "warn": 4, "warning": 4, "notice": 5, "info": 6,
+		"informational": 6, "debug": 7,
+	}
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Host           string `json:"host"`             // collector address, default 127.0.0.1:514
+	Protocol       string `json:"protocol"`         // udp or tcp, default udp
+	Framing        string `json:"framing"`          // tcp framing, newline or octet_counted, default octet_counted
+	Format         string `json:"format"`           // rfc3164 or rfc5424, default rfc5424
+	Facility       string `json:"facility"`         // name, number or format, ex: ${facility}, default user
+	Severity       string `json:"severity"`         // name, number or format, ex: ${level}, default informational
+	Hostname       string `json:"hostname"`         // hostname format, default os hostname
+	AppName        string `json:"app_name"`         // app name or tag format, default logagent
+	ProcID         string `json:"proc_id"`          // rfc5424 procid or rfc3164 pid format
+	MsgID          string `json:"msg_id"`           // rfc5424 msgid format
+	MaxMessageSize int    `json:"max_message_size"` // bytes of a message at most, default 2048 for udp, 0 is unlimited
+	Timeout        int    `json:"timeout"`          // seconds of dial and write, default 5
+
+	hostname string
+	facility int
+	severity int
+	codec    utils.Codec
+	writer   *utils.NetWriter
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	var (
+		tlsConfig *tls.Config
+	)
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Host == "" {
+		conf.Host = "127.0.0.1:514"
+	}
+	if conf.Protocol == "" {
+		conf.Protocol = "udp"
+	}
+	if conf.Protocol != "udp" && conf.Protocol != "tcp" {
+		err = errors.New("syslog protocol must be udp or tcp")
+		return
+	}
+	if conf.Framing == "" {
+		conf.Framing = "octet_counted"
+	}
+	if conf.Format == "" {
+		conf.Format = "rfc5424"
+	}
+	if conf.Format != "rfc3164" && conf.Format != "rfc5424" {
+		err = errors.New("syslog format must be rfc3164 or rfc5424")
+		return
+	}
+	if conf.facility, err = parseCode(conf.Facility, facilities, 1, 23); err != nil {
+		return
+	}
+	if conf.severity, err = parseCode(conf.Severity, severities, 6, 7); err != nil {
+		return
+	}
+	if conf.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	if conf.AppName == "" {
+		conf.AppName = "logagent"
+	}
+	if conf.MaxMessageSize == 0 && conf.Protocol == "udp" {
+		conf.MaxMessageSize = 2048
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "plain"}); err != nil {
+		return
+	}
+	if tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	if conf.writer, err = utils.NewNetWriter(conf.Protocol, conf.Host, conf.Framing,
+		time.Duration(conf.Timeout)*time.Second, tlsConfig); err != nil {
+		return
+	}
+	plugin = &conf
+	return
+}
+
+// parseCode name or number of facility or severity, a format is resolved
+// by every event and def is used if the setting is empty.
+func parseCode(setting string, names map[string]int, def int, max int) (code int, err error) {
+	if setting == "" || strings.Contains(setting, "${") {
+		return def, nil
+	}
+	if code, ok := names[strings.ToLower(setting)]; ok {
+		return code, nil
+	}
+	if code, err = strconv.Atoi(setting); err != nil || code < 0 || code > max {
+		err = errors.New("syslog facility or severity invalid " + setting)
+	}
+	return
+}
+
+// Process send event as a syslog message.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		msg []byte
+	)
+	if msg, err = plugin.codec.Encode(ev); err != nil {
+		utils.Logger.Errorf("Syslog output encode failed %s: %v", err, ev)
+		return nil
+	}
+	data := plugin.message(ev, msg)
+	if plugin.MaxMessageSize > 0 && len(data) > plugin.MaxMessageSize {
+		data = data[:plugin.MaxMessageSize]
+	}
+	if err = plugin.writer.Write(data); err != nil {
+		utils.Logger.Warnf("Syslog output %s error %s", plugin.Host, err)
+	}
+	return
+}
+
+// Stop close connection.
+func (plugin *PluginConfig) Stop() {
+	plugin.writer.Close()
+}
+
+// message format header and msg.
+func (plugin *PluginConfig) message(ev utils.LogEvent, msg []byte) []byte {
+	var (
+		data []byte
+	)
+	pri := plugin.code(ev, plugin.Facility, facilities, plugin.facility, 23)*8 +
+		plugin.code(ev, plugin.Severity, severities, plugin.severity, 7)
+	timestamp := ev.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	hostname := plugin.field(ev, plugin.Hostname, plugin.hostname, 255)
+	appName := plugin.field(ev, plugin.AppName, "logagent", 48)
+	procID := plugin.field(ev, plugin.ProcID, "", 128)
+
+	data = append(data, '<')
+	data = strconv.AppendInt(data, int64(pri), 10)
+	data = append(data, '>')
+	if plugin.Format == "rfc3164" {
+		// tag is 32 characters at most.
+		if len(appName) > 32 {
+			appName = appName[:32]
+		}
+		data = append(data, timestamp.Format(time.Stamp)...)
+		data = append(data, ' ')
+		data = append(data, hostname...)
+		data = append(data, ' ')
+		data = append(data, appName...)
+		if procID != "" {
+			data = append(data, '[')
+			data = append(data, procID...)
+			data = append(data, ']')
+		}
+		data = append(data, ": "...)
+	} else {
+		data = append(data, "1 "...)
+		data = append(data, timestamp.Format("2006-01-02T15:04:05.000000Z07:00")...)
+		for _, value := range []string{hostname, appName, procID, plugin.field(ev, plugin.MsgID, "", 32)} {
+			if value == "" {
+				value = "-"
+			}
+			data = append(data, ' ')
+			data = append(data, value...)
+		}
+		// no structured data.
+		data = append(data, " - "...)
+	}
+	return append(data, strings.TrimRight(string(msg), "\r\n")...)
+}
+
+// code facility or severity of event, def if the format is not resolved.
+func (plugin *PluginConfig) code(ev utils.LogEvent, setting string, names map[string]int, def int, max int) int {
+	if !strings.Contains(setting, "${") {
+		return def
+	}
+	value := ev.Format(setting)
+	if code, ok := names[strings.ToLower(value)]; ok {
+		return code
+	}
+	if code, err := strconv.Atoi(value); err == nil && code >= 0 && code <= max {
+		return code
+	}
+	return def
+}
+
+// field format header field, printable ascii without space, def if empty or not resolved.
+func (plugin *PluginConfig) field(ev utils.LogEvent, setting string, def string, max int) string {
+	value := ev.Format(setting)
+	if value == "" || strings.Contains(value, "${") {
+		value = def
+	}
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(value) > max {
+		value = value[:max]
+	}
+	return value
+}
@@ -0,0 +1,109 @@
+package outputsyslog
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func newEvent(extra map[string]interface{}) utils.LogEvent {
+	return utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 123456000, time.UTC),
+		Message:   "disk full\n",
+		Extra:     extra,
+	}
+}
+
+func Test_Message(t *testing.T) {
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"facility": "${facility}",
+		"severity": "${level}",
+		"hostname": "${host}",
+		"app_name": "${app}",
+		"proc_id":  "${pid}",
+		"msg_id":   "ALERT",
+	})
+	assert.NoError(t, err)
+	ev := newEvent(map[string]interface{}{
+		"facility": "local4", "level": "WARN", "host": "web-1", "app": "my app", "pid": 42,
+	})
+	assert.Equal(t, "<164>1 2017-05-01T08:00:00.123456Z web-1 my_app 42 ALERT - disk full",
+		string(plugin.message(ev, []byte(ev.Message))))
+	// fields absent, defaults used.
+	ev = newEvent(map[string]interface{}{"facility": 99, "level": 3})
+	assert.Equal(t, "<11>1 2017-05-01T08:00:00.123456Z "+plugin.hostname+" logagent - ALERT - disk full",
+		string(plugin.message(ev, []byte(ev.Message))))
+
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"format":   "rfc3164",
+		"facility": "auth",
+		"severity": "2",
+		"hostname": "web-1",
+		"proc_id":  "${pid}",
+	})
+	assert.NoError(t, err)
+	ev = newEvent(map[string]interface{}{"pid": 42})
+	assert.Equal(t, "<34>May  1 08:00:00 web-1 logagent[42]: disk full",
+		string(plugin.message(ev, []byte(ev.Message))))
+	ev = newEvent(map[string]interface{}{})
+	assert.Equal(t, "<34>May  1 08:00:00 web-1 logagent: disk full",
+		string(plugin.message(ev, []byte(ev.Message))))
+
+	for _, part := range []utils.ConfigPart{
+		{"format": "cef"},
+		{"protocol": "http"},
+		{"facility": "nobody"},
+		{"severity": "8"},
+	} {
+		_, err = InitHandler(&part)
+		assert.Error(t, err)
+	}
+}
+
+func Test_Process(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":             conn.LocalAddr().String(),
+		"format":           "rfc3164",
+		"hostname":         "web-1",
+		"max_message_size": 40,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent(map[string]interface{}{})))
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "<14>May  1 08:00:00 web-1 logagent: disk", string(buf[:n]))
+	plugin.Stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"host":     listener.Addr().String(),
+		"protocol": "tcp",
+		"hostname": "web-1",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(newEvent(map[string]interface{}{})))
+	server, err := listener.Accept()
+	assert.NoError(t, err)
+	defer server.Close()
+	fr, _ := utils.NewFrameReader(server, "octet_counted", 0)
+	frame, err := fr.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, "<14>1 2017-05-01T08:00:00.123456Z web-1 logagent - - - disk full", string(frame))
+	plugin.Stop()
+}
@@ -0,0 +1,87 @@
+package outputtcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "tcp"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	utils.TLSConfig
+	Host    string `json:"host"`    // peer address
+	Framing string `json:"framing"` // newline or octet_counted, default newline
+	Timeout int    `json:"timeout"` // seconds of dial and write, default 5
+
+	codec  utils.Codec
+	writer *utils.NetWriter
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	var (
+		tlsConfig *tls.Config
+	)
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Host == "" {
+		err = errors.New("tcp output host required")
+		return
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
+	if tlsConfig, err = conf.ClientTLS(); err != nil {
+		return
+	}
+	if conf.writer, err = utils.NewNetWriter("tcp", conf.Host, conf.Framing,
+		time.Duration(conf.Timeout)*time.Second, tlsConfig); err != nil {
+		return
+	}
+	plugin = &conf
+	return
+}
+
+// Process send event, reconnect if the connection is broken.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = plugin.codec.Encode(ev); err != nil {
+		utils.Logger.Errorf("Tcp output encode failed %s: %v", err, ev)
+		return nil
+	}
+	if err = plugin.writer.Write(data); err != nil {
+		utils.Logger.Warnf("Tcp output %s error %s", plugin.Host, err)
+	}
+	return
+}
+
+// Stop close connection.
+func (plugin *PluginConfig) Stop() {
+	plugin.writer.Close()
+}
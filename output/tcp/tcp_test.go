@@ -0,0 +1,70 @@
+package outputtcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func Test_Process(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := make(chan string, 10)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				fr, _ := utils.NewFrameReader(conn, "newline", 0)
+				for {
+					frame, err := fr.ReadFrame()
+					if err != nil {
+						return
+					}
+					frames <- string(frame)
+				}
+			}()
+		}
+	}()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":  listener.Addr().String(),
+		"codec": "json_lines",
+	})
+	assert.NoError(t, err)
+	ev := utils.LogEvent{
+		Timestamp: time.Date(2017, 5, 1, 8, 0, 0, 0, time.UTC),
+		Message:   "hello",
+		Extra:     map[string]interface{}{},
+	}
+	assert.NoError(t, plugin.Process(ev))
+	assert.Equal(t, `{"@timestamp":"2017-05-01T08:00:00","message":"hello"}`, <-frames)
+
+	// collector restarted.
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, plugin.Process(ev))
+	assert.Equal(t, `{"@timestamp":"2017-05-01T08:00:00","message":"hello"}`, <-frames)
+	plugin.Stop()
+
+	_, err = InitHandler(&utils.ConfigPart{"host": "127.0.0.1:1", "framing": "auto"})
+	assert.Error(t, err)
+	_, err = InitHandler(&utils.ConfigPart{})
+	assert.Error(t, err)
+	plugin, err = InitHandler(&utils.ConfigPart{"host": "127.0.0.1:1"})
+	assert.NoError(t, err)
+	assert.Error(t, plugin.Process(ev))
+}
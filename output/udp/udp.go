@@ -0,0 +1,104 @@
+package outputudp
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+const (
+	// PluginName name of this plugin.
+	PluginName = "udp"
+)
+
+// PluginConfig config struct.
+type PluginConfig struct {
+	utils.OutputPluginConfig
+	utils.CodecConfig
+	Host     string `json:"host"`     // peer address
+	MaxSize  int    `json:"max_size"` // bytes of a datagram at most, default 1472 fit in an ethernet frame
+	Oversize string `json:"oversize"` // drop or truncate larger datagram, default drop, truncated json is invalid
+	Timeout  int    `json:"timeout"`  // seconds of write, default 5
+
+	codec  utils.Codec
+	writer *utils.NetWriter
+}
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+// InitHandler create plugin.
+func InitHandler(part *utils.ConfigPart) (plugin *PluginConfig, err error) {
+	conf := PluginConfig{
+		OutputPluginConfig: utils.OutputPluginConfig{
+			TypePluginConfig: utils.TypePluginConfig{
+				Type: PluginName,
+			},
+		},
+	}
+	if err = utils.ReflectConfigPart(part, &conf); err != nil {
+		return
+	}
+	if conf.Host == "" {
+		err = errors.New("udp output host required")
+		return
+	}
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = 1472
+	}
+	if conf.MaxSize > 65507 {
+		err = errors.New("udp max_size is 65507 at most")
+		return
+	}
+	if conf.Oversize == "" {
+		conf.Oversize = "drop"
+	}
+	if conf.Oversize != "truncate" && conf.Oversize != "drop" {
+		err = errors.New("udp oversize must be drop or truncate")
+		return
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.codec, err = conf.NewCodec(utils.ConfigPart{"type": "json"}); err != nil {
+		return
+	}
+	if conf.writer, err = utils.NewNetWriter("udp", conf.Host, "",
+		time.Duration(conf.Timeout)*time.Second, nil); err != nil {
+		return
+	}
+	plugin = &conf
+	return
+}
+
+// Process send event in a datagram.
+func (plugin *PluginConfig) Process(ev utils.LogEvent) (err error) {
+	var (
+		data []byte
+	)
+	if data, err = plugin.codec.Encode(ev); err != nil {
+		utils.Logger.Errorf("Udp output encode failed %s: %v", err, ev)
+		return nil
+	}
+	if len(data) > plugin.MaxSize {
+		// retry will never succeed.
+		if plugin.Oversize == "drop" {
+			utils.Logger.Warnf("Udp output datagram of %d bytes dropped", len(data))
+			return nil
+		}
+		// a truncated json is not valid, only a prefix for plain text peers.
+		utils.Logger.Warnf("Udp output datagram of %d bytes truncated", len(data))
+		data = data[:plugin.MaxSize]
+	}
+	if err = plugin.writer.Write(data); err != nil {
+		utils.Logger.Warnf("Udp output %s error %s", plugin.Host, err)
+	}
+	return
+}
+
+// Stop close socket.
+func (plugin *PluginConfig) Stop() {
+	plugin.writer.Close()
+}
@@ -0,0 +1,59 @@
+package outputudp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+func init() {
+	utils.RegistOutputHandler(PluginName, InitHandler)
+}
+
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	return string(buf[:n])
+}
+
+func Test_Process(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	plugin, err := InitHandler(&utils.ConfigPart{
+		"host":     conn.LocalAddr().String(),
+		"codec":    "plain",
+		"max_size": 8,
+		"oversize": "truncate",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "hello"}))
+	assert.Equal(t, "hello", readDatagram(t, conn))
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "hello world"}))
+	assert.Equal(t, "hello wo", readDatagram(t, conn))
+	plugin.Stop()
+
+	// dropped by default.
+	plugin, err = InitHandler(&utils.ConfigPart{
+		"host":     conn.LocalAddr().String(),
+		"codec":    "plain",
+		"max_size": 8,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "hello world"}))
+	assert.NoError(t, plugin.Process(utils.LogEvent{Message: "next"}))
+	assert.Equal(t, "next", readDatagram(t, conn))
+	plugin.Stop()
+
+	_, err = InitHandler(&utils.ConfigPart{"host": "127.0.0.1:1", "max_size": 70000})
+	assert.Error(t, err)
+	_, err = InitHandler(&utils.ConfigPart{"host": "127.0.0.1:1", "oversize": "split"})
+	assert.Error(t, err)
+}
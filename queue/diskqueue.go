@@ -23,6 +23,7 @@ import (
 type Queue interface {
 	Put([]byte) error      // 将数据存入队列
 	PeekChan() chan []byte // 查看通道，不会前移指针
+	Peek(n int) [][]byte   // 查看队列头部最多n条数据，不会前移指针
 	ReadChan() chan []byte // 读取通道
 	Close() error          // 关闭队列
 	Delete() error
@@ -65,6 +66,8 @@ type diskQueue struct {
 	readChan chan []byte // 无缓冲通道，用于读取队列头数据
 	peekChan chan []byte // 无缓冲通道，用于查看队列头数据
 
+	peekNChan         chan int
+	peekNResponseChan chan [][]byte
 	writeChan         chan []byte
 	writeResponseChan chan error
 	emptyChan         chan int
@@ -88,6 +91,8 @@ func New(name string, dataPath string, maxBytesPerFile int64,
 		maxMsgSize:        maxMsgSize,
 		readChan:          make(chan []byte),
 		peekChan:          make(chan []byte),
+		peekNChan:         make(chan int),
+		peekNResponseChan: make(chan [][]byte),
 		writeChan:         make(chan []byte),
 		writeResponseChan: make(chan error),
 		emptyChan:         make(chan int),
@@ -129,6 +134,18 @@ func (d *diskQueue) PeekChan() chan []byte {
 	return d.peekChan
 }
 
+// Peek n messages at most from the head, read position is unchanged.
+func (d *diskQueue) Peek(n int) [][]byte {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.exitFlag == 1 {
+		return nil
+	}
+	d.peekNChan <- n
+	return <-d.peekNResponseChan
+}
+
 // Put writes a []byte to the queue
 func (d *diskQueue) Put(data []byte) error {
 	d.RLock()
@@ -311,6 +328,56 @@ func (d *diskQueue) readOne() ([]byte, error) {
 	return readBuf, nil
 }
 
+// peekN 从当前读取位置起读取最多n条数据，使用独立的文件句柄，出错时返回已读取的数据
+func (d *diskQueue) peekN(n int) (datas [][]byte) {
+	var (
+		fileNum = d.readFileNum
+		pos     = d.readPos
+		file    *os.File
+		reader  *bufio.Reader
+		msgSize int32
+		err     error
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for len(datas) < n && (fileNum < d.writeFileNum || (fileNum == d.writeFileNum && pos < d.writePos)) {
+		if file == nil {
+			if file, err = os.OpenFile(d.fileName(fileNum), os.O_RDONLY, 0600); err != nil {
+				return
+			}
+			if _, err = file.Seek(pos, 0); err != nil {
+				return
+			}
+			reader = bufio.NewReader(file)
+		}
+		if err = binary.Read(reader, binary.BigEndian, &msgSize); err != nil {
+			return
+		}
+		if msgSize < d.minMsgSize || msgSize > d.maxMsgSize {
+			return
+		}
+		data := make([]byte, msgSize)
+		if _, err = io.ReadFull(reader, data); err != nil {
+			return
+		}
+		datas = append(datas, data)
+
+		// 与readOne相同的换文件规则
+		pos += int64(4 + msgSize)
+		if pos > d.maxBytesPerFile {
+			file.Close()
+			file = nil
+			fileNum++
+			pos = 0
+		}
+	}
+	return
+}
+
 // writeOne 底层写文件操作
 func (d *diskQueue) writeOne(data []byte) error {
 	var err error
@@ -530,6 +597,8 @@ func (d *diskQueue) ioLoop() {
 			// 清空数据
 			d.emptyResponseChan <- d.deleteAllFiles()
 			count = 0
+		case n := <-d.peekNChan:
+			d.peekNResponseChan <- d.peekN(n)
 		case dataWrite := <-d.writeChan:
 			// 写入是同步的
 			count++
@@ -303,3 +303,37 @@ func Test_Peek(t *testing.T) {
 	}
 	assert.Equal(t, int64(0), dq.Depth())
 }
+
+// 测试预读多条数据，跨文件且不前移读取位置
+func Test_PeekN(t *testing.T) {
+	logger := NewTestLogger()
+
+	dqName := "test_disk_queue_peek" + strconv.Itoa(int(time.Now().Unix()))
+	tmpDir, err := ioutil.TempDir("", fmt.Sprintf("logagent-test-%d", time.Now().UnixNano()))
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	// 每个文件5条消息
+	dq := New(dqName, tmpDir, 100, 0, 1<<10, 2500, 2*time.Second, logger)
+	defer dq.Close()
+	assert.Len(t, dq.Peek(5), 0)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, dq.Put([]byte(fmt.Sprintf("message-%02d", i)+string(make([]byte, 10)))))
+	}
+	datas := dq.Peek(6)
+	assert.Len(t, datas, 6)
+	for i, data := range datas {
+		assert.Equal(t, fmt.Sprintf("message-%02d", i), string(data[:10]))
+	}
+	assert.Equal(t, int64(10), dq.Depth())
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, datas[i], <-dq.ReadChan())
+	}
+	datas = dq.Peek(20)
+	assert.Len(t, datas, 5)
+	assert.Equal(t, "message-05", string(datas[0][:10]))
+	assert.Equal(t, "message-09", string(datas[4][:10]))
+	assert.Equal(t, datas[0], <-dq.PeekChan())
+}
@@ -1,5 +1,14 @@
 package utils
 
+import (
+	"sync"
+)
+
+// Finisher 输入结束时（例如stdin批处理模式）请求agent排空输出队列后退出
+type Finisher interface {
+	Finish()
+}
+
 // Agent 结构体.
 type Agent struct {
 	Name      string
@@ -8,6 +17,8 @@ type Agent struct {
 	EtcdHosts string
 
 	configs      []Config
+	finishOnce   *sync.Once
+	finishChan   chan int
 	exitChan     chan int
 	exitSyncChan chan int
 }
@@ -15,14 +26,20 @@ type Agent struct {
 // NewAgent 创建agent
 func NewAgent() *Agent {
 	ag := &Agent{
+		finishOnce:   &sync.Once{},
+		finishChan:   make(chan int),
 		exitChan:     make(chan int),
 		exitSyncChan: make(chan int),
 	}
 	return ag
 }
 
-// Run 运行Agent
+// Run 运行Agent，Finish后输出未能全部送达返回ErrUndelivered
 func (ag *Agent) Run() (err error) {
+	var (
+		finished bool
+		drainErr error
+	)
 	if ag.EtcdHosts != "" {
 		ag.configs, err = LoadFromNode(getEtcdList(ag.EtcdHosts), getEtcdPath(ag.Name), ag.DataDir)
 	} else {
@@ -36,6 +53,7 @@ func (ag *Agent) Run() (err error) {
 
 	// 启动主要组件
 	for _, c := range ag.configs {
+		c.MapTo(ag, (*Finisher)(nil))
 		if err = c.RunInputs(); err != nil {
 			Logger.Fatalf("Agent run inputs plugin error %s", err)
 			return
@@ -50,7 +68,11 @@ func (ag *Agent) Run() (err error) {
 		}
 	}
 	Logger.Info("Agent started.")
-	<-ag.exitChan
+	select {
+	case <-ag.exitChan:
+	case <-ag.finishChan:
+		finished = true
+	}
 	Logger.Info("Agent is shutting down.")
 
 	for _, c := range ag.configs {
@@ -64,6 +86,14 @@ func (ag *Agent) Run() (err error) {
 			return
 		}
 
+		// 输入已停止，等待磁盘队列发送完毕
+		if finished {
+			if err = c.DrainOutputs(ag.exitChan); err != nil {
+				Logger.Errorf("Agent drain outputs of %s error %s", c.Name, err)
+				drainErr = err
+			}
+		}
+
 		if err = c.StopOutputs(); err != nil {
 			Logger.Fatalf("Agent stop output plugin error %s", err)
 			return
@@ -71,9 +101,17 @@ func (ag *Agent) Run() (err error) {
 	}
 	Logger.Info("Agent graceful down.")
 	close(ag.exitSyncChan)
+	err = drainErr
 	return
 }
 
+// Finish 停止输入，排空输出队列后退出
+func (ag *Agent) Finish() {
+	ag.finishOnce.Do(func() {
+		close(ag.finishChan)
+	})
+}
+
 // Stop 停止Agent
 func (ag *Agent) Stop() {
 	close(ag.exitChan)
@@ -0,0 +1,251 @@
+package utils
+
+// 编解码器，负责字节流与LogEvent之间的转换，供输入和输出插件复用
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Codec interface.
+type Codec interface {
+	Decode(data []byte) ([]LogEvent, error) // decode a complete chunk of data
+	Flush() []LogEvent                      // events still buffered by the codec
+	Encode(ev LogEvent) ([]byte, error)
+}
+
+// BufferedCodec codec holding lines of an unfinished event between Decode calls.
+type BufferedCodec interface {
+	Buffered() int // lines held for the next event
+}
+
+// CodecHandler factory of codec.
+type CodecHandler func(part *ConfigPart) (Codec, error)
+
+// CodecConfig codec option of plugin, name string or object with type,
+// ex: "codec": "json" or "codec": {"type": "multiline", "pattern": "^\\s"}
+type CodecConfig struct {
+	Codec interface{} `json:"codec"`
+}
+
+var (
+	mapCodecHandler = map[string]CodecHandler{}
+)
+
+func init() {
+	RegistCodecHandler("plain", newPlainCodec)
+	RegistCodecHandler("line", newLineCodec)
+	RegistCodecHandler("json", newJSONCodec)
+	RegistCodecHandler("json_lines", newJSONLinesCodec)
+}
+
+// RegistCodecHandler regist a codec factory.
+func RegistCodecHandler(name string, handler CodecHandler) {
+	mapCodecHandler[name] = handler
+}
+
+// NewCodec create codec by name or config part.
+func NewCodec(part ConfigPart) (codec Codec, err error) {
+	name, _ := part["type"].(string)
+	handler, ok := mapCodecHandler[name]
+	if !ok {
+		err = errors.New("unknow codec type " + name)
+		return
+	}
+	return handler(&part)
+}
+
+// NewCodec create the configed codec, def used if codec not configed.
+func (c CodecConfig) NewCodec(def ConfigPart) (codec Codec, err error) {
+	switch v := c.Codec.(type) {
+	case nil:
+		return NewCodec(def)
+	case string:
+		return NewCodec(ConfigPart{"type": v})
+	case map[string]interface{}:
+		return NewCodec(ConfigPart(v))
+	case ConfigPart:
+		return NewCodec(v)
+	}
+	err = errors.New("codec must be a name or an object")
+	return
+}
+
+// DecodeEvents convert raw data to events, through charset decoder if any.
+func DecodeEvents(decoder *Decoder, codec Codec, data []byte) (events []LogEvent, err error) {
+	var (
+		mark LogEvent
+	)
+	if decoder != nil {
+		data = []byte(decoder.Decode(data, &mark))
+	}
+	if events, err = codec.Decode(data); err != nil {
+		return
+	}
+	for i := range events {
+		events[i].AddTag(mark.Tags...)
+	}
+	return
+}
+
+// newEvent empty event of now.
+func newEvent(message string) LogEvent {
+	return LogEvent{
+		Timestamp: time.Now(),
+		Message:   message,
+		Extra:     map[string]interface{}{},
+	}
+}
+
+// splitLines split data by newline, trailing newline and \r are removed.
+func splitLines(data []byte) (lines [][]byte) {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		lines = append(lines, bytes.TrimSuffix(line, []byte("\r")))
+	}
+	return
+}
+
+// plainCodec whole data as message.
+type plainCodec struct {
+	Format string `json:"format"` // encode format, default message
+}
+
+func newPlainCodec(part *ConfigPart) (codec Codec, err error) {
+	c := &plainCodec{}
+	if err = ReflectConfigPart(part, c); err != nil {
+		return
+	}
+	codec = c
+	return
+}
+
+func (c *plainCodec) Decode(data []byte) ([]LogEvent, error) {
+	return []LogEvent{newEvent(string(data))}, nil
+}
+
+func (c *plainCodec) Flush() []LogEvent {
+	return nil
+}
+
+func (c *plainCodec) Encode(ev LogEvent) ([]byte, error) {
+	if c.Format != "" {
+		return []byte(ev.Format(c.Format)), nil
+	}
+	return []byte(ev.Message), nil
+}
+
+// lineCodec a message per line.
+type lineCodec struct {
+	plainCodec
+}
+
+func newLineCodec(part *ConfigPart) (codec Codec, err error) {
+	c := &lineCodec{}
+	if err = ReflectConfigPart(part, c); err != nil {
+		return
+	}
+	codec = c
+	return
+}
+
+func (c *lineCodec) Decode(data []byte) (events []LogEvent, err error) {
+	for _, line := range splitLines(data) {
+		events = append(events, newEvent(string(line)))
+	}
+	return
+}
+
+func (c *lineCodec) Encode(ev LogEvent) (data []byte, err error) {
+	if data, err = c.plainCodec.Encode(ev); err != nil {
+		return
+	}
+	data = append(data, '\n')
+	return
+}
+
+// jsonCodec a json object or array of objects.
+type jsonCodec struct {
+	Indent bool `json:"indent"` // encode readable json
+}
+
+func newJSONCodec(part *ConfigPart) (codec Codec, err error) {
+	c := &jsonCodec{}
+	if err = ReflectConfigPart(part, c); err != nil {
+		return
+	}
+	codec = c
+	return
+}
+
+func (c *jsonCodec) Decode(data []byte) (events []LogEvent, err error) {
+	var (
+		objs []map[string]interface{}
+	)
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+	if data[0] == '[' {
+		err = json.Unmarshal(data, &objs)
+	} else {
+		obj := map[string]interface{}{}
+		err = json.Unmarshal(data, &obj)
+		objs = append(objs, obj)
+	}
+	if err != nil {
+		return
+	}
+	for _, obj := range objs {
+		events = append(events, LogEventFromMap(obj))
+	}
+	return
+}
+
+func (c *jsonCodec) Flush() []LogEvent {
+	return nil
+}
+
+func (c *jsonCodec) Encode(ev LogEvent) ([]byte, error) {
+	return ev.Marshal(c.Indent)
+}
+
+// jsonLinesCodec a json object per line.
+type jsonLinesCodec struct{}
+
+func newJSONLinesCodec(part *ConfigPart) (codec Codec, err error) {
+	codec = &jsonLinesCodec{}
+	return
+}
+
+func (c *jsonLinesCodec) Decode(data []byte) (events []LogEvent, err error) {
+	for _, line := range splitLines(data) {
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		obj := map[string]interface{}{}
+		if err = json.Unmarshal(line, &obj); err != nil {
+			return
+		}
+		events = append(events, LogEventFromMap(obj))
+	}
+	return
+}
+
+func (c *jsonLinesCodec) Flush() []LogEvent {
+	return nil
+}
+
+func (c *jsonLinesCodec) Encode(ev LogEvent) (data []byte, err error) {
+	if data, err = ev.Marshal(false); err != nil {
+		return
+	}
+	data = append(data, '\n')
+	return
+}
@@ -0,0 +1,171 @@
+package utils
+
+// GELF (Graylog Extended Log Format) 1.1
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	reGELFField = regexp.MustCompile(`[^\w\.\-]`)
+
+	errGELFTooLarge = errors.New("gelf message too large")
+)
+
+// gelfCodec a GELF json object, zlib or gzip compressed data is accepted.
+type gelfCodec struct {
+	MaxSize int `json:"max_size"` // bytes after decompress, default 1MiB
+
+	hostname string
+}
+
+func init() {
+	RegistCodecHandler("gelf", newGELFCodec)
+}
+
+func newGELFCodec(part *ConfigPart) (codec Codec, err error) {
+	c := &gelfCodec{}
+	if err = ReflectConfigPart(part, c); err != nil {
+		return
+	}
+	if c.MaxSize <= 0 {
+		c.MaxSize = 1024 * 1024
+	}
+	if c.hostname, err = os.Hostname(); err != nil {
+		return
+	}
+	codec = c
+	return
+}
+
+func (c *gelfCodec) Decode(data []byte) (events []LogEvent, err error) {
+	var (
+		obj = map[string]interface{}{}
+		zr  io.ReadCloser
+	)
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		zr, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) > 2 && data[0] == 0x78:
+		zr, err = zlib.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return
+	}
+	if zr != nil {
+		defer zr.Close()
+		if data, err = ioutil.ReadAll(io.LimitReader(zr, int64(c.MaxSize)+1)); err != nil {
+			return
+		}
+	}
+	if len(data) > c.MaxSize {
+		err = errGELFTooLarge
+		return
+	}
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return
+	}
+
+	ev := newEvent("")
+	for key, value := range obj {
+		switch key {
+		case "version":
+		case "short_message":
+			ev.Message, _ = value.(string)
+		case "timestamp":
+			if ts, ok := value.(float64); ok {
+				ev.Timestamp = time.Unix(0, int64(ts*1000)*int64(time.Millisecond))
+			}
+		case "level":
+			if level, ok := value.(float64); ok {
+				ev.Extra["level"] = int(level)
+			}
+		case "_tags":
+			if tags, ok := value.(string); ok && tags != "" {
+				ev.AddTag(strings.Split(tags, ",")...)
+			}
+		default:
+			// additional fields without the underscore.
+			ev.Extra[strings.TrimPrefix(key, "_")] = value
+		}
+	}
+	events = append(events, ev)
+	return
+}
+
+func (c *gelfCodec) Flush() []LogEvent {
+	return nil
+}
+
+func (c *gelfCodec) Encode(ev LogEvent) ([]byte, error) {
+	var (
+		timestamp = ev.Timestamp
+		obj       = map[string]interface{}{
+			"version":       "1.1",
+			"host":          c.hostname,
+			"short_message": ev.Message,
+		}
+	)
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	obj["timestamp"] = float64(timestamp.UnixNano()/int64(time.Millisecond)) / 1000
+	// short_message must not be empty.
+	if ev.Message == "" {
+		obj["short_message"] = "-"
+	}
+	if len(ev.Tags) > 0 {
+		obj["_tags"] = strings.Join(ev.Tags, ",")
+	}
+	// syslog severity is the same as level.
+	if _, ok := ev.Extra["level"]; !ok {
+		if severity, ok := ev.Extra["severity"]; ok {
+			obj["level"] = severity
+		}
+	}
+
+	for key, value := range ev.Extra {
+		switch key {
+		case "host", "full_message":
+			if s, ok := value.(string); ok && s != "" {
+				obj[key] = s
+				continue
+			}
+		case "level":
+			obj[key] = value
+			continue
+		}
+		// _id is reserved.
+		if key == "id" {
+			key = "id_"
+		}
+		obj["_"+reGELFField.ReplaceAllString(key, "_")] = gelfValue(value)
+	}
+	return json.Marshal(obj)
+}
+
+// gelfValue additional field must be string or number.
+func gelfValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, float64, float32, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, json.Number:
+		return v
+	case nil:
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(string(data), `"`)
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+)
+
+// msgpackCodec a msgpack map or array of maps.
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func init() {
+	RegistCodecHandler("msgpack", newMsgpackCodec)
+}
+
+func newMsgpackCodec(part *ConfigPart) (c Codec, err error) {
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	handle.WriteExt = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	c = &msgpackCodec{
+		handle: handle,
+	}
+	return
+}
+
+func (c *msgpackCodec) Decode(data []byte) (events []LogEvent, err error) {
+	var (
+		obj interface{}
+	)
+	// several objects may be packed one after another.
+	dec := codec.NewDecoderBytes(data, c.handle)
+	for dec.NumBytesRead() < len(data) {
+		obj = nil
+		if err = dec.Decode(&obj); err != nil {
+			return
+		}
+		switch v := obj.(type) {
+		case map[string]interface{}:
+			events = append(events, LogEventFromMap(v))
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					events = append(events, LogEventFromMap(m))
+				}
+			}
+		}
+	}
+	return
+}
+
+func (c *msgpackCodec) Flush() []LogEvent {
+	return nil
+}
+
+func (c *msgpackCodec) Encode(ev LogEvent) (data []byte, err error) {
+	err = codec.NewEncoderBytes(&data, c.handle).Encode(ev.GetMap())
+	return
+}
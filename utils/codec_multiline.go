@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// multilineCodec merge lines into one message by pattern, like logstash.
+type multilineCodec struct {
+	lineCodec
+	Pattern  string `json:"pattern"`   // regexp to match lines
+	Negate   bool   `json:"negate"`    // lines not match the pattern
+	What     string `json:"what"`      // previous or next
+	MaxLines int    `json:"max_lines"` // lines of one message at most
+
+	re    *regexp.Regexp
+	lines []string
+}
+
+func init() {
+	RegistCodecHandler("multiline", newMultilineCodec)
+}
+
+func newMultilineCodec(part *ConfigPart) (codec Codec, err error) {
+	c := &multilineCodec{}
+	if err = ReflectConfigPart(part, c); err != nil {
+		return
+	}
+	if c.re, err = regexp.Compile(c.Pattern); err != nil {
+		return
+	}
+	switch c.What {
+	case "":
+		c.What = "previous"
+	case "previous", "next":
+	default:
+		err = errors.New("multiline codec what must be previous or next")
+		return
+	}
+	if c.MaxLines <= 0 {
+		c.MaxLines = 500
+	}
+	codec = c
+	return
+}
+
+func (c *multilineCodec) Decode(data []byte) (events []LogEvent, err error) {
+	for _, raw := range splitLines(data) {
+		line := string(raw)
+		matched := c.re.MatchString(line) != c.Negate
+
+		if c.What == "previous" {
+			// a line not belongs to previous start a new message.
+			if !matched {
+				events = append(events, c.Flush()...)
+			}
+			c.lines = append(c.lines, line)
+		} else {
+			// a line not belongs to next end the message.
+			c.lines = append(c.lines, line)
+			if !matched {
+				events = append(events, c.Flush()...)
+			}
+		}
+		if len(c.lines) >= c.MaxLines {
+			events = append(events, c.Flush()...)
+		}
+	}
+	return
+}
+
+func (c *multilineCodec) Buffered() int {
+	return len(c.lines)
+}
+
+func (c *multilineCodec) Flush() (events []LogEvent) {
+	if len(c.lines) == 0 {
+		return
+	}
+	ev := newEvent(strings.Join(c.lines, "\n"))
+	if len(c.lines) > 1 {
+		ev.AddTag("multiline")
+	}
+	c.lines = nil
+	return []LogEvent{ev}
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CodecConfig(t *testing.T) {
+	c, err := CodecConfig{}.NewCodec(ConfigPart{"type": "line"})
+	assert.NoError(t, err)
+	assert.IsType(t, &lineCodec{}, c)
+
+	c, err = CodecConfig{Codec: "json_lines"}.NewCodec(ConfigPart{"type": "line"})
+	assert.NoError(t, err)
+	assert.IsType(t, &jsonLinesCodec{}, c)
+
+	c, err = CodecConfig{Codec: map[string]interface{}{"type": "plain", "format": "${host}"}}.NewCodec(nil)
+	assert.NoError(t, err)
+	data, err := c.Encode(LogEvent{Extra: map[string]interface{}{"host": "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+
+	_, err = CodecConfig{Codec: "unknow"}.NewCodec(nil)
+	assert.Error(t, err)
+}
+
+func Test_LineCodec(t *testing.T) {
+	c, err := NewCodec(ConfigPart{"type": "line"})
+	assert.NoError(t, err)
+	events, err := c.Decode([]byte("line1\r\nline2\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "line2", events[1].Message)
+	data, err := c.Encode(events[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "line1\n", string(data))
+}
+
+func Test_JSONCodec(t *testing.T) {
+	c, err := NewCodec(ConfigPart{"type": "json"})
+	assert.NoError(t, err)
+	now := time.Now()
+	ev := LogEvent{
+		Timestamp: now,
+		Message:   "message",
+		Tags:      []string{"tag"},
+		Extra: map[string]interface{}{
+			"user": "tuhuayuan",
+		},
+	}
+	data, err := c.Encode(ev)
+	assert.NoError(t, err)
+	events, err := c.Decode(data)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "message", events[0].Message)
+	assert.Equal(t, []string{"tag"}, events[0].Tags)
+	assert.Equal(t, "tuhuayuan", events[0].Extra["user"])
+	assert.Equal(t, now.UnixNano()/1e6, events[0].Timestamp.UnixNano()/1e6)
+
+	events, err = c.Decode([]byte(`[{"message": "a"}, {"message": "b"}]`))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	c, err = NewCodec(ConfigPart{"type": "json_lines"})
+	assert.NoError(t, err)
+	events, err = c.Decode([]byte("{\"message\": \"a\"}\n\n{\"message\": \"b\"}\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	_, err = c.Decode([]byte("not json\n"))
+	assert.Error(t, err)
+}
+
+func Test_MultilineCodec(t *testing.T) {
+	c, err := NewCodec(ConfigPart{
+		"type":    "multiline",
+		"pattern": "^\\s",
+	})
+	assert.NoError(t, err)
+	events, err := c.Decode([]byte("panic: error\n\tat main.go:1\n\tat main.go:2\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 0)
+	events, err = c.Decode([]byte("next line\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "panic: error\n\tat main.go:1\n\tat main.go:2", events[0].Message)
+	assert.Equal(t, []string{"multiline"}, events[0].Tags)
+	events = c.Flush()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "next line", events[0].Message)
+
+	c, err = NewCodec(ConfigPart{
+		"type":    "multiline",
+		"pattern": "\\\\$",
+		"what":    "next",
+	})
+	assert.NoError(t, err)
+	events, err = c.Decode([]byte("a \\\nb\nc\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "a \\\nb", events[0].Message)
+}
+
+func Test_MsgpackCodec(t *testing.T) {
+	c, err := NewCodec(ConfigPart{"type": "msgpack"})
+	assert.NoError(t, err)
+	ev := LogEvent{
+		Timestamp: time.Now(),
+		Message:   "message",
+		Extra: map[string]interface{}{
+			"index": 1,
+		},
+	}
+	data, err := c.Encode(ev)
+	assert.NoError(t, err)
+	more, err := c.Encode(ev)
+	assert.NoError(t, err)
+	events, err := c.Decode(append(data, more...))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "message", events[1].Message)
+	assert.EqualValues(t, 1, events[1].Extra["index"])
+}
+
+func Test_GELFCodec(t *testing.T) {
+	c, err := NewCodec(ConfigPart{"type": "gelf"})
+	assert.NoError(t, err)
+	ts := time.Date(2017, 6, 1, 10, 0, 0, 123000000, time.UTC)
+	data, err := c.Encode(LogEvent{
+		Timestamp: ts,
+		Message:   "short",
+		Tags:      []string{"a", "b"},
+		Extra: map[string]interface{}{
+			"host":         "web1",
+			"full_message": "full\nstack",
+			"severity":     3,
+			"id":           1,
+			"user name":    "admin",
+			"ok":           true,
+		},
+	})
+	assert.NoError(t, err)
+
+	// compressed data is accepted.
+	compressed := &bytes.Buffer{}
+	zw := zlib.NewWriter(compressed)
+	zw.Write(data)
+	zw.Close()
+	events, err := c.Decode(compressed.Bytes())
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	ev := events[0]
+	assert.Equal(t, "short", ev.Message)
+	assert.True(t, ts.Equal(ev.Timestamp))
+	assert.Equal(t, []string{"a", "b"}, ev.Tags)
+	assert.Equal(t, "web1", ev.Extra["host"])
+	assert.Equal(t, "full\nstack", ev.Extra["full_message"])
+	assert.Equal(t, 3, ev.Extra["level"])
+	assert.Equal(t, float64(1), ev.Extra["id_"])
+	assert.Equal(t, "admin", ev.Extra["user_name"])
+	assert.Equal(t, "true", ev.Extra["ok"])
+
+	c, err = NewCodec(ConfigPart{"type": "gelf", "max_size": 8})
+	assert.NoError(t, err)
+	_, err = c.Decode(compressed.Bytes())
+	assert.Equal(t, errGELFTooLarge, err)
+}
+
+func Test_DecodeEvents(t *testing.T) {
+	c, err := NewCodec(ConfigPart{"type": "line"})
+	assert.NoError(t, err)
+	d, err := EncodingConfig{Encoding: "utf-8", EncodingInvalid: "tag"}.NewDecoder()
+	assert.NoError(t, err)
+	events, err := DecodeEvents(d, c, []byte("a\nb\xff\n"))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, []string{TagDecodeFailure}, events[0].Tags)
+}
@@ -0,0 +1,181 @@
+package utils
+
+// 输入字符集转换为UTF-8
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	// TagDecodeFailure tag of event contains invalid sequences.
+	TagDecodeFailure = "_decodefailure"
+)
+
+// EncodingConfig charset options of input plugin.
+type EncodingConfig struct {
+	Encoding        string `json:"encoding"`         // charset of input data, default utf-8 unchecked
+	EncodingInvalid string `json:"encoding_invalid"` // replace or tag invalid sequences
+}
+
+// Decoder convert bytes of a charset to utf-8.
+type Decoder struct {
+	Name    string
+	Invalid string
+
+	enc     encoding.Encoding
+	newline []byte
+	cr      []byte
+}
+
+type charset struct {
+	enc     encoding.Encoding
+	newline string
+	cr      string
+}
+
+var (
+	mapCharset = map[string]charset{
+		"utf-8":    {nil, "\n", "\r"},
+		"utf8":     {nil, "\n", "\r"},
+		"gbk":      {simplifiedchinese.GBK, "\n", "\r"},
+		"gb2312":   {simplifiedchinese.GBK, "\n", "\r"},
+		"gb18030":  {simplifiedchinese.GB18030, "\n", "\r"},
+		"utf-16":   {unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), "\n\x00", "\r\x00"},
+		"utf-16le": {unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), "\n\x00", "\r\x00"},
+		"utf-16be": {unicode.UTF16(unicode.BigEndian, unicode.UseBOM), "\x00\n", "\x00\r"},
+	}
+)
+
+// NewDecoder create decoder by config, return nil if no encoding configed.
+func (c EncodingConfig) NewDecoder() (d *Decoder, err error) {
+	if c.Encoding == "" {
+		return
+	}
+	cs, ok := mapCharset[strings.ToLower(c.Encoding)]
+	if !ok {
+		err = errors.New("unknow encoding " + c.Encoding)
+		return
+	}
+	switch c.EncodingInvalid {
+	case "":
+		c.EncodingInvalid = "replace"
+	case "replace", "tag":
+	default:
+		err = errors.New("unknow encoding_invalid " + c.EncodingInvalid)
+		return
+	}
+	d = &Decoder{
+		Name:    c.Encoding,
+		Invalid: c.EncodingInvalid,
+		enc:     cs.enc,
+		newline: []byte(cs.newline),
+		cr:      []byte(cs.cr),
+	}
+	return
+}
+
+// Decode convert data to utf-8, invalid sequences are replaced by U+FFFD
+// and the event is tagged if configed.
+func (d *Decoder) Decode(data []byte, ev *LogEvent) string {
+	if d == nil {
+		return string(data)
+	}
+	var (
+		text  string
+		valid = true
+	)
+	if d.enc == nil {
+		text = string(data)
+		if !utf8.ValidString(text) {
+			text = strings.ToValidUTF8(text, string(utf8.RuneError))
+			valid = false
+		}
+	} else {
+		out, err := d.enc.NewDecoder().Bytes(data)
+		if err != nil {
+			valid = false
+		}
+		text = string(out)
+		if strings.ContainsRune(text, utf8.RuneError) {
+			valid = false
+		}
+	}
+	if !valid && d.Invalid == "tag" && ev != nil {
+		ev.AddTag(TagDecodeFailure)
+	}
+	return text
+}
+
+// Width bytes of a newline in this charset.
+func (d *Decoder) Width() int {
+	if d == nil {
+		return 1
+	}
+	return len(d.newline)
+}
+
+// ReadLine read a line end with newline of this charset, the partial line
+// stays in buffer when EOF. size count the newline bytes.
+func (d *Decoder) ReadLine(reader *bufio.Reader, buffer *bytes.Buffer) (line []byte, size int, err error) {
+	var (
+		b     byte
+		width = d.Width()
+	)
+	for {
+		if b, err = reader.ReadByte(); err != nil {
+			return
+		}
+		buffer.WriteByte(b)
+		size = buffer.Len()
+		if size%width != 0 || !bytes.HasSuffix(buffer.Bytes(), d.newline) {
+			continue
+		}
+		raw := buffer.Bytes()[:size-width]
+		if len(raw)%width == 0 && bytes.HasSuffix(raw, d.cr) {
+			raw = raw[:len(raw)-width]
+		}
+		line = append([]byte{}, raw...)
+		buffer.Reset()
+		return
+	}
+}
+
+// LineReader read lines of the charset, shared by stream inputs.
+type LineReader struct {
+	decoder *Decoder
+	reader  *bufio.Reader
+	buffer  *bytes.Buffer
+}
+
+// NewLineReader create line reader, decoder can be nil.
+func NewLineReader(r io.Reader, decoder *Decoder) *LineReader {
+	return &LineReader{
+		decoder: decoder,
+		reader:  bufio.NewReader(r),
+		buffer:  &bytes.Buffer{},
+	}
+}
+
+// ReadLine a line without newline, the last line without newline
+// is returned with io.EOF.
+func (lr *LineReader) ReadLine() (line []byte, err error) {
+	if lr.decoder.Width() > 1 {
+		if line, _, err = lr.decoder.ReadLine(lr.reader, lr.buffer); err == io.EOF && lr.buffer.Len() > 0 {
+			line = append([]byte{}, lr.buffer.Bytes()...)
+			lr.buffer.Reset()
+		}
+		return
+	}
+	line, err = lr.reader.ReadBytes('\n')
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	return
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DecodeGBK(t *testing.T) {
+	d, err := EncodingConfig{Encoding: "GBK"}.NewDecoder()
+	assert.NoError(t, err)
+	ev := &LogEvent{}
+	// "消息" in gbk
+	text := d.Decode([]byte{0xcf, 0xfb, 0xcf, 0xa2}, ev)
+	assert.Equal(t, "消息", text)
+	assert.Len(t, ev.Tags, 0)
+}
+
+func Test_DecodeInvalid(t *testing.T) {
+	d, err := EncodingConfig{Encoding: "utf-8", EncodingInvalid: "tag"}.NewDecoder()
+	assert.NoError(t, err)
+	ev := &LogEvent{}
+	text := d.Decode([]byte{'o', 'k', 0xff}, ev)
+	assert.Equal(t, "ok�", text)
+	assert.Equal(t, []string{TagDecodeFailure}, ev.Tags)
+
+	_, err = EncodingConfig{Encoding: "ebcdic"}.NewDecoder()
+	assert.Error(t, err)
+
+	d, err = EncodingConfig{}.NewDecoder()
+	assert.NoError(t, err)
+	assert.Nil(t, d)
+	assert.Equal(t, "raw", d.Decode([]byte("raw"), nil))
+}
+
+func Test_ReadLineUTF16(t *testing.T) {
+	d, err := EncodingConfig{Encoding: "utf-16le"}.NewDecoder()
+	assert.NoError(t, err)
+	// BOM, "a\u0a00\u0100" CRLF, "b" LF, "c" without newline
+	data := []byte{0xff, 0xfe, 'a', 0, 0x00, 0x0a, 0x00, 0x01, '\r', 0, '\n', 0, 'b', 0, '\n', 0, 'c', 0}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	buffer := &bytes.Buffer{}
+
+	line, size, err := d.ReadLine(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 12, size)
+	assert.Equal(t, "a\u0a00\u0100", d.Decode(line, nil))
+
+	line, size, err = d.ReadLine(reader, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+	assert.Equal(t, "b", d.Decode(line, nil))
+
+	_, _, err = d.ReadLine(reader, buffer)
+	assert.Error(t, err)
+	assert.Equal(t, 2, buffer.Len())
+}
+
+func Test_LineReader(t *testing.T) {
+	lr := NewLineReader(bytes.NewReader([]byte("a\r\nb\nc")), nil)
+	for _, expect := range []string{"a", "b"} {
+		line, err := lr.ReadLine()
+		assert.NoError(t, err)
+		assert.Equal(t, expect, string(line))
+	}
+	line, err := lr.ReadLine()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "c", string(line))
+
+	d, _ := EncodingConfig{Encoding: "utf-16le"}.NewDecoder()
+	lr = NewLineReader(bytes.NewReader([]byte{'a', 0, '\n', 0, 'b', 0}), d)
+	line, err = lr.ReadLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "a", d.Decode(line, nil))
+	line, err = lr.ReadLine()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "b", d.Decode(line, nil))
+}
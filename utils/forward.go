@@ -0,0 +1,198 @@
+package utils
+
+// Fluentd forward 协议，forward输入和输出插件共用
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/ugorji/go/codec"
+)
+
+// ForwardTime EventTime of forward protocol, nanoseconds since epoch.
+type ForwardTime int64
+
+// forwardTimeExt msgpack ext type 0, seconds and nanoseconds in uint32.
+type forwardTimeExt struct{}
+
+func (forwardTimeExt) WriteExt(v interface{}) []byte {
+	var (
+		data = make([]byte, 8)
+		ns   int64
+	)
+	switch t := v.(type) {
+	case ForwardTime:
+		ns = int64(t)
+	case *ForwardTime:
+		ns = int64(*t)
+	}
+	binary.BigEndian.PutUint32(data, uint32(ns/int64(time.Second)))
+	binary.BigEndian.PutUint32(data[4:], uint32(ns%int64(time.Second)))
+	return data
+}
+
+func (forwardTimeExt) ReadExt(dst interface{}, src []byte) {
+	if len(src) != 8 {
+		return
+	}
+	sec := int64(binary.BigEndian.Uint32(src))
+	nsec := int64(binary.BigEndian.Uint32(src[4:]))
+	*(dst.(*ForwardTime)) = ForwardTime(sec*int64(time.Second) + nsec)
+}
+
+// NewForwardHandle msgpack handle of forward protocol.
+func NewForwardHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.RawToString = true
+	handle.WriteExt = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.SetBytesExt(reflect.TypeOf(ForwardTime(0)), 0, forwardTimeExt{})
+	return handle
+}
+
+// ForwardDigest hex sha512 of parts, used by shared key handshake.
+func ForwardDigest(parts ...[]byte) string {
+	h := sha512.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ForwardBytes str or bin value.
+func ForwardBytes(v interface{}) []byte {
+	switch b := v.(type) {
+	case []byte:
+		return b
+	case string:
+		return []byte(b)
+	}
+	return nil
+}
+
+// ParseForward events of Message, Forward or PackedForward mode message,
+// maxSize is bytes of a compressed PackedForward entries at most after
+// decompression, default 32MiB.
+func ParseForward(handle *codec.MsgpackHandle, msg []interface{}, maxSize int) (events []LogEvent, option map[string]interface{}, err error) {
+	var (
+		tag     string
+		entries []interface{}
+		ok      bool
+	)
+	if len(msg) < 2 {
+		err = errors.New("forward message too short")
+		return
+	}
+	if tag, ok = msg[0].(string); !ok {
+		err = errors.New("forward tag must be string")
+		return
+	}
+
+	switch v := msg[1].(type) {
+	case []interface{}:
+		// Forward [tag, [[time, record], ...], option]
+		entries = v
+		option = forwardOption(msg, 2)
+	case []byte, string:
+		// PackedForward [tag, msgpack stream of [time, record], option]
+		option = forwardOption(msg, 2)
+		data := ForwardBytes(v)
+		if option["compressed"] == "gzip" {
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(bytes.NewReader(data)); err != nil {
+				return
+			}
+			if maxSize <= 0 {
+				maxSize = 32 * 1024 * 1024
+			}
+			// read one more byte to detect oversize.
+			data, err = ioutil.ReadAll(io.LimitReader(zr, int64(maxSize)+1))
+			zr.Close()
+			if err != nil {
+				return
+			}
+			if len(data) > maxSize {
+				err = errors.New("forward entries too large after decompression")
+				return
+			}
+		}
+		dec := codec.NewDecoderBytes(data, handle)
+		for dec.NumBytesRead() < len(data) {
+			var entry interface{}
+			if err = dec.Decode(&entry); err != nil {
+				return
+			}
+			entries = append(entries, entry)
+		}
+	default:
+		// Message [tag, time, record, option]
+		if len(msg) < 3 {
+			err = errors.New("forward message record missing")
+			return
+		}
+		entries = []interface{}{msg[1:3]}
+		option = forwardOption(msg, 3)
+	}
+
+	for _, entry := range entries {
+		var ev LogEvent
+		if ev, err = forwardEvent(tag, entry); err != nil {
+			return
+		}
+		events = append(events, ev)
+	}
+	return
+}
+
+// forwardOption option map at index if any.
+func forwardOption(msg []interface{}, index int) map[string]interface{} {
+	if len(msg) > index {
+		if option, ok := msg[index].(map[string]interface{}); ok {
+			return option
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// forwardEvent convert [time, record] to event, tag is kept in field tag.
+func forwardEvent(tag string, entry interface{}) (ev LogEvent, err error) {
+	var (
+		pair   []interface{}
+		record map[string]interface{}
+		ok     bool
+	)
+	if pair, ok = entry.([]interface{}); !ok || len(pair) < 2 {
+		err = errors.New("forward entry must be [time, record]")
+		return
+	}
+	if record, ok = pair[1].(map[string]interface{}); !ok {
+		err = errors.New("forward record must be map")
+		return
+	}
+	ev = LogEventFromMap(record)
+	switch t := pair[0].(type) {
+	case ForwardTime:
+		ev.Timestamp = time.Unix(0, int64(t))
+	case int64:
+		ev.Timestamp = time.Unix(t, 0)
+	case uint64:
+		ev.Timestamp = time.Unix(int64(t), 0)
+	case float64:
+		ev.Timestamp = time.Unix(0, int64(t*float64(time.Second)))
+	}
+	// fluent bit use log as message key.
+	if log, ok := ev.Extra["log"].(string); ok && ev.Message == "" {
+		ev.Message = log
+		delete(ev.Extra, "log")
+	}
+	ev.Extra["tag"] = tag
+	return
+}
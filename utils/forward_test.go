@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+)
+
+func forwardRoundTrip(t *testing.T, handle *codec.MsgpackHandle, v interface{}) []interface{} {
+	var (
+		data []byte
+		msg  []interface{}
+	)
+	assert.NoError(t, codec.NewEncoderBytes(&data, handle).Encode(v))
+	assert.NoError(t, codec.NewDecoderBytes(data, handle).Decode(&msg))
+	return msg
+}
+
+func Test_ParseForward(t *testing.T) {
+	handle := NewForwardHandle()
+	ts := time.Date(2017, 6, 1, 10, 0, 0, 123456789, time.UTC)
+	et := ForwardTime(ts.UnixNano())
+
+	// Message mode with EventTime
+	msg := forwardRoundTrip(t, handle, []interface{}{
+		"app.access", et, map[string]interface{}{"log": "line", "code": 200},
+		map[string]interface{}{"chunk": "abc"},
+	})
+	events, option, err := ParseForward(handle, msg, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "line", events[0].Message)
+	assert.Equal(t, "app.access", events[0].Extra["tag"])
+	assert.EqualValues(t, 200, events[0].Extra["code"])
+	assert.True(t, ts.Equal(events[0].Timestamp))
+	assert.Equal(t, "abc", option["chunk"])
+
+	// Forward mode with integer time
+	msg = forwardRoundTrip(t, handle, []interface{}{
+		"app", []interface{}{
+			[]interface{}{ts.Unix(), map[string]interface{}{"message": "a"}},
+			[]interface{}{ts.Unix(), map[string]interface{}{"message": "b"}},
+		},
+	})
+	events, _, err = ParseForward(handle, msg, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "b", events[1].Message)
+	assert.Equal(t, ts.Unix(), events[1].Timestamp.Unix())
+
+	// CompressedPackedForward
+	var entries []byte
+	enc := codec.NewEncoderBytes(&entries, handle)
+	enc.Encode([]interface{}{et, map[string]interface{}{"message": "c"}})
+	enc.Encode([]interface{}{et, map[string]interface{}{"message": "d"}})
+	buff := &bytes.Buffer{}
+	zw := gzip.NewWriter(buff)
+	zw.Write(entries)
+	zw.Close()
+	msg = forwardRoundTrip(t, handle, []interface{}{
+		"app", buff.Bytes(), map[string]interface{}{"compressed": "gzip"},
+	})
+	events, _, err = ParseForward(handle, msg, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "d", events[1].Message)
+	assert.True(t, ts.Equal(events[1].Timestamp))
+	_, _, err = ParseForward(handle, msg, len(entries)-1)
+	assert.Error(t, err)
+	_, _, err = ParseForward(handle, msg, len(entries))
+	assert.NoError(t, err)
+
+	_, _, err = ParseForward(handle, []interface{}{"app", int64(1)}, 0)
+	assert.Error(t, err)
+}
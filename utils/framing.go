@@ -0,0 +1,144 @@
+package utils
+
+// 流式连接的分帧：按行或者RFC6587 octet counting
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+var (
+	// ErrFrameTruncated frame larger than max size, the rest is dropped.
+	ErrFrameTruncated = errors.New("frame truncated")
+)
+
+// FrameReader read frames from stream connection.
+type FrameReader struct {
+	reader  *bufio.Reader
+	framing string
+	maxSize int
+}
+
+// NewFrameReader create reader, framing is newline, octet_counted or auto
+// (octet counted if the frame starts with a digit).
+func NewFrameReader(r io.Reader, framing string, maxSize int) (fr *FrameReader, err error) {
+	switch framing {
+	case "":
+		framing = "newline"
+	case "newline", "octet_counted", "auto":
+	default:
+		err = errors.New("unknow framing " + framing)
+		return
+	}
+	if maxSize <= 0 {
+		maxSize = 64 * 1024
+	}
+	fr = &FrameReader{
+		reader:  bufio.NewReaderSize(r, 16*1024),
+		framing: framing,
+		maxSize: maxSize,
+	}
+	return
+}
+
+// ReadFrame read next frame, ErrFrameTruncated returned with the truncated frame.
+func (fr *FrameReader) ReadFrame() (frame []byte, err error) {
+	switch fr.framing {
+	case "octet_counted":
+		return fr.readOctetCounted()
+	case "auto":
+		var head []byte
+		if head, err = fr.reader.Peek(1); err != nil {
+			return
+		}
+		if head[0] >= '0' && head[0] <= '9' {
+			return fr.readOctetCounted()
+		}
+	}
+	return fr.readLine()
+}
+
+// readLine read a line without the trailing \r\n.
+func (fr *FrameReader) readLine() (frame []byte, err error) {
+	var (
+		segment   []byte
+		truncated bool
+	)
+	for {
+		segment, err = fr.reader.ReadSlice('\n')
+		if len(frame)+len(segment) > fr.maxSize {
+			segment = segment[:fr.maxSize-len(frame)]
+			truncated = true
+		}
+		frame = append(frame, segment...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(frame) > 0 {
+			// last line without newline.
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+		break
+	}
+	if n := len(frame); n > 0 && frame[n-1] == '\n' {
+		frame = frame[:n-1]
+	}
+	if n := len(frame); n > 0 && frame[n-1] == '\r' {
+		frame = frame[:n-1]
+	}
+	if truncated {
+		err = ErrFrameTruncated
+	}
+	return
+}
+
+// readOctetCounted read "LEN SP MSG".
+func (fr *FrameReader) readOctetCounted() (frame []byte, err error) {
+	var (
+		head []byte
+		size int
+	)
+	if head, err = fr.reader.ReadSlice(' '); err != nil {
+		if err == bufio.ErrBufferFull {
+			err = errors.New("invalid octet count")
+		}
+		return
+	}
+	if size, err = strconv.Atoi(string(head[:len(head)-1])); err != nil || size < 0 {
+		err = errors.New("invalid octet count " + string(head))
+		return
+	}
+	if size <= fr.maxSize {
+		frame = make([]byte, size)
+		_, err = io.ReadFull(fr.reader, frame)
+		return
+	}
+	frame = make([]byte, fr.maxSize)
+	if _, err = io.ReadFull(fr.reader, frame); err != nil {
+		return
+	}
+	if _, err = fr.reader.Discard(size - fr.maxSize); err != nil {
+		return
+	}
+	err = ErrFrameTruncated
+	return
+}
+
+// AppendFrame append frame to buf, framing is newline or octet_counted.
+func AppendFrame(buf []byte, frame []byte, framing string) []byte {
+	if framing == "octet_counted" {
+		buf = strconv.AppendInt(buf, int64(len(frame)), 10)
+		buf = append(buf, ' ')
+		return append(buf, frame...)
+	}
+	if n := len(frame); n > 0 && frame[n-1] == '\n' {
+		frame = frame[:n-1]
+	}
+	buf = append(buf, frame...)
+	return append(buf, '\n')
+}
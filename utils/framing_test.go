@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FrameReader(t *testing.T) {
+	_, err := NewFrameReader(nil, "xml", 0)
+	assert.Error(t, err)
+
+	fr, err := NewFrameReader(bytes.NewReader([]byte("12 <13>message\nline\r\n4 next")), "auto", 0)
+	assert.NoError(t, err)
+	frame, err := fr.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, "<13>message\n", string(frame))
+	frame, err = fr.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, "line", string(frame))
+	frame, err = fr.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, "next", string(frame))
+	_, err = fr.ReadFrame()
+	assert.Equal(t, io.EOF, err)
+
+	fr, err = NewFrameReader(bytes.NewReader([]byte("toolong\nok\n")), "newline", 4)
+	assert.NoError(t, err)
+	frame, err = fr.ReadFrame()
+	assert.Equal(t, ErrFrameTruncated, err)
+	assert.Equal(t, "tool", string(frame))
+	frame, err = fr.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(frame))
+
+	fr, err = NewFrameReader(bytes.NewReader([]byte("x message")), "octet_counted", 0)
+	assert.NoError(t, err)
+	_, err = fr.ReadFrame()
+	assert.Error(t, err)
+}
+
+func Test_AppendFrame(t *testing.T) {
+	buf := AppendFrame(nil, []byte("line\n"), "newline")
+	buf = AppendFrame(buf, []byte("<13>message\n"), "octet_counted")
+	assert.Equal(t, "line\n12 <13>message\n", string(buf))
+
+	fr, _ := NewFrameReader(bytes.NewReader(buf), "auto", 0)
+	frame, _ := fr.ReadFrame()
+	assert.Equal(t, "line", string(frame))
+	frame, _ = fr.ReadFrame()
+	assert.Equal(t, "<13>message\n", string(frame))
+}
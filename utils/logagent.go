@@ -0,0 +1,176 @@
+package utils
+
+// 代理之间的转发协议，logagent输入和输出插件共用
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// Frames start with "LA", version and type, numbers are big endian.
+//
+//	batch: "LA" 1 'B' flags(1) seq(8) count(4) size(4) payload(size)
+//	ack:   "LA" 1 'A' seq(8)
+//
+// Payload is count msgpack events packed one after another, gzipped if flags has 1.
+const (
+	agentVersion    = 1
+	agentFrameBatch = 'B'
+	agentFrameAck   = 'A'
+	agentFlagGzip   = 1
+)
+
+// AgentReader read frames of logagent protocol.
+type AgentReader struct {
+	reader  *bufio.Reader
+	maxSize int
+	codec   Codec
+}
+
+// NewAgentCodec codec of events in batch payload.
+func NewAgentCodec() (Codec, error) {
+	return NewCodec(ConfigPart{"type": "msgpack"})
+}
+
+// AgentBatch frame of events encoded by agent codec.
+func AgentBatch(seq uint64, events [][]byte, compress bool) (frame []byte, err error) {
+	var (
+		payload bytes.Buffer
+		flags   byte
+	)
+	if compress {
+		flags |= agentFlagGzip
+		writer := gzip.NewWriter(&payload)
+		for _, data := range events {
+			if _, err = writer.Write(data); err != nil {
+				return
+			}
+		}
+		if err = writer.Close(); err != nil {
+			return
+		}
+	} else {
+		for _, data := range events {
+			payload.Write(data)
+		}
+	}
+	frame = make([]byte, 21, 21+payload.Len())
+	copy(frame, []byte{'L', 'A', agentVersion, agentFrameBatch, flags})
+	binary.BigEndian.PutUint64(frame[5:], seq)
+	binary.BigEndian.PutUint32(frame[13:], uint32(len(events)))
+	binary.BigEndian.PutUint32(frame[17:], uint32(payload.Len()))
+	frame = append(frame, payload.Bytes()...)
+	return
+}
+
+// AgentAck frame of acknowledged batch.
+func AgentAck(seq uint64) []byte {
+	frame := make([]byte, 12)
+	copy(frame, []byte{'L', 'A', agentVersion, agentFrameAck})
+	binary.BigEndian.PutUint64(frame[4:], seq)
+	return frame
+}
+
+// NewAgentReader create reader, maxSize is bytes of a payload at most before
+// and after decompression, default 32MiB.
+func NewAgentReader(r io.Reader, maxSize int) (ar *AgentReader, err error) {
+	if maxSize <= 0 {
+		maxSize = 32 * 1024 * 1024
+	}
+	ar = &AgentReader{
+		reader:  bufio.NewReaderSize(r, 16*1024),
+		maxSize: maxSize,
+	}
+	ar.codec, err = NewAgentCodec()
+	return
+}
+
+// ReadBatch read a batch frame and decode its events.
+func (ar *AgentReader) ReadBatch() (seq uint64, events []LogEvent, err error) {
+	var (
+		head    = make([]byte, 17)
+		payload []byte
+	)
+	if err = ar.readHeader(agentFrameBatch); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(ar.reader, head); err != nil {
+		return
+	}
+	seq = binary.BigEndian.Uint64(head[1:])
+	count := int(binary.BigEndian.Uint32(head[9:]))
+	size := int(binary.BigEndian.Uint32(head[13:]))
+	if size > ar.maxSize {
+		err = errors.New("logagent batch too large " + strconv.Itoa(size))
+		return
+	}
+	payload = make([]byte, size)
+	if _, err = io.ReadFull(ar.reader, payload); err != nil {
+		return
+	}
+	if head[0]&agentFlagGzip != 0 {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(payload)); err != nil {
+			return
+		}
+		// read one more byte to detect oversize.
+		payload, err = ioutil.ReadAll(io.LimitReader(zr, int64(ar.maxSize)+1))
+		zr.Close()
+		if err != nil {
+			return
+		}
+		if len(payload) > ar.maxSize {
+			err = errors.New("logagent batch too large after decompression")
+			return
+		}
+	}
+	if events, err = ar.codec.Decode(payload); err != nil {
+		return
+	}
+	if len(events) != count {
+		err = errors.New("logagent batch expect " + strconv.Itoa(count) +
+			" events, got " + strconv.Itoa(len(events)))
+	}
+	return
+}
+
+// ReadAck read an ack frame.
+func (ar *AgentReader) ReadAck() (seq uint64, err error) {
+	var (
+		head = make([]byte, 8)
+	)
+	if err = ar.readHeader(agentFrameAck); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(ar.reader, head); err != nil {
+		return
+	}
+	seq = binary.BigEndian.Uint64(head)
+	return
+}
+
+// readHeader check magic, version and frame type.
+func (ar *AgentReader) readHeader(frameType byte) (err error) {
+	var (
+		head = make([]byte, 4)
+	)
+	if _, err = io.ReadFull(ar.reader, head); err != nil {
+		return
+	}
+	if head[0] != 'L' || head[1] != 'A' {
+		return errors.New("logagent invalid frame")
+	}
+	if head[2] != agentVersion {
+		return errors.New("logagent unsupported version " + strconv.Itoa(int(head[2])))
+	}
+	if head[3] != frameType {
+		return errors.New("logagent unexpected frame type " + string(head[3:]))
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AgentFrame(t *testing.T) {
+	codec, err := NewAgentCodec()
+	assert.NoError(t, err)
+	ts := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	var events [][]byte
+	for _, msg := range []string{"a", "b"} {
+		data, err := codec.Encode(LogEvent{
+			Timestamp: ts,
+			Message:   msg,
+			Tags:      []string{"web"},
+			Extra:     map[string]interface{}{"host": "edge1", "code": 200},
+		})
+		assert.NoError(t, err)
+		events = append(events, data)
+	}
+
+	stream := &bytes.Buffer{}
+	for i, compress := range []bool{false, true} {
+		frame, err := AgentBatch(uint64(i+1), events, compress)
+		assert.NoError(t, err)
+		stream.Write(frame)
+	}
+	stream.Write(AgentAck(7))
+
+	reader, err := NewAgentReader(stream, 0)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		seq, got, err := reader.ReadBatch()
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i+1), seq)
+		assert.Len(t, got, 2)
+		assert.Equal(t, "b", got[1].Message)
+		assert.Equal(t, ts, got[0].Timestamp)
+		assert.Equal(t, []string{"web"}, got[0].Tags)
+		assert.Equal(t, "edge1", got[0].Extra["host"])
+		assert.EqualValues(t, 200, got[0].Extra["code"])
+	}
+	seq, err := reader.ReadAck()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), seq)
+	_, err = reader.ReadAck()
+	assert.Equal(t, io.EOF, err)
+
+	// empty batch.
+	frame, err := AgentBatch(9, nil, true)
+	assert.NoError(t, err)
+	reader, _ = NewAgentReader(bytes.NewReader(frame), 0)
+	seq, got, err := reader.ReadBatch()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(9), seq)
+	assert.Len(t, got, 0)
+}
+
+func Test_AgentFrameInvalid(t *testing.T) {
+	codec, _ := NewAgentCodec()
+	data, _ := codec.Encode(LogEvent{Message: string(make([]byte, 1024)), Extra: map[string]interface{}{}})
+
+	// too large, before and after decompression.
+	for _, compress := range []bool{false, true} {
+		frame, err := AgentBatch(1, [][]byte{data}, compress)
+		assert.NoError(t, err)
+		reader, _ := NewAgentReader(bytes.NewReader(frame), 512)
+		_, _, err = reader.ReadBatch()
+		assert.Error(t, err)
+	}
+
+	// count mismatch.
+	frame, _ := AgentBatch(1, [][]byte{data}, false)
+	frame[16] = 2
+	reader, _ := NewAgentReader(bytes.NewReader(frame), 0)
+	_, _, err := reader.ReadBatch()
+	assert.Error(t, err)
+
+	// ack expected.
+	frame, _ = AgentBatch(1, [][]byte{data}, false)
+	reader, _ = NewAgentReader(bytes.NewReader(frame), 0)
+	_, err = reader.ReadAck()
+	assert.Error(t, err)
+
+	// bad magic and version.
+	for _, head := range [][]byte{[]byte("XA\x01A"), []byte("LA\x02A")} {
+		reader, _ = NewAgentReader(bytes.NewReader(append(head, make([]byte, 8)...)), 0)
+		_, err = reader.ReadAck()
+		assert.Error(t, err)
+	}
+}
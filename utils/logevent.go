@@ -106,6 +106,43 @@ func (le LogEvent) GetMap() map[string]interface{} {
 	return event
 }
 
+// LogEventFromMap build LogEvent from the map produced by GetMap.
+func LogEventFromMap(event map[string]interface{}) (le LogEvent) {
+	le = LogEvent{
+		Timestamp: time.Now(),
+		Extra:     map[string]interface{}{},
+	}
+	for key, value := range event {
+		switch key {
+		case "@timestamp":
+			if ts, ok := value.(string); ok {
+				if t, err := time.Parse(timeFormat, ts); err == nil {
+					le.Timestamp = t
+				} else if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+					le.Timestamp = t
+				}
+			}
+		case "message":
+			if msg, ok := value.(string); ok {
+				le.Message = msg
+			} else {
+				le.Extra[key] = value
+			}
+		case "tags":
+			if tags, ok := value.([]interface{}); ok {
+				for _, tag := range tags {
+					if s, ok := tag.(string); ok {
+						le.Tags = append(le.Tags, s)
+					}
+				}
+			}
+		default:
+			le.Extra[key] = value
+		}
+	}
+	return
+}
+
 // FormatWithEnv fill environment var
 func FormatWithEnv(text string) (result string) {
 	result = text
@@ -0,0 +1,121 @@
+package utils
+
+// 网络输出的连接：按需拨号，断线重连，流式连接按framing分帧
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+)
+
+// NetWriter write frames to a tcp or udp peer, dial on demand.
+// It is not safe for concurrent use.
+type NetWriter struct {
+	network   string
+	addr      string
+	framing   string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+	conn      net.Conn
+	closed    chan int // closed when the peer closed the connection
+	buf       []byte
+}
+
+// NewNetWriter create writer, framing of tcp is newline or octet_counted,
+// tlsConfig is used by tcp only.
+func NewNetWriter(network string, addr string, framing string, timeout time.Duration,
+	tlsConfig *tls.Config) (w *NetWriter, err error) {
+	switch network {
+	case "tcp", "udp":
+	default:
+		err = errors.New("unknow network " + network)
+		return
+	}
+	switch framing {
+	case "":
+		framing = "newline"
+	case "newline", "octet_counted":
+	default:
+		err = errors.New("unknow framing " + framing)
+		return
+	}
+	w = &NetWriter{
+		network:   network,
+		addr:      addr,
+		framing:   framing,
+		timeout:   timeout,
+		tlsConfig: tlsConfig,
+	}
+	return
+}
+
+// Write send a frame, reconnect if the connection is broken.
+// The connection is closed after a failed write, next write dial again.
+func (w *NetWriter) Write(frame []byte) (err error) {
+	if w.conn != nil && w.network == "tcp" && !w.alive() {
+		Logger.Infof("Connection to %s closed by peer, reconnect", w.addr)
+		w.Close()
+	}
+	if w.conn == nil {
+		if err = w.dial(); err != nil {
+			return
+		}
+	}
+	data := frame
+	if w.network == "tcp" {
+		w.buf = AppendFrame(w.buf[:0], frame, w.framing)
+		data = w.buf
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	if _, err = w.conn.Write(data); err != nil {
+		w.Close()
+	}
+	return
+}
+
+// Close the connection.
+func (w *NetWriter) Close() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// dial connect the peer.
+func (w *NetWriter) dial() (err error) {
+	dialer := &net.Dialer{
+		Timeout: w.timeout,
+	}
+	if w.network == "tcp" && w.tlsConfig != nil {
+		w.conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, w.tlsConfig)
+	} else {
+		w.conn, err = dialer.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		// a typed nil of failed tls dial is not a nil interface.
+		w.conn = nil
+		return
+	}
+	if w.network == "tcp" {
+		w.closed = make(chan int)
+		go func(conn net.Conn, closed chan int) {
+			// a peer never sends, read returns when the connection is closed.
+			io.Copy(ioutil.Discard, conn)
+			close(closed)
+		}(w.conn, w.closed)
+	}
+	return
+}
+
+// alive check the connection is not closed by peer.
+func (w *NetWriter) alive() bool {
+	select {
+	case <-w.closed:
+		return false
+	default:
+		return true
+	}
+}
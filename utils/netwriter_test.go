@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NetWriter(t *testing.T) {
+	_, err := NewNetWriter("unix", "/tmp/x", "", time.Second, nil)
+	assert.Error(t, err)
+	_, err = NewNetWriter("tcp", "127.0.0.1:1", "xml", time.Second, nil)
+	assert.Error(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	frames := make(chan string, 10)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				fr, _ := NewFrameReader(conn, "octet_counted", 0)
+				for {
+					frame, err := fr.ReadFrame()
+					if err != nil {
+						return
+					}
+					frames <- string(frame)
+				}
+			}()
+		}
+	}()
+
+	w, err := NewNetWriter("tcp", listener.Addr().String(), "octet_counted", time.Second, nil)
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.NoError(t, w.Write([]byte("first")))
+	assert.Equal(t, "first", <-frames)
+
+	// peer closed, reconnect before write.
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, w.Write([]byte("second")))
+	assert.Equal(t, "second", <-frames)
+	assert.Len(t, conns, 1)
+
+	listener.Close()
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Error(t, w.Write([]byte("third")))
+	assert.Nil(t, w.conn)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"errors"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,10 +21,20 @@ type OutputPlugin interface {
 	Stop()
 }
 
+// BatchOutputPlugin output sending events in batches. Events stay in disk
+// queue until ProcessBatch of their batch returns nil, a failed batch is
+// sent again as a whole.
+type BatchOutputPlugin interface {
+	OutputPlugin
+	ProcessBatch(events []LogEvent) error
+	Batch() (count int, interval time.Duration) // events of a batch at most, time the first event waits at most
+}
+
 type diskOutput struct {
-	queue    queue.Queue
-	exitChan chan int
-	group    *sync.WaitGroup
+	queue     queue.Queue
+	exitChan  chan int
+	drainChan chan chan error
+	group     *sync.WaitGroup
 }
 
 // OutputPluginConfig base type struct of output plugin config.
@@ -34,8 +45,17 @@ type OutputPluginConfig struct {
 // OutputHandler factory interface type
 type OutputHandler interface{}
 
+// drainRetries failures in a row an output gives up draining.
+const drainRetries = 3
+
 var (
 	mapOutputHandler = map[string]OutputHandler{}
+
+	// outputRetryDelay wait after output process failed.
+	outputRetryDelay = 5 * time.Second
+
+	// ErrUndelivered some events are left in disk queue when draining.
+	ErrUndelivered = errors.New("events undelivered")
 )
 
 // RegistOutputHandler regist handler by name.
@@ -49,17 +69,18 @@ func (c *Config) Output(ev LogEvent) (err error) {
 		rets []reflect.Value
 	)
 
-	rets, err = c.Invoke(func(plugins []OutputPlugin, outputs map[string]*diskOutput) (err error) {
+	rets, err = c.Invoke(func(plugins []OutputPlugin, outputs map[OutputPlugin]*diskOutput) (err error) {
 		for _, plugin := range plugins {
-			dq := outputs[plugin.GetType()]
+			dq := outputs[plugin]
 			buff := &bytes.Buffer{}
-			err = gob.NewEncoder(buff).Encode(ev)
-			if err != nil {
-				Logger.Warnf("Encoder return error %s", err)
-				return
+			if eerr := gob.NewEncoder(buff).Encode(ev); eerr != nil {
+				Logger.Warnf("Encoder return error %s", eerr)
+				return eerr
+			}
+			// write diskqueue sync, the first error is returned.
+			if perr := dq.queue.Put(buff.Bytes()); perr != nil && err == nil {
+				err = perr
 			}
-			// write diskqueue sync
-			err = dq.queue.Put(buff.Bytes())
 		}
 		return
 	})
@@ -72,7 +93,10 @@ func (c *Config) Output(ev LogEvent) (err error) {
 
 // RunOutputs start output plugin.
 func (c *Config) RunOutputs() (err error) {
-	var queues = map[string]*diskOutput{}
+	var (
+		queues = map[OutputPlugin]*diskOutput{}
+		types  = map[string]int{}
+	)
 
 	outputs, err := c.getOutputs()
 	if err != nil {
@@ -84,47 +108,98 @@ func (c *Config) RunOutputs() (err error) {
 	c.Map(group)
 	for _, plugin := range outputs {
 		dq := &diskOutput{
-			exitChan: make(chan int),
-			group:    group,
+			exitChan:  make(chan int),
+			drainChan: make(chan chan error),
+			group:     group,
 		}
 
-		dq.queue = queue.New(c.Name+"_"+plugin.GetType(), c.DataPath,
+		// every output has its own queue, name of the first of a type is unchanged.
+		name := c.Name + "_" + plugin.GetType()
+		if types[plugin.GetType()]++; types[plugin.GetType()] > 1 {
+			name += "_" + strconv.Itoa(types[plugin.GetType()])
+		}
+		dq.queue = queue.New(name, c.DataPath,
 			1024*1024*1024,
 			0,
 			1024*1024*10,
 			1024,
 			1*time.Second,
 			Logger)
-		queues[plugin.GetType()] = dq
+		queues[plugin] = dq
 
 		go func(dq *diskOutput, plugin OutputPlugin) {
 			dq.group.Add(1)
 			defer dq.group.Done()
 
 			var (
-				err     error
-				running = true
+				err      error
+				running  = true
+				failures int
+				drained  chan error // not nil while draining
+				idle     = time.NewTicker(100 * time.Millisecond)
+				idleChan <-chan time.Time
+				batch, _ = plugin.(BatchOutputPlugin)
+				count    = 1
+				interval time.Duration
+				peekChan = dq.queue.PeekChan()
+				waitChan <-chan time.Time // not nil while a batch is filling
+				deadline time.Time
+				ready    bool
 			)
+			defer idle.Stop()
+			if batch != nil {
+				if count, interval = batch.Batch(); count < 1 {
+					count = 1
+				}
+			}
 
 			for running {
 				select {
-				case raw := <-dq.queue.PeekChan():
-					ev := LogEvent{}
-					buff := &bytes.Buffer{}
-					if _, err = buff.Write(raw); err != nil {
-						goto next
+				case raw := <-peekChan:
+					if count > 1 && drained == nil && !ready && dq.queue.Depth() < int64(count) {
+						// wait until the batch is full or the interval passed.
+						peekChan, waitChan, deadline = nil, idle.C, time.Now().Add(interval)
+						continue
 					}
-					if err = gob.NewDecoder(buff).Decode(&ev); err != nil {
-						Logger.Warnf("Decoder return error %s", err)
-						goto next
+					raws := [][]byte{raw}
+					if count > 1 {
+						if peeked := dq.queue.Peek(count); len(peeked) > 0 {
+							raws = peeked
+						}
 					}
-					if err = plugin.Process(ev); err != nil {
-						Logger.Warnf("Output process return error %s, retry in 5 sec.", err)
-						time.Sleep(5 * time.Second)
+					if err = processRaws(plugin, raws); err != nil {
+						if drained != nil {
+							if failures++; failures >= drainRetries {
+								Logger.Errorf("Output %s give up draining, %d events left in disk queue.",
+									plugin.GetType(), dq.queue.Depth())
+								drained <- err
+								drained, idleChan = nil, nil
+								continue
+							}
+						}
+						Logger.Warnf("Output process return error %s, retry in %s.", err, outputRetryDelay)
+						time.Sleep(outputRetryDelay)
 						continue
 					}
-				next:
-					<-dq.queue.ReadChan()
+					failures, ready = 0, false
+					// events are removed only after they are sent.
+					for range raws {
+						<-dq.queue.ReadChan()
+					}
+				case <-waitChan:
+					if dq.queue.Depth() >= int64(count) || time.Now().After(deadline) {
+						peekChan, waitChan, ready = dq.queue.PeekChan(), nil, true
+					}
+				case drained = <-dq.drainChan:
+					failures = 0
+					idleChan = idle.C
+					peekChan, waitChan = dq.queue.PeekChan(), nil
+				case <-idleChan:
+					// depth may be stale only after a read, check again next tick.
+					if dq.queue.Depth() == 0 {
+						drained <- nil
+						drained, idleChan = nil, nil
+					}
 				case <-dq.exitChan:
 					running = false
 				}
@@ -136,12 +211,34 @@ func (c *Config) RunOutputs() (err error) {
 	return
 }
 
+// processRaws decode events and send them, undecodable events are dropped.
+func processRaws(plugin OutputPlugin, raws [][]byte) (err error) {
+	var (
+		events []LogEvent
+	)
+	for _, raw := range raws {
+		ev := LogEvent{}
+		if derr := gob.NewDecoder(bytes.NewReader(raw)).Decode(&ev); derr != nil {
+			Logger.Warnf("Decoder return error %s", derr)
+			continue
+		}
+		events = append(events, ev)
+	}
+	if len(events) == 0 {
+		return
+	}
+	if batch, ok := plugin.(BatchOutputPlugin); ok {
+		return batch.ProcessBatch(events)
+	}
+	return plugin.Process(events[0])
+}
+
 // StopOutputs will block util gracefully stopped.
 func (c *Config) StopOutputs() (err error) {
-	_, err = c.Invoke(func(plugins []OutputPlugin, outputs map[string]*diskOutput, group *sync.WaitGroup) {
+	_, err = c.Invoke(func(plugins []OutputPlugin, outputs map[OutputPlugin]*diskOutput, group *sync.WaitGroup) {
 		for _, plugin := range plugins {
 			plugin.Stop()
-			dp := outputs[plugin.GetType()]
+			dp := outputs[plugin]
 			dp.exitChan <- 1
 		}
 		group.Wait()
@@ -149,6 +246,44 @@ func (c *Config) StopOutputs() (err error) {
 	return
 }
 
+// DrainOutputs block until events in disk queues are all processed, inputs
+// must be stopped first. An output gives up after drainRetries failures in a
+// row and its events are kept in disk queue, ErrUndelivered is returned then.
+// Closing abortChan stop waiting.
+func (c *Config) DrainOutputs(abortChan chan int) (err error) {
+	var (
+		rets []reflect.Value
+	)
+	rets, err = c.Invoke(func(plugins []OutputPlugin, outputs map[OutputPlugin]*diskOutput) (err error) {
+		results := []chan error{}
+		for _, plugin := range plugins {
+			result := make(chan error, 1)
+			select {
+			case outputs[plugin].drainChan <- result:
+			case <-abortChan:
+				return ErrUndelivered
+			}
+			results = append(results, result)
+		}
+		for _, result := range results {
+			select {
+			case derr := <-result:
+				if derr != nil {
+					err = ErrUndelivered
+				}
+			case <-abortChan:
+				return ErrUndelivered
+			}
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = CheckError(rets)
+	return
+}
+
 // getOutputs.
 func (c *Config) getOutputs() (outputs []OutputPlugin, err error) {
 	for _, part := range c.OutputPart {
@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tuhuayuan/go-logagent/queue"
 )
 
 type TestOutputPlugin struct {
@@ -51,3 +54,178 @@ func Test_RunOutputs(t *testing.T) {
 	err = config.StopOutputs()
 	assert.NoError(t, err)
 }
+
+type drainOutputPlugin struct {
+	OutputPluginConfig
+	Fail bool `json:"fail"`
+
+	processed chan LogEvent
+}
+
+func Test_DrainOutputs(t *testing.T) {
+	outputRetryDelay = 10 * time.Millisecond
+	defer func() {
+		outputRetryDelay = 5 * time.Second
+	}()
+	plugins := map[string]*drainOutputPlugin{}
+	RegistOutputHandler("drain_output", func(part *ConfigPart) *drainOutputPlugin {
+		plugin := &drainOutputPlugin{processed: make(chan LogEvent, 10)}
+		ReflectConfigPart(part, plugin)
+		plugins[plugin.Type] = plugin
+		return plugin
+	})
+
+	for _, fail := range []bool{false, true} {
+		config, err := LoadFromString(fmt.Sprintf(`{
+			"output": [{
+				"type": "drain_output",
+				"fail": %v
+			}]
+		}`, fail))
+		assert.NoError(t, err)
+		assert.NoError(t, config.RunOutputs())
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, config.Output(LogEvent{Message: fmt.Sprint(i)}))
+		}
+
+		err = config.DrainOutputs(make(chan int))
+		if fail {
+			assert.Equal(t, ErrUndelivered, err)
+			assert.Len(t, plugins["drain_output"].processed, 0)
+		} else {
+			assert.NoError(t, err)
+			assert.Len(t, plugins["drain_output"].processed, 5)
+		}
+		assert.NoError(t, config.StopOutputs())
+	}
+}
+
+func Test_DrainOutputsSameType(t *testing.T) {
+	plugins := []*drainOutputPlugin{}
+	RegistOutputHandler("drain_output", func(part *ConfigPart) *drainOutputPlugin {
+		plugin := &drainOutputPlugin{processed: make(chan LogEvent, 10)}
+		ReflectConfigPart(part, plugin)
+		plugins = append(plugins, plugin)
+		return plugin
+	})
+
+	// outputs of a type are drained and stopped one by one.
+	config, err := LoadFromString(`{
+		"output": [{"type": "drain_output"}, {"type": "drain_output"}]
+	}`)
+	assert.NoError(t, err)
+	assert.NoError(t, config.RunOutputs())
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, config.Output(LogEvent{Message: fmt.Sprint(i)}))
+	}
+	assert.NoError(t, config.DrainOutputs(make(chan int)))
+	assert.Len(t, plugins, 2)
+	for _, plugin := range plugins {
+		assert.Len(t, plugin.processed, 5)
+	}
+	assert.NoError(t, config.StopOutputs())
+}
+
+func (plugin *drainOutputPlugin) Process(ev LogEvent) (err error) {
+	if plugin.Fail {
+		return errors.New("always fail")
+	}
+	plugin.processed <- ev
+	return
+}
+
+func (plugin *drainOutputPlugin) Stop() {
+}
+
+type batchOutputPlugin struct {
+	OutputPluginConfig
+	Failures int `json:"failures"`
+
+	batches chan []LogEvent
+}
+
+func Test_BatchOutputs(t *testing.T) {
+	outputRetryDelay = 10 * time.Millisecond
+	defer func() {
+		outputRetryDelay = 5 * time.Second
+	}()
+	var plugin *batchOutputPlugin
+	RegistOutputHandler("batch_output", func(part *ConfigPart) *batchOutputPlugin {
+		plugin = &batchOutputPlugin{batches: make(chan []LogEvent, 10)}
+		ReflectConfigPart(part, plugin)
+		return plugin
+	})
+
+	config, err := LoadFromString(`{
+		"output": [{"type": "batch_output", "failures": 2}]
+	}`)
+	assert.NoError(t, err)
+	assert.NoError(t, config.RunOutputs())
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, config.Output(LogEvent{Message: fmt.Sprint(i)}))
+	}
+
+	// failed batches are kept in disk queue and sent again.
+	batch := <-plugin.batches
+	assert.Len(t, batch, 3)
+	assert.Equal(t, "0", batch[0].Message)
+	assert.Equal(t, "3", (<-plugin.batches)[0].Message)
+	// the last event waits for the interval.
+	start := time.Now()
+	batch = <-plugin.batches
+	assert.Len(t, batch, 1)
+	assert.Equal(t, "6", batch[0].Message)
+	assert.True(t, time.Since(start) > 100*time.Millisecond)
+
+	assert.NoError(t, config.DrainOutputs(make(chan int)))
+	assert.NoError(t, config.StopOutputs())
+}
+
+func (plugin *batchOutputPlugin) Process(ev LogEvent) error {
+	return plugin.ProcessBatch([]LogEvent{ev})
+}
+
+func (plugin *batchOutputPlugin) ProcessBatch(events []LogEvent) error {
+	if plugin.Failures > 0 {
+		plugin.Failures--
+		return errors.New("fail")
+	}
+	plugin.batches <- events
+	return nil
+}
+
+func (plugin *batchOutputPlugin) Batch() (int, time.Duration) {
+	return 3, 300 * time.Millisecond
+}
+
+func (plugin *batchOutputPlugin) Stop() {
+}
+
+type putQueue struct {
+	queue.Queue
+	err  error
+	puts int
+}
+
+func (q *putQueue) Put(data []byte) error {
+	q.puts++
+	return q.err
+}
+
+func Test_OutputPutError(t *testing.T) {
+	config, err := LoadFromString(`{}`)
+	assert.NoError(t, err)
+
+	first, second := &TestOutputPlugin{}, &TestOutputPlugin{}
+	failed, ok := &putQueue{err: errors.New("queue full")}, &putQueue{}
+	config.Map([]OutputPlugin{first, second})
+	config.Map(map[OutputPlugin]*diskOutput{
+		first:  {queue: failed},
+		second: {queue: ok},
+	})
+
+	err = config.Output(LogEvent{Message: "test"})
+	assert.EqualError(t, err, "queue full")
+	assert.Equal(t, 1, failed.puts)
+	assert.Equal(t, 1, ok.puts)
+}
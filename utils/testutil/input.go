@@ -0,0 +1,73 @@
+// Package testutil helpers shared by plugin tests.
+package testutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/inject"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuhuayuan/go-logagent/utils"
+)
+
+// InputChannel collect events sent by input plugin.
+type InputChannel struct {
+	Events chan utils.LogEvent
+
+	err  error
+	lock *sync.Mutex
+}
+
+// NewInputChannel buffer size events.
+func NewInputChannel(size int) *InputChannel {
+	return &InputChannel{
+		Events: make(chan utils.LogEvent, size),
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Input implement utils.InputChannel, fail if refused.
+func (c *InputChannel) Input(ev utils.LogEvent) error {
+	c.lock.Lock()
+	err := c.err
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	c.Events <- ev
+	return nil
+}
+
+// Fail refuse events by err, accept again if err is nil.
+func (c *InputChannel) Fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.err = err
+}
+
+// StartInput run an input plugin of type name configed by part as RunInputs
+// does, events are sent to a channel buffer size events. It waits a moment
+// for the plugin listening.
+func StartInput(t *testing.T, name string, part utils.ConfigPart, size int) (plugin utils.InputPlugin, inChan *InputChannel) {
+	inChan = NewInputChannel(size)
+	conf := utils.ConfigPart{"type": name}
+	for k, v := range part {
+		conf[k] = v
+	}
+	config := utils.Config{
+		Injector:  inject.New(),
+		InputPart: []utils.ConfigPart{conf},
+	}
+	config.Map(utils.Logger)
+	config.MapTo(inChan, (*utils.InputChannel)(nil))
+	if !assert.NoError(t, config.RunInputs()) {
+		t.FailNow()
+	}
+	config.Invoke(func(plugins []utils.InputPlugin) {
+		plugin = plugins[0]
+	})
+	time.Sleep(100 * time.Millisecond)
+	return
+}
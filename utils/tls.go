@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// TLSConfig tls options of network plugin.
+type TLSConfig struct {
+	TLS           bool   `json:"tls"`             // enable tls
+	TLSCert       string `json:"tls_cert"`        // certificate file (pem)
+	TLSKey        string `json:"tls_key"`         // private key file (pem)
+	TLSCA         string `json:"tls_ca"`          // ca file to verify the peer
+	TLSVerify     bool   `json:"tls_verify"`      // server: require client certificate
+	TLSSkipVerify bool   `json:"tls_skip_verify"` // client: do not verify server certificate
+	TLSServerName string `json:"tls_server_name"` // client: name in server certificate
+}
+
+// ServerTLS build server side tls config, nil if tls not enabled.
+func (c TLSConfig) ServerTLS() (config *tls.Config, err error) {
+	var (
+		cert tls.Certificate
+	)
+	if !c.TLS {
+		return
+	}
+	if c.TLSCert == "" || c.TLSKey == "" {
+		err = errors.New("tls_cert and tls_key required")
+		return
+	}
+	if cert, err = tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+		return
+	}
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.TLSCA != "" {
+		if config.ClientCAs, err = loadCertPool(c.TLSCA); err != nil {
+			return
+		}
+	}
+	if c.TLSVerify {
+		if config.ClientCAs == nil {
+			err = errors.New("tls_ca required to verify client")
+			return
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return
+}
+
+// ClientTLS build client side tls config, nil if tls not enabled.
+func (c TLSConfig) ClientTLS() (config *tls.Config, err error) {
+	var (
+		cert tls.Certificate
+	)
+	if !c.TLS {
+		return
+	}
+	config = &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+	if c.TLSCA != "" {
+		if config.RootCAs, err = loadCertPool(c.TLSCA); err != nil {
+			return
+		}
+	}
+	// client certificate is optional.
+	if c.TLSCert != "" && c.TLSKey != "" {
+		if cert, err = tls.LoadX509KeyPair(c.TLSCert, c.TLSKey); err != nil {
+			return
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+// loadCertPool load pem certificates from file.
+func loadCertPool(path string) (pool *x509.CertPool, err error) {
+	var (
+		data []byte
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		err = errors.New("no certificate found in " + path)
+	}
+	return
+}
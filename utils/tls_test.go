@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCert write a self-signed certificate of localhost.
+func writeTestCert(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return
+}
+
+func Test_TLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir)
+
+	config, err := TLSConfig{}.ServerTLS()
+	assert.NoError(t, err)
+	assert.Nil(t, config)
+	_, err = TLSConfig{TLS: true}.ServerTLS()
+	assert.Error(t, err)
+
+	server, err := TLSConfig{
+		TLS:       true,
+		TLSCert:   certFile,
+		TLSKey:    keyFile,
+		TLSCA:     certFile,
+		TLSVerify: true,
+	}.ServerTLS()
+	assert.NoError(t, err)
+	client, err := TLSConfig{
+		TLS:           true,
+		TLSCert:       certFile,
+		TLSKey:        keyFile,
+		TLSCA:         certFile,
+		TLSServerName: "localhost",
+	}.ClientTLS()
+	assert.NoError(t, err)
+
+	c1, c2 := net.Pipe()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- tls.Server(c1, server).Handshake()
+	}()
+	assert.NoError(t, tls.Client(c2, client).Handshake())
+	assert.NoError(t, <-errChan)
+}